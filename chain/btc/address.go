@@ -0,0 +1,128 @@
+package btc
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/h8848/blockchain-infra/chain/hdwallet"
+)
+
+// AddressType is the script type of an address
+type AddressType string
+
+const (
+	P2PKH      AddressType = "p2pkh"
+	P2SHP2WPKH AddressType = "p2sh-p2wpkh"
+	P2WPKH     AddressType = "p2wpkh"
+	P2TR       AddressType = "p2tr"
+)
+
+// Purpose is the BIP-44 purpose used for the address type: 44, 49, 84 or 86
+func (t AddressType) Purpose() (uint32, error) {
+	switch t {
+	case P2PKH:
+		return 44, nil
+	case P2SHP2WPKH:
+		return 49, nil
+	case P2WPKH:
+		return 84, nil
+	case P2TR:
+		return 86, nil
+	}
+	return 0, fmt.Errorf("unsupported address type=%s", t)
+}
+
+// Path returns the derivation path m/purpose'/coin'/account'/change/index, coin is 1 on test networks
+func (t AddressType) Path(net *chaincfg.Params, account, change, index uint32) (string, error) {
+	purpose, err := t.Purpose()
+	if err != nil {
+		return "", err
+	}
+	coin := uint32(0)
+	if net.Net != chaincfg.MainNetParams.Net {
+		coin = 1
+	}
+	return fmt.Sprintf("m/%d'/%d'/%d'/%d/%d", purpose, coin, account, change, index), nil
+}
+
+// NewAddress returns the address of type t for pub
+// P2TR uses the BIP-86 key path only output key, without a script tree
+func NewAddress(pub *btcec.PublicKey, t AddressType, net *chaincfg.Params) (btcutil.Address, error) {
+	hash := btcutil.Hash160(pub.SerializeCompressed())
+	switch t {
+	case P2PKH:
+		return btcutil.NewAddressPubKeyHash(hash, net)
+	case P2WPKH:
+		return btcutil.NewAddressWitnessPubKeyHash(hash, net)
+	case P2SHP2WPKH:
+		redeem, err := p2wpkhScript(hash)
+		if err != nil {
+			return nil, err
+		}
+		return btcutil.NewAddressScriptHash(redeem, net)
+	case P2TR:
+		outputKey := txscript.ComputeTaprootKeyNoScript(pub)
+		return btcutil.NewAddressTaproot(schnorr.SerializePubKey(outputKey), net)
+	}
+	return nil, fmt.Errorf("unsupported address type=%s", t)
+}
+
+// DeriveAddress derives the key of the standard path of t from the wallet and returns its address
+func DeriveAddress(w *hdwallet.HDWallet, t AddressType, net *chaincfg.Params, account, change, index uint32) (btcutil.Address, string, error) {
+	path, err := t.Path(net, account, change, index)
+	if err != nil {
+		return nil, "", err
+	}
+	key, err := w.ECDSAKey(path)
+	if err != nil {
+		return nil, "", err
+	}
+	priv, _ := btcec.PrivKeyFromBytes(key.D.FillBytes(make([]byte, 32)))
+	addr, err := NewAddress(priv.PubKey(), t, net)
+	if err != nil {
+		return nil, "", err
+	}
+	return addr, path, nil
+}
+
+// ValidateAddress decodes addr and checks that it belongs to net
+func ValidateAddress(addr string, net *chaincfg.Params) (btcutil.Address, error) {
+	decoded, err := btcutil.DecodeAddress(addr, net)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address=%s, err=%s", addr, err)
+	}
+	if !decoded.IsForNet(net) {
+		return nil, fmt.Errorf("address=%s is not for network=%s", addr, net.Name)
+	}
+	return decoded, nil
+}
+
+// IsValidAddress reports whether addr is a valid address of net
+func IsValidAddress(addr string, net *chaincfg.Params) bool {
+	_, err := ValidateAddress(addr, net)
+	return err == nil
+}
+
+// TypeOf returns the type of a wallet address, P2SH addresses are assumed to wrap P2WPKH
+// it is meant for the wallet's own input and change addresses, payment outputs may be of any standard type
+func TypeOf(addr btcutil.Address) (AddressType, error) {
+	switch addr.(type) {
+	case *btcutil.AddressPubKeyHash:
+		return P2PKH, nil
+	case *btcutil.AddressScriptHash:
+		return P2SHP2WPKH, nil
+	case *btcutil.AddressWitnessPubKeyHash:
+		return P2WPKH, nil
+	case *btcutil.AddressTaproot:
+		return P2TR, nil
+	}
+	return "", fmt.Errorf("unsupported address=%s", addr)
+}
+
+func p2wpkhScript(hash []byte) ([]byte, error) {
+	return txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(hash).Script()
+}
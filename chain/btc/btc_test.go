@@ -0,0 +1,147 @@
+package btc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestPaymentSignAndVerify(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	for _, typ := range []AddressType{P2PKH, P2SHP2WPKH, P2WPKH, P2TR} {
+		key, _ := btcec.NewPrivateKey()
+		addr, err := NewAddress(key.PubKey(), typ, net)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := TypeOf(addr); got != typ || !IsValidAddress(addr.EncodeAddress(), net) {
+			t.Fatalf("%s: address=%s type=%s", typ, addr, got)
+		}
+		if IsValidAddress(addr.EncodeAddress(), &chaincfg.MainNetParams) {
+			t.Fatalf("%s: regtest address valid on mainnet", typ)
+		}
+
+		script, _ := txscript.PayToAddrScript(addr)
+		funding := wire.NewMsgTx(2)
+		funding.AddTxIn(&wire.TxIn{})
+		funding.AddTxOut(wire.NewTxOut(60_000, script))
+		funding.AddTxOut(wire.NewTxOut(40_000, script))
+		var raw bytes.Buffer
+		_ = funding.Serialize(&raw)
+		var utxos []UTXO
+		for vout, out := range funding.TxOut {
+			utxos = append(utxos, UTXO{TxID: funding.TxHash().String(), Vout: uint32(vout), Value: out.Value,
+				Address: addr.EncodeAddress(), Confirmed: true, PrevTx: raw.Bytes()})
+		}
+
+		dest, _ := NewAddress(key.PubKey(), P2WPKH, net)
+		packet, sel, err := CreatePayment(&PaymentRequest{
+			UTXOs:         utxos,
+			Outputs:       []Output{{Address: dest.EncodeAddress(), Value: 70_000}},
+			ChangeAddress: addr.EncodeAddress(),
+			FeeRate:       5,
+			Net:           net,
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+		if len(sel.Inputs) != 2 || sel.Change != 100_000-70_000-sel.Fee {
+			t.Fatalf("%s: inputs=%d change=%d fee=%d", typ, len(sel.Inputs), sel.Change, sel.Fee)
+		}
+		keys, _ := KeysByScript([]*btcec.PrivateKey{key}, typ, net)
+		if err := SignPSBT(packet, keys); err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+		tx, err := FinalizePSBT(packet)
+		if err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+
+		prevOuts := txscript.NewMultiPrevOutFetcher(nil)
+		for _, in := range tx.TxIn {
+			prevOuts.AddPrevOut(in.PreviousOutPoint, funding.TxOut[in.PreviousOutPoint.Index])
+		}
+		hashes := txscript.NewTxSigHashes(tx, prevOuts)
+		for i, in := range tx.TxIn {
+			prev := funding.TxOut[in.PreviousOutPoint.Index]
+			vm, err := txscript.NewEngine(prev.PkScript, tx, i, txscript.StandardVerifyFlags, nil, hashes, prev.Value, prevOuts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := vm.Execute(); err != nil {
+				t.Fatalf("%s input %d: %v", typ, i, err)
+			}
+		}
+	}
+}
+
+func TestPaymentToP2WSH(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	key, _ := btcec.NewPrivateKey()
+	for _, typ := range []AddressType{P2PKH, P2SHP2WPKH, P2WPKH, P2TR} {
+		addr, _ := NewAddress(key.PubKey(), typ, net)
+		if size, err := OutputVSizeOf(addr); err != nil || size != OutputVSize(typ) {
+			t.Fatalf("%s: size=%d, err=%v", typ, size, err)
+		}
+	}
+	// a 1-of-1 multisig custody address
+	witnessScript, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_1).AddData(key.PubKey().SerializeCompressed()).
+		AddOp(txscript.OP_1).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	digest := sha256.Sum256(witnessScript)
+	custody, _ := btcutil.NewAddressWitnessScriptHash(digest[:], net)
+	if size, err := OutputVSizeOf(custody); err != nil || size != 43 {
+		t.Fatalf("p2wsh size=%d, err=%v", size, err)
+	}
+
+	from, _ := NewAddress(key.PubKey(), P2WPKH, net)
+	utxos := []UTXO{{TxID: "0000000000000000000000000000000000000000000000000000000000000001", Value: 100_000,
+		Address: from.EncodeAddress(), Confirmed: true}}
+	packet, sel, err := CreatePayment(&PaymentRequest{
+		UTXOs:         utxos,
+		Outputs:       []Output{{Address: custody.EncodeAddress(), Value: 50_000}},
+		ChangeAddress: from.EncodeAddress(),
+		FeeRate:       1,
+		Net:           net,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// overhead 11 + p2wpkh input 68 + p2wsh output 43 + p2wpkh change 31
+	if sel.Fee != 153 || len(packet.UnsignedTx.TxOut) != 2 {
+		t.Fatalf("fee=%d outputs=%d", sel.Fee, len(packet.UnsignedTx.TxOut))
+	}
+}
+
+func TestEsploraClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/address/bcrt1qaddr/utxo":
+			_, _ = w.Write([]byte(`[{"txid":"ab","vout":1,"value":1200,"status":{"confirmed":true,"block_height":10}}]`))
+		case "/fee-estimates":
+			_ = json.NewEncoder(w).Encode(map[string]float64{"1": 20.5, "3": 10.2, "6": 4.1})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := NewEsploraClient(server.URL + "/")
+	utxos, err := client.ListUnspent("bcrt1qaddr")
+	if err != nil || len(utxos) != 1 || utxos[0].Value != 1200 || !utxos[0].Confirmed {
+		t.Fatalf("utxos=%+v err=%v", utxos, err)
+	}
+	if rate, err := FeeRate(client, 2); err != nil || rate != 11 {
+		t.Fatalf("rate=%d err=%v", rate, err)
+	}
+	if rate, _ := FeeRate(client, 25); rate != 5 {
+		t.Fatalf("rate=%d", rate)
+	}
+}
@@ -0,0 +1,296 @@
+package btc
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Output is a payment output
+type Output struct {
+	Address string
+	Value   int64
+}
+
+// PaymentRequest is a payment funded by UTXOs of one address type
+// UTXOs without PkScript get the script of their Address, change goes to ChangeAddress
+type PaymentRequest struct {
+	UTXOs         []UTXO
+	Outputs       []Output
+	ChangeAddress string
+	FeeRate       int64
+	Net           *chaincfg.Params
+}
+
+// CreatePayment selects the coins for req and returns the unsigned PSBT with the selection
+func CreatePayment(req *PaymentRequest) (*psbt.Packet, *Selection, error) {
+	if len(req.UTXOs) == 0 || len(req.Outputs) == 0 {
+		return nil, nil, fmt.Errorf("utxos and outputs are required")
+	}
+	inputAddr, err := ValidateAddress(req.UTXOs[0].Address, req.Net)
+	if err != nil {
+		return nil, nil, err
+	}
+	inputType, err := TypeOf(inputAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	changeAddr, err := ValidateAddress(req.ChangeAddress, req.Net)
+	if err != nil {
+		return nil, nil, err
+	}
+	changeType, err := TypeOf(changeAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var amount int64
+	outputSizes := make([]int64, 0, len(req.Outputs))
+	outputs := make([]Output, 0, len(req.Outputs)+1)
+	for _, o := range req.Outputs {
+		addr, err := ValidateAddress(o.Address, req.Net)
+		if err != nil {
+			return nil, nil, err
+		}
+		size, err := OutputVSizeOf(addr)
+		if err != nil {
+			return nil, nil, err
+		}
+		if o.Value < DustLimit {
+			return nil, nil, fmt.Errorf("output value=%d to %s is below dust", o.Value, o.Address)
+		}
+		amount += o.Value
+		outputSizes = append(outputSizes, size)
+		outputs = append(outputs, o)
+	}
+
+	sel, err := SelectCoins(&SelectRequest{
+		UTXOs:        req.UTXOs,
+		Amount:       amount,
+		FeeRate:      req.FeeRate,
+		InputType:    inputType,
+		OutputVSizes: outputSizes,
+		ChangeType:   changeType,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if sel.Change > 0 {
+		outputs = append(outputs, Output{Address: req.ChangeAddress, Value: sel.Change})
+	}
+	packet, err := NewPSBT(sel.Inputs, outputs, req.Net)
+	if err != nil {
+		return nil, nil, err
+	}
+	return packet, sel, nil
+}
+
+// NewPSBT creates the unsigned PSBT spending inputs to outputs
+// segwit and taproot inputs carry the witness utxo, P2PKH inputs need UTXO.PrevTx
+func NewPSBT(inputs []UTXO, outputs []Output, net *chaincfg.Params) (*psbt.Packet, error) {
+	outPoints := make([]*wire.OutPoint, 0, len(inputs))
+	sequences := make([]uint32, 0, len(inputs))
+	for _, in := range inputs {
+		hash, err := chainhash.NewHashFromStr(in.TxID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid txid=%s, err=%s", in.TxID, err)
+		}
+		outPoints = append(outPoints, wire.NewOutPoint(hash, in.Vout))
+		// signal replace-by-fee
+		sequences = append(sequences, wire.MaxTxInSequenceNum-2)
+	}
+	txOuts := make([]*wire.TxOut, 0, len(outputs))
+	for _, o := range outputs {
+		addr, err := ValidateAddress(o.Address, net)
+		if err != nil {
+			return nil, err
+		}
+		script, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			return nil, err
+		}
+		txOuts = append(txOuts, wire.NewTxOut(o.Value, script))
+	}
+	packet, err := psbt.New(outPoints, txOuts, 2, 0, sequences)
+	if err != nil {
+		return nil, fmt.Errorf("create psbt failed, err=%s", err)
+	}
+	updater, err := psbt.NewUpdater(packet)
+	if err != nil {
+		return nil, err
+	}
+	for i, in := range inputs {
+		pkScript, err := utxoScript(in, net)
+		if err != nil {
+			return nil, err
+		}
+		class := txscript.GetScriptClass(pkScript)
+		if class == txscript.PubKeyHashTy {
+			if len(in.PrevTx) == 0 {
+				return nil, fmt.Errorf("input %s:%d is p2pkh, the previous transaction is required", in.TxID, in.Vout)
+			}
+			var prev wire.MsgTx
+			if err := prev.Deserialize(bytes.NewReader(in.PrevTx)); err != nil {
+				return nil, fmt.Errorf("decode previous transaction failed, err=%s", err)
+			}
+			if err := updater.AddInNonWitnessUtxo(&prev, i); err != nil {
+				return nil, err
+			}
+		} else if err := updater.AddInWitnessUtxo(wire.NewTxOut(in.Value, pkScript), i); err != nil {
+			return nil, err
+		}
+		if err := updater.AddInSighashType(sighashType(class), i); err != nil {
+			return nil, err
+		}
+	}
+	return packet, nil
+}
+
+// KeyFunc returns the private key that controls pkScript
+type KeyFunc func(pkScript []byte) (*btcec.PrivateKey, error)
+
+// KeysByScript builds a KeyFunc over a set of keys for the given address type and network
+func KeysByScript(keys []*btcec.PrivateKey, t AddressType, net *chaincfg.Params) (KeyFunc, error) {
+	byScript := make(map[string]*btcec.PrivateKey, len(keys))
+	for _, key := range keys {
+		addr, err := NewAddress(key.PubKey(), t, net)
+		if err != nil {
+			return nil, err
+		}
+		script, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			return nil, err
+		}
+		byScript[string(script)] = key
+	}
+	return func(pkScript []byte) (*btcec.PrivateKey, error) {
+		key, ok := byScript[string(pkScript)]
+		if !ok {
+			return nil, fmt.Errorf("no key for script=%x", pkScript)
+		}
+		return key, nil
+	}, nil
+}
+
+// SignPSBT adds the signatures of every input whose key is known, inputs without a key are skipped
+// so a PSBT can be signed by several parties before it is finalized
+func SignPSBT(packet *psbt.Packet, keys KeyFunc) error {
+	prevOuts := make(map[wire.OutPoint]*wire.TxOut, len(packet.Inputs))
+	for i := range packet.Inputs {
+		txOut, err := inputTxOut(packet, i)
+		if err != nil {
+			return err
+		}
+		prevOuts[packet.UnsignedTx.TxIn[i].PreviousOutPoint] = txOut
+	}
+	fetcher := txscript.NewMultiPrevOutFetcher(prevOuts)
+	sigHashes := txscript.NewTxSigHashes(packet.UnsignedTx, fetcher)
+	updater, err := psbt.NewUpdater(packet)
+	if err != nil {
+		return err
+	}
+
+	for i := range packet.Inputs {
+		txOut := prevOuts[packet.UnsignedTx.TxIn[i].PreviousOutPoint]
+		key, err := keys(txOut.PkScript)
+		if err != nil {
+			continue
+		}
+		pub := key.PubKey().SerializeCompressed()
+		switch class := txscript.GetScriptClass(txOut.PkScript); class {
+		case txscript.WitnessV1TaprootTy:
+			sig, err := txscript.RawTxInTaprootSignature(packet.UnsignedTx, sigHashes, i, txOut.Value, txOut.PkScript,
+				nil, txscript.SigHashDefault, key)
+			if err != nil {
+				return fmt.Errorf("sign input %d failed, err=%s", i, err)
+			}
+			packet.Inputs[i].TaprootKeySpendSig = sig
+			packet.Inputs[i].TaprootInternalKey = pub[1:]
+		case txscript.WitnessV0PubKeyHashTy:
+			sig, err := txscript.RawTxInWitnessSignature(packet.UnsignedTx, sigHashes, i, txOut.Value, txOut.PkScript,
+				txscript.SigHashAll, key)
+			if err != nil {
+				return fmt.Errorf("sign input %d failed, err=%s", i, err)
+			}
+			if _, err := updater.Sign(i, sig, pub, nil, nil); err != nil {
+				return fmt.Errorf("add signature of input %d failed, err=%s", i, err)
+			}
+		case txscript.ScriptHashTy:
+			redeem, err := p2wpkhScript(btcutil.Hash160(pub))
+			if err != nil {
+				return err
+			}
+			sig, err := txscript.RawTxInWitnessSignature(packet.UnsignedTx, sigHashes, i, txOut.Value, redeem,
+				txscript.SigHashAll, key)
+			if err != nil {
+				return fmt.Errorf("sign input %d failed, err=%s", i, err)
+			}
+			if _, err := updater.Sign(i, sig, pub, redeem, nil); err != nil {
+				return fmt.Errorf("add signature of input %d failed, err=%s", i, err)
+			}
+		case txscript.PubKeyHashTy:
+			sig, err := txscript.RawTxInSignature(packet.UnsignedTx, i, txOut.PkScript, txscript.SigHashAll, key)
+			if err != nil {
+				return fmt.Errorf("sign input %d failed, err=%s", i, err)
+			}
+			if _, err := updater.Sign(i, sig, pub, nil, nil); err != nil {
+				return fmt.Errorf("add signature of input %d failed, err=%s", i, err)
+			}
+		default:
+			return fmt.Errorf("input %d has unsupported script class=%s", i, class)
+		}
+	}
+	return nil
+}
+
+// FinalizePSBT finalizes every input and extracts the network transaction
+func FinalizePSBT(packet *psbt.Packet) (*wire.MsgTx, error) {
+	if err := psbt.MaybeFinalizeAll(packet); err != nil {
+		return nil, fmt.Errorf("finalize psbt failed, err=%s", err)
+	}
+	tx, err := psbt.Extract(packet)
+	if err != nil {
+		return nil, fmt.Errorf("extract transaction failed, err=%s", err)
+	}
+	return tx, nil
+}
+
+func utxoScript(in UTXO, net *chaincfg.Params) ([]byte, error) {
+	if len(in.PkScript) > 0 {
+		return in.PkScript, nil
+	}
+	addr, err := ValidateAddress(in.Address, net)
+	if err != nil {
+		return nil, err
+	}
+	return txscript.PayToAddrScript(addr)
+}
+
+func inputTxOut(packet *psbt.Packet, i int) (*wire.TxOut, error) {
+	in := packet.Inputs[i]
+	if in.WitnessUtxo != nil {
+		return in.WitnessUtxo, nil
+	}
+	if in.NonWitnessUtxo != nil {
+		vout := packet.UnsignedTx.TxIn[i].PreviousOutPoint.Index
+		if int(vout) >= len(in.NonWitnessUtxo.TxOut) {
+			return nil, fmt.Errorf("input %d spends missing output %d", i, vout)
+		}
+		return in.NonWitnessUtxo.TxOut[vout], nil
+	}
+	return nil, fmt.Errorf("input %d has no utxo", i)
+}
+
+func sighashType(class txscript.ScriptClass) txscript.SigHashType {
+	if class == txscript.WitnessV1TaprootTy {
+		return txscript.SigHashDefault
+	}
+	return txscript.SigHashAll
+}
@@ -0,0 +1,127 @@
+package btc
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// DustLimit is the smallest change output that is created, smaller change is left to the miner
+const DustLimit = 546
+
+// virtual sizes used for fee estimation
+const (
+	txOverheadVSize = 11
+)
+
+// InputVSize is the virtual size of spending an output of type t
+func InputVSize(t AddressType) int64 {
+	switch t {
+	case P2PKH:
+		return 148
+	case P2SHP2WPKH:
+		return 91
+	case P2TR:
+		return 58
+	}
+	return 68
+}
+
+// OutputVSizeOf is the virtual size of an output paying to addr, it works for any standard address
+// such as P2WSH, which has no AddressType because the wallet does not derive it
+func OutputVSizeOf(addr btcutil.Address) (int64, error) {
+	script, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return 0, fmt.Errorf("unsupported output address=%s, err=%s", addr, err)
+	}
+	// value, script length and script
+	return int64(8 + wire.VarIntSerializeSize(uint64(len(script))) + len(script)), nil
+}
+
+// OutputVSize is the virtual size of an output of type t
+func OutputVSize(t AddressType) int64 {
+	switch t {
+	case P2PKH:
+		return 34
+	case P2SHP2WPKH:
+		return 32
+	case P2TR:
+		return 43
+	}
+	return 31
+}
+
+// Selection is the result of coin selection, Change is 0 when no change output is needed
+type Selection struct {
+	Inputs []UTXO
+	Fee    int64
+	Change int64
+}
+
+// SelectRequest describes the payment for coin selection
+// InputType is the type of the UTXOs, OutputTypes are the payment outputs and ChangeType the change output
+// OutputVSizes are payment outputs given by size instead of type, as returned by OutputVSizeOf
+type SelectRequest struct {
+	UTXOs        []UTXO
+	Amount       int64
+	FeeRate      int64
+	InputType    AddressType
+	OutputTypes  []AddressType
+	OutputVSizes []int64
+	ChangeType   AddressType
+}
+
+// SelectCoins picks the UTXOs that pay Amount plus fee
+// a single UTXO that pays without change is preferred, otherwise the largest UTXOs are used first
+// to keep the number of inputs low. Unconfirmed UTXOs are not spent.
+func SelectCoins(req *SelectRequest) (*Selection, error) {
+	if req.Amount <= 0 || req.FeeRate <= 0 {
+		return nil, fmt.Errorf("amount and fee rate must be positive")
+	}
+	var candidates []UTXO
+	for _, u := range req.UTXOs {
+		if u.Confirmed {
+			candidates = append(candidates, u)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Value > candidates[j].Value })
+
+	base := int64(txOverheadVSize)
+	for _, t := range req.OutputTypes {
+		base += OutputVSize(t)
+	}
+	for _, size := range req.OutputVSizes {
+		base += size
+	}
+	inputSize := InputVSize(req.InputType)
+	changeSize := OutputVSize(req.ChangeType)
+
+	// exact match: one input, no change, the excess is below the cost of a change output plus dust
+	for i := len(candidates) - 1; i >= 0; i-- {
+		u := candidates[i]
+		fee := (base + inputSize) * req.FeeRate
+		excess := u.Value - req.Amount - fee
+		if excess >= 0 && excess < changeSize*req.FeeRate+DustLimit {
+			return &Selection{Inputs: []UTXO{u}, Fee: fee + excess}, nil
+		}
+	}
+
+	var selected []UTXO
+	var total int64
+	for _, u := range candidates {
+		selected = append(selected, u)
+		total += u.Value
+		size := base + int64(len(selected))*inputSize
+		withChange := (size + changeSize) * req.FeeRate
+		if change := total - req.Amount - withChange; change >= DustLimit {
+			return &Selection{Inputs: selected, Fee: withChange, Change: change}, nil
+		}
+		if noChange := size * req.FeeRate; total-req.Amount >= noChange {
+			return &Selection{Inputs: selected, Fee: total - req.Amount}, nil
+		}
+	}
+	return nil, fmt.Errorf("insufficient funds, have=%d, need=%d plus fee", total, req.Amount)
+}
@@ -0,0 +1,196 @@
+package btc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// UTXO is an unspent output
+// PrevTx is the raw transaction that created the output, it is only needed to spend P2PKH outputs
+type UTXO struct {
+	TxID        string
+	Vout        uint32
+	Value       int64
+	Address     string
+	PkScript    []byte
+	Confirmed   bool
+	BlockHeight int64
+	PrevTx      []byte
+}
+
+// UTXOSource lists unspent outputs and broadcasts transactions
+type UTXOSource interface {
+	ListUnspent(address string) ([]UTXO, error)
+	RawTransaction(txid string) ([]byte, error)
+	Broadcast(tx *wire.MsgTx) (string, error)
+}
+
+// FeeEstimator returns fee rates in sat/vB by confirmation target in blocks
+type FeeEstimator interface {
+	FeeEstimates() (map[int]float64, error)
+}
+
+// EsploraClient is a UTXOSource and FeeEstimator for the Esplora HTTP api used by blockstream.info and mempool.space
+type EsploraClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewEsploraClient creates the client, baseURL is such as https://blockstream.info/api
+func NewEsploraClient(baseURL string) *EsploraClient {
+	return &EsploraClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+type esploraUTXO struct {
+	TxID   string `json:"txid"`
+	Vout   uint32 `json:"vout"`
+	Value  int64  `json:"value"`
+	Status struct {
+		Confirmed   bool  `json:"confirmed"`
+		BlockHeight int64 `json:"block_height"`
+	} `json:"status"`
+}
+
+// ListUnspent implements UTXOSource, PkScript is derived from the address by the caller
+func (c *EsploraClient) ListUnspent(address string) ([]UTXO, error) {
+	var list []esploraUTXO
+	if err := c.getJSON("/address/"+address+"/utxo", &list); err != nil {
+		return nil, err
+	}
+	utxos := make([]UTXO, 0, len(list))
+	for _, u := range list {
+		utxos = append(utxos, UTXO{
+			TxID:        u.TxID,
+			Vout:        u.Vout,
+			Value:       u.Value,
+			Address:     address,
+			Confirmed:   u.Status.Confirmed,
+			BlockHeight: u.Status.BlockHeight,
+		})
+	}
+	return utxos, nil
+}
+
+// RawTransaction implements UTXOSource
+func (c *EsploraClient) RawTransaction(txid string) ([]byte, error) {
+	body, err := c.do(http.MethodGet, "/tx/"+txid+"/hex", nil)
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(strings.TrimSpace(string(body)))
+}
+
+// Broadcast implements UTXOSource
+func (c *EsploraClient) Broadcast(tx *wire.MsgTx) (string, error) {
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return "", fmt.Errorf("serialize transaction failed, err=%s", err)
+	}
+	body, err := c.do(http.MethodPost, "/tx", strings.NewReader(hex.EncodeToString(buf.Bytes())))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// FeeEstimates implements FeeEstimator
+func (c *EsploraClient) FeeEstimates() (map[int]float64, error) {
+	var raw map[string]float64
+	if err := c.getJSON("/fee-estimates", &raw); err != nil {
+		return nil, err
+	}
+	estimates := make(map[int]float64, len(raw))
+	for k, v := range raw {
+		target, err := strconv.Atoi(k)
+		if err != nil {
+			continue
+		}
+		estimates[target] = v
+	}
+	return estimates, nil
+}
+
+// TipHeight returns the height of the best block
+func (c *EsploraClient) TipHeight() (int64, error) {
+	body, err := c.do(http.MethodGet, "/blocks/tip/height", nil)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(body)), 10, 64)
+}
+
+func (c *EsploraClient) getJSON(path string, v interface{}) error {
+	body, err := c.do(http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("decode %s failed, err=%s", path, err)
+	}
+	return nil
+}
+
+func (c *EsploraClient) do(method, path string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "text/plain")
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request %s failed, err=%s", path, err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read %s failed, err=%s", path, err)
+	}
+	if res.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("request %s failed, status=%d, body=%s", path, res.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// FeeRate returns the rate in sat/vB for confirmation within target blocks
+// the estimate of the smallest target not below the requested one is used, the rate is at least 1 sat/vB
+func FeeRate(estimator FeeEstimator, target int) (int64, error) {
+	estimates, err := estimator.FeeEstimates()
+	if err != nil {
+		return 0, fmt.Errorf("get fee estimates failed, err=%s", err)
+	}
+	if len(estimates) == 0 {
+		return 0, fmt.Errorf("no fee estimates")
+	}
+	targets := make([]int, 0, len(estimates))
+	for t := range estimates {
+		targets = append(targets, t)
+	}
+	sort.Ints(targets)
+	chosen := targets[len(targets)-1]
+	for _, t := range targets {
+		if t >= target {
+			chosen = t
+			break
+		}
+	}
+	rate := int64(estimates[chosen] + 0.999)
+	if rate < 1 {
+		rate = 1
+	}
+	return rate, nil
+}
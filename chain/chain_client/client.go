@@ -40,6 +40,8 @@ type TransactionInfo struct {
 	Status    uint64
 	Gas       *TxGasInfo
 	Error     string
+	// BlockNumber is the block the transaction was mined in, nil while pending
+	BlockNumber *big.Int
 }
 
 const (
@@ -133,6 +135,8 @@ type BlockChainClient interface {
 	GetGasPrice() (*big.Int, *big.Int, error)
 
 	// GetSuggestGasPrice returns the suggest gas price for a transaction && return the latest block's base fee
+	// the values are (gasTipCap, baseFee, gasPrice), platforms without EIP-1559 return 0 for gasTipCap and baseFee
+	// use feeoracle for FeeLimit presets with estimated gas
 	GetSuggestGasPrice() (*big.Int, *big.Int, *big.Int, error)
 
 	// DeployContract generates the transaction data to deploy a contract
@@ -0,0 +1,251 @@
+package feeoracle
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/h8848/blockchain-infra/chain/chain_client"
+)
+
+const (
+	defaultBlocks    = 20
+	defaultGasMargin = 20
+)
+
+// Speed selects how fast a transaction should be included
+type Speed int
+
+const (
+	SpeedSlow Speed = iota
+	SpeedNormal
+	SpeedFast
+)
+
+func (s Speed) String() string {
+	switch s {
+	case SpeedSlow:
+		return "slow"
+	case SpeedNormal:
+		return "normal"
+	case SpeedFast:
+		return "fast"
+	}
+	return fmt.Sprintf("speed(%d)", int(s))
+}
+
+// legacyPercent scales the node gas price for chains without EIP-1559
+var legacyPercent = [...]int64{SpeedSlow: 90, SpeedNormal: 100, SpeedFast: 125}
+
+// Backend is the node api used by the oracle, it is implemented by ethclient.Client
+type Backend interface {
+	FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error)
+	SuggestGasPrice(ctx context.Context) (*big.Int, error)
+	SuggestGasTipCap(ctx context.Context) (*big.Int, error)
+	EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error)
+}
+
+// Caps are the per chain maxima applied to every suggestion, nil or 0 means no limit
+// a suggestion whose GasFeeCap would have to exceed MaxFeeCap to cover the next base fee is an error
+type Caps struct {
+	MaxFeeCap *big.Int
+	MaxTipCap *big.Int
+	MaxGas    uint64
+}
+
+// Config is the config for the fee oracle
+// Blocks is the number of recent blocks read by eth_feeHistory, default 20
+// Percentiles are the priority fee percentiles used for slow, normal and fast, default 10, 50 and 90
+// GasMargin is the percent added to the EstimateGas result, default 20
+type Config struct {
+	Chain       *chain_client.ChainConfiguration
+	Blocks      uint64
+	Percentiles [3]float64
+	GasMargin   int64
+	Caps        Caps
+}
+
+// Presets are the suggestions for every speed
+type Presets struct {
+	Slow   *chain_client.FeeLimit
+	Normal *chain_client.FeeLimit
+	Fast   *chain_client.FeeLimit
+}
+
+// Get returns the preset of speed
+func (p *Presets) Get(speed Speed) *chain_client.FeeLimit {
+	switch speed {
+	case SpeedSlow:
+		return p.Slow
+	case SpeedFast:
+		return p.Fast
+	}
+	return p.Normal
+}
+
+// Oracle suggests fees for a single chain
+// On EIP-1559 chains the tip is the median of the per block priority fee percentile of the speed and
+// GasFeeCap is twice the next base fee plus the tip, so the transaction stays valid for several full blocks.
+// On legacy chains GasFeeCap and GasTipCap are both the gas price.
+type Oracle struct {
+	backend Backend
+	conf    Config
+}
+
+// New creates the fee oracle, conf.Chain decides whether EIP-1559 is used
+func New(backend Backend, conf *Config) *Oracle {
+	o := &Oracle{backend: backend, conf: *conf}
+	if o.conf.Chain == nil {
+		o.conf.Chain = &chain_client.ChainConfiguration{SupportEIP1559: true}
+	}
+	if o.conf.Blocks == 0 {
+		o.conf.Blocks = defaultBlocks
+	}
+	if o.conf.Percentiles == [3]float64{} {
+		o.conf.Percentiles = [3]float64{10, 50, 90}
+	}
+	if o.conf.GasMargin <= 0 {
+		o.conf.GasMargin = defaultGasMargin
+	}
+	return o
+}
+
+// SupportEIP1559 reports whether the suggestions are dynamic fee suggestions
+func (o *Oracle) SupportEIP1559() bool {
+	return o.conf.Chain.SupportEIP1559
+}
+
+// Suggest returns the fee of td for speed, Gas is estimated
+func (o *Oracle) Suggest(td *chain_client.Transaction, speed Speed) (*chain_client.FeeLimit, error) {
+	presets, err := o.Presets(td)
+	if err != nil {
+		return nil, err
+	}
+	return presets.Get(speed), nil
+}
+
+// Presets returns the fees of td for every speed, Gas is estimated once and shared
+func (o *Oracle) Presets(td *chain_client.Transaction) (*Presets, error) {
+	gas, err := o.EstimateGas(td)
+	if err != nil {
+		return nil, err
+	}
+	var prices [3]*chain_client.FeeLimit
+	if o.SupportEIP1559() {
+		prices, err = o.dynamicFees()
+	} else {
+		prices, err = o.legacyFees()
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range prices {
+		p.Gas = new(big.Int).SetUint64(gas)
+	}
+	return &Presets{Slow: prices[SpeedSlow], Normal: prices[SpeedNormal], Fast: prices[SpeedFast]}, nil
+}
+
+// EstimateGas estimates the gas limit of td and adds the safety margin
+func (o *Oracle) EstimateGas(td *chain_client.Transaction) (uint64, error) {
+	msg := ethereum.CallMsg{
+		From:  common.HexToAddress(td.From),
+		Value: td.Amount,
+		Data:  td.Data,
+	}
+	if td.To != "" {
+		to := common.HexToAddress(td.To)
+		msg.To = &to
+	}
+	gas, err := o.backend.EstimateGas(context.Background(), msg)
+	if err != nil {
+		return 0, fmt.Errorf("estimate gas failed, err=%s", err)
+	}
+	gas = gas * uint64(100+o.conf.GasMargin) / 100
+	if max := o.conf.Caps.MaxGas; max > 0 && gas > max {
+		return 0, fmt.Errorf("estimated gas=%d exceeds max=%d", gas, max)
+	}
+	return gas, nil
+}
+
+func (o *Oracle) dynamicFees() ([3]*chain_client.FeeLimit, error) {
+	var fees [3]*chain_client.FeeLimit
+	history, err := o.backend.FeeHistory(context.Background(), o.conf.Blocks, nil, o.conf.Percentiles[:])
+	if err != nil {
+		return fees, fmt.Errorf("get fee history failed, err=%s", err)
+	}
+	if len(history.BaseFee) == 0 {
+		return fees, fmt.Errorf("fee history has no base fee")
+	}
+	// the last base fee is the one of the next block
+	baseFee := history.BaseFee[len(history.BaseFee)-1]
+	for i := range fees {
+		tip := medianReward(history, i)
+		if tip == nil {
+			if tip, err = o.backend.SuggestGasTipCap(context.Background()); err != nil {
+				return fees, fmt.Errorf("suggest gas tip cap failed, err=%s", err)
+			}
+		}
+		if max := o.conf.Caps.MaxTipCap; max != nil && tip.Cmp(max) > 0 {
+			tip = new(big.Int).Set(max)
+		}
+		feeCap := new(big.Int).Add(new(big.Int).Mul(baseFee, big.NewInt(2)), tip)
+		if max := o.conf.Caps.MaxFeeCap; max != nil && feeCap.Cmp(max) > 0 {
+			if max.Cmp(baseFee) < 0 {
+				return fees, fmt.Errorf("max fee cap=%s is below base fee=%s", max, baseFee)
+			}
+			feeCap = new(big.Int).Set(max)
+		}
+		if tip.Cmp(feeCap) > 0 {
+			tip = new(big.Int).Set(feeCap)
+		}
+		fees[i] = &chain_client.FeeLimit{GasFeeCap: feeCap, GasTipCap: tip}
+	}
+	// a faster preset never pays less than a slower one
+	for i := 1; i < len(fees); i++ {
+		if fees[i].GasTipCap.Cmp(fees[i-1].GasTipCap) < 0 {
+			fees[i].GasTipCap = new(big.Int).Set(fees[i-1].GasTipCap)
+		}
+		if fees[i].GasFeeCap.Cmp(fees[i-1].GasFeeCap) < 0 {
+			fees[i].GasFeeCap = new(big.Int).Set(fees[i-1].GasFeeCap)
+		}
+	}
+	return fees, nil
+}
+
+// medianReward is the median of the i-th percentile over the blocks that had transactions
+func medianReward(history *ethereum.FeeHistory, i int) *big.Int {
+	var samples []*big.Int
+	for b, rewards := range history.Reward {
+		if b < len(history.GasUsedRatio) && history.GasUsedRatio[b] == 0 {
+			continue
+		}
+		if i < len(rewards) && rewards[i] != nil {
+			samples = append(samples, rewards[i])
+		}
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+	sort.Slice(samples, func(a, b int) bool { return samples[a].Cmp(samples[b]) < 0 })
+	return new(big.Int).Set(samples[len(samples)/2])
+}
+
+func (o *Oracle) legacyFees() ([3]*chain_client.FeeLimit, error) {
+	var fees [3]*chain_client.FeeLimit
+	gasPrice, err := o.backend.SuggestGasPrice(context.Background())
+	if err != nil {
+		return fees, fmt.Errorf("suggest gas price failed, err=%s", err)
+	}
+	for i := range fees {
+		price := new(big.Int).Mul(gasPrice, big.NewInt(legacyPercent[i]))
+		price.Div(price, big.NewInt(100))
+		if max := o.conf.Caps.MaxFeeCap; max != nil && price.Cmp(max) > 0 {
+			price = new(big.Int).Set(max)
+		}
+		fees[i] = &chain_client.FeeLimit{GasFeeCap: price, GasTipCap: new(big.Int).Set(price)}
+	}
+	return fees, nil
+}
@@ -0,0 +1,71 @@
+package feeoracle
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/h8848/blockchain-infra/chain/chain_client"
+)
+
+type fakeBackend struct {
+	history  *ethereum.FeeHistory
+	gasPrice int64
+	gas      uint64
+}
+
+func (f *fakeBackend) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error) {
+	return f.history, nil
+}
+
+func (f *fakeBackend) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(f.gasPrice), nil
+}
+
+func (f *fakeBackend) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(1), nil
+}
+
+func (f *fakeBackend) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error) {
+	return f.gas, nil
+}
+
+func rewards(v ...int64) []*big.Int {
+	list := make([]*big.Int, len(v))
+	for i, n := range v {
+		list[i] = big.NewInt(n)
+	}
+	return list
+}
+
+func TestPresets(t *testing.T) {
+	backend := &fakeBackend{gas: 50000, history: &ethereum.FeeHistory{
+		Reward:       [][]*big.Int{rewards(1, 2, 5), rewards(0, 0, 0), rewards(3, 4, 9), rewards(2, 3, 7)},
+		BaseFee:      rewards(90, 95, 100, 100, 110),
+		GasUsedRatio: []float64{0.5, 0, 0.9, 0.7},
+	}}
+	oracle := New(backend, &Config{Caps: Caps{MaxFeeCap: big.NewInt(225)}})
+	presets, err := oracle.Presets(&chain_client.Transaction{From: "0x01", To: "0x02"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the empty block is skipped, medians are 2, 3 and 7 over the next base fee 110
+	check := func(name string, fee *chain_client.FeeLimit, feeCap, tip int64) {
+		if fee.GasFeeCap.Int64() != feeCap || fee.GasTipCap.Int64() != tip || fee.Gas.Uint64() != 60000 {
+			t.Fatalf("%s: cap=%s tip=%s gas=%s", name, fee.GasFeeCap, fee.GasTipCap, fee.Gas)
+		}
+	}
+	check("slow", presets.Slow, 222, 2)
+	check("normal", presets.Normal, 223, 3)
+	check("fast", presets.Fast, 225, 7)
+
+	legacy := New(&fakeBackend{gas: 21000, gasPrice: 100}, &Config{Chain: &chain_client.ChainConfiguration{}})
+	fee, err := legacy.Suggest(&chain_client.Transaction{From: "0x01", To: "0x02"}, SpeedFast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fee.GasFeeCap.Int64() != 125 || fee.GasTipCap.Int64() != 125 {
+		t.Fatalf("legacy: cap=%s tip=%s", fee.GasFeeCap, fee.GasTipCap)
+	}
+}
@@ -0,0 +1,357 @@
+package nonce
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const defaultDropTimeout = 5 * time.Minute
+
+// Reader reads account nonces from a node, it is implemented by chain_client.BlockChainClient
+// GetNonce returns the pending nonce, GetNonceByNumber with a nil block returns the latest mined nonce
+type Reader interface {
+	GetNonce(address string) (uint64, error)
+	GetNonceByNumber(address string, blockNumber *big.Int) (uint64, error)
+}
+
+// EthReader adapts ethclient.Client to Reader
+type EthReader struct {
+	Client *ethclient.Client
+}
+
+func (r *EthReader) GetNonce(address string) (uint64, error) {
+	return r.Client.PendingNonceAt(context.Background(), common.HexToAddress(address))
+}
+
+func (r *EthReader) GetNonceByNumber(address string, blockNumber *big.Int) (uint64, error) {
+	return r.Client.NonceAt(context.Background(), common.HexToAddress(address), blockNumber)
+}
+
+// Key identifies a sender on a chain
+type Key struct {
+	ChainID string
+	Address string
+}
+
+func (k Key) String() string {
+	return k.ChainID + ":" + k.Address
+}
+
+// Sent is a nonce that has been used by a broadcast transaction
+type Sent struct {
+	Nonce  uint64
+	TxHash string
+	SentAt time.Time
+}
+
+// State is the persisted nonce state of a sender
+// Next is the next never used nonce, Gaps are nonces below Next that must be used again
+// because their transaction failed to broadcast or was dropped from the mempool
+type State struct {
+	Next uint64
+	Gaps []uint64
+	Sent []Sent
+}
+
+// Store persists the nonce state, Load returns nil without error for unknown keys
+type Store interface {
+	Load(key Key) (*State, error)
+	Save(key Key, st *State) error
+}
+
+// Config is the config for the nonce manager
+// DropTimeout is how long a sent transaction may be missing from the node before its nonce is treated as a gap
+type Config struct {
+	Store       Store
+	DropTimeout time.Duration
+}
+
+type account struct {
+	mu       sync.Mutex
+	loaded   bool
+	state    State
+	reserved map[uint64]struct{}
+	// unknown records when a nonce below Next was first seen neither sent nor reserved,
+	// which happens when the process stopped between Reserve and Commit
+	unknown map[uint64]time.Time
+}
+
+// Manager hands out nonces for concurrent senders
+// Nonces are given locally in sequence, gaps are always handed out first so a stuck nonce is filled
+// before new ones are used. Reconcile compares the local state with the node.
+type Manager struct {
+	store       Store
+	dropTimeout time.Duration
+
+	mu       sync.Mutex
+	readers  map[string]Reader
+	accounts map[Key]*account
+	now      func() time.Time
+}
+
+// NewManager creates the nonce manager, a nil store keeps the state in memory only
+func NewManager(conf *Config) *Manager {
+	if conf == nil {
+		conf = &Config{}
+	}
+	m := &Manager{
+		store:       conf.Store,
+		dropTimeout: conf.DropTimeout,
+		readers:     make(map[string]Reader),
+		accounts:    make(map[Key]*account),
+		now:         time.Now,
+	}
+	if m.store == nil {
+		m.store = NewMemoryStore()
+	}
+	if m.dropTimeout <= 0 {
+		m.dropTimeout = defaultDropTimeout
+	}
+	return m
+}
+
+// AddChain registers the node reader of a chain
+func (m *Manager) AddChain(chainID string, reader Reader) {
+	m.mu.Lock()
+	m.readers[chainID] = reader
+	m.mu.Unlock()
+}
+
+func (m *Manager) reader(chainID string) (Reader, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.readers[chainID]
+	if !ok {
+		return nil, fmt.Errorf("chain=%s not registered", chainID)
+	}
+	return r, nil
+}
+
+func (m *Manager) account(key Key) *account {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.accounts[key]
+	if !ok {
+		a = &account{reserved: make(map[uint64]struct{}), unknown: make(map[uint64]time.Time)}
+		m.accounts[key] = a
+	}
+	return a
+}
+
+func newKey(chainID, address string) Key {
+	return Key{ChainID: chainID, Address: strings.ToLower(address)}
+}
+
+// Reservation is a nonce handed out to a sender
+// exactly one of Commit or Release must be called after the broadcast
+type Reservation struct {
+	Nonce uint64
+
+	m    *Manager
+	key  Key
+	done bool
+}
+
+// Reserve hands out the next nonce for address on chain
+func (m *Manager) Reserve(chainID, address string) (*Reservation, error) {
+	key := newKey(chainID, address)
+	a := m.account(key)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := m.ensureLoaded(key, a); err != nil {
+		return nil, err
+	}
+	next, gaps := a.state.Next, a.state.Gaps
+	var n uint64
+	if len(a.state.Gaps) > 0 {
+		n = a.state.Gaps[0]
+		a.state.Gaps = a.state.Gaps[1:]
+	} else {
+		n = a.state.Next
+		a.state.Next++
+	}
+	if err := m.store.Save(key, &a.state); err != nil {
+		a.state.Next, a.state.Gaps = next, gaps
+		return nil, fmt.Errorf("save nonce state failed, err=%s", err)
+	}
+	a.reserved[n] = struct{}{}
+	return &Reservation{Nonce: n, m: m, key: key}, nil
+}
+
+// Commit records that the transaction using the nonce was broadcast
+func (r *Reservation) Commit(txHash string) error {
+	if r.done {
+		return fmt.Errorf("nonce=%d already committed or released", r.Nonce)
+	}
+	r.done = true
+	a := r.m.account(r.key)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.reserved, r.Nonce)
+	a.state.Sent = append(a.state.Sent, Sent{Nonce: r.Nonce, TxHash: txHash, SentAt: r.m.now()})
+	return r.m.store.Save(r.key, &a.state)
+}
+
+// Release returns the nonce when the transaction could not be broadcast, it will be handed out again
+func (r *Reservation) Release() error {
+	if r.done {
+		return nil
+	}
+	r.done = true
+	a := r.m.account(r.key)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.reserved, r.Nonce)
+	a.addGap(r.Nonce)
+	a.shrink()
+	return r.m.store.Save(r.key, &a.state)
+}
+
+// Gaps returns the nonces that are waiting to be reused
+func (m *Manager) Gaps(chainID, address string) []uint64 {
+	key := newKey(chainID, address)
+	a := m.account(key)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]uint64(nil), a.state.Gaps...)
+}
+
+// Reconcile compares the local state with the node:
+// mined nonces are forgotten, sent nonces the node does not know about after DropTimeout become gaps,
+// nonces that were handed out but never committed or released also become gaps after DropTimeout,
+// and the local counter moves forward if the account was used by another sender
+func (m *Manager) Reconcile(chainID, address string) error {
+	key := newKey(chainID, address)
+	a := m.account(key)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := m.ensureLoaded(key, a); err != nil {
+		return err
+	}
+	reader, err := m.reader(chainID)
+	if err != nil {
+		return err
+	}
+	latest, err := reader.GetNonceByNumber(address, nil)
+	if err != nil {
+		return fmt.Errorf("get latest nonce failed, err=%s", err)
+	}
+	pending, err := reader.GetNonce(address)
+	if err != nil {
+		return fmt.Errorf("get pending nonce failed, err=%s", err)
+	}
+	m.reconcile(a, latest, pending)
+	return m.store.Save(key, &a.state)
+}
+
+func (m *Manager) reconcile(a *account, latest, pending uint64) {
+	if pending < latest {
+		pending = latest
+	}
+	// the node saw nonces we never handed out
+	if pending > a.state.Next {
+		a.state.Next = pending
+	}
+
+	gaps := a.state.Gaps[:0]
+	for _, n := range a.state.Gaps {
+		if n >= latest {
+			gaps = append(gaps, n)
+		}
+	}
+	a.state.Gaps = gaps
+
+	sent := a.state.Sent[:0]
+	for _, s := range a.state.Sent {
+		switch {
+		case s.Nonce < latest:
+			// mined
+		case s.Nonce >= pending && m.now().Sub(s.SentAt) > m.dropTimeout:
+			a.addGap(s.Nonce)
+		default:
+			sent = append(sent, s)
+		}
+	}
+	a.state.Sent = sent
+
+	// nonces below Next the node has not seen and nobody holds, e.g. reserved before a restart
+	known := make(map[uint64]bool, len(a.state.Sent)+len(a.state.Gaps))
+	for _, s := range a.state.Sent {
+		known[s.Nonce] = true
+	}
+	for _, g := range a.state.Gaps {
+		known[g] = true
+	}
+	unknown := make(map[uint64]time.Time)
+	for n := pending; n < a.state.Next; n++ {
+		if _, ok := a.reserved[n]; ok || known[n] {
+			continue
+		}
+		since, ok := a.unknown[n]
+		if !ok {
+			since = m.now()
+		}
+		if m.now().Sub(since) > m.dropTimeout {
+			a.addGap(n)
+			continue
+		}
+		unknown[n] = since
+	}
+	a.unknown = unknown
+	a.shrink()
+}
+
+func (m *Manager) ensureLoaded(key Key, a *account) error {
+	if a.loaded {
+		return nil
+	}
+	st, err := m.store.Load(key)
+	if err != nil {
+		return fmt.Errorf("load nonce state failed, err=%s", err)
+	}
+	if st != nil {
+		a.state = *st
+	}
+	reader, err := m.reader(key.ChainID)
+	if err != nil {
+		return err
+	}
+	pending, err := reader.GetNonce(key.Address)
+	if err != nil {
+		return fmt.Errorf("get pending nonce failed, err=%s", err)
+	}
+	// never go below what was persisted, so a restart does not reuse nonces
+	if pending > a.state.Next {
+		a.state.Next = pending
+	}
+	a.loaded = true
+	return nil
+}
+
+func (a *account) addGap(n uint64) {
+	for _, g := range a.state.Gaps {
+		if g == n {
+			return
+		}
+	}
+	a.state.Gaps = append(a.state.Gaps, n)
+	sort.Slice(a.state.Gaps, func(i, j int) bool { return a.state.Gaps[i] < a.state.Gaps[j] })
+}
+
+// shrink turns trailing gaps back into unused nonces
+func (a *account) shrink() {
+	for len(a.state.Gaps) > 0 && a.state.Gaps[len(a.state.Gaps)-1] == a.state.Next-1 {
+		a.state.Gaps = a.state.Gaps[:len(a.state.Gaps)-1]
+		a.state.Next--
+	}
+}
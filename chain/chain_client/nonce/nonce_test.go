@@ -0,0 +1,133 @@
+package nonce
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+)
+
+type fakeReader struct {
+	latest, pending uint64
+}
+
+func (f *fakeReader) GetNonce(string) (uint64, error) { return f.pending, nil }
+
+func (f *fakeReader) GetNonceByNumber(string, *big.Int) (uint64, error) { return f.latest, nil }
+
+func TestManagerGapsAndRestart(t *testing.T) {
+	store := NewMemoryStore()
+	node := &fakeReader{latest: 5, pending: 5}
+	m := NewManager(&Config{Store: store, DropTimeout: time.Minute})
+	m.AddChain("1", node)
+
+	var rs []*Reservation
+	for i := 0; i < 3; i++ {
+		r, err := m.Reserve("1", "0xAbC")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Nonce != uint64(5+i) {
+			t.Fatalf("nonce=%d, want %d", r.Nonce, 5+i)
+		}
+		rs = append(rs, r)
+	}
+	// 5 and 7 broadcast, 6 failed
+	_ = rs[0].Commit("0x5")
+	_ = rs[1].Release()
+	_ = rs[2].Commit("0x7")
+	if gaps := m.Gaps("1", "0xabc"); len(gaps) != 1 || gaps[0] != 6 {
+		t.Fatalf("gaps=%v", gaps)
+	}
+	r, _ := m.Reserve("1", "0xabc")
+	if r.Nonce != 6 {
+		t.Fatalf("gap not refilled, nonce=%d", r.Nonce)
+	}
+	_ = r.Commit("0x6")
+
+	// restart: the node has only seen nonce 5, the manager must not go back
+	m2 := NewManager(&Config{Store: store, DropTimeout: time.Minute})
+	m2.AddChain("1", node)
+	r, _ = m2.Reserve("1", "0xabc")
+	if r.Nonce != 8 {
+		t.Fatalf("nonce after restart=%d, want 8", r.Nonce)
+	}
+	_ = r.Release()
+
+	// 6 and 7 were dropped by the node, they are refilled once the drop timeout passed
+	node.latest, node.pending = 6, 6
+	m2.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if err := m2.Reconcile("1", "0xabc"); err != nil {
+		t.Fatal(err)
+	}
+	r, _ = m2.Reserve("1", "0xabc")
+	if r.Nonce != 6 {
+		t.Fatalf("nonce after drop=%d, want 6", r.Nonce)
+	}
+}
+
+type failingStore struct {
+	*MemoryStore
+	fail bool
+}
+
+func (s *failingStore) Save(key Key, st *State) error {
+	if s.fail {
+		return fmt.Errorf("database is down")
+	}
+	return s.MemoryStore.Save(key, st)
+}
+
+func TestReserveSaveFailed(t *testing.T) {
+	store := &failingStore{MemoryStore: NewMemoryStore()}
+	m := NewManager(&Config{Store: store})
+	m.AddChain("1", &fakeReader{latest: 5, pending: 5})
+
+	r, _ := m.Reserve("1", "0xabc")
+	_ = r.Release()
+	if gaps := m.Gaps("1", "0xabc"); len(gaps) != 0 {
+		t.Fatalf("gaps=%v", gaps)
+	}
+	store.fail = true
+	if _, err := m.Reserve("1", "0xabc"); err == nil {
+		t.Fatal("reserve succeeded without saving")
+	}
+	store.fail = false
+	r, err := m.Reserve("1", "0xabc")
+	if err != nil || r.Nonce != 5 {
+		t.Fatalf("nonce=%d, err=%v", r.Nonce, err)
+	}
+}
+
+func TestReconcileUncommitted(t *testing.T) {
+	store := NewMemoryStore()
+	node := &fakeReader{latest: 5, pending: 5}
+	now := time.Now()
+	m := NewManager(&Config{Store: store, DropTimeout: time.Minute})
+	m.AddChain("1", node)
+	// 7 is sent late, 5 and 6 are reserved but the process stops before they are committed
+	m.now = func() time.Time { return now.Add(2 * time.Minute) }
+	for i := 0; i < 3; i++ {
+		r, _ := m.Reserve("1", "0xabc")
+		if r.Nonce == 7 {
+			_ = r.Commit("0x7")
+		}
+	}
+
+	m2 := NewManager(&Config{Store: store, DropTimeout: time.Minute})
+	m2.AddChain("1", node)
+	m2.now = func() time.Time { return now }
+	if err := m2.Reconcile("1", "0xabc"); err != nil {
+		t.Fatal(err)
+	}
+	if gaps := m2.Gaps("1", "0xabc"); len(gaps) != 0 {
+		t.Fatalf("gaps before drop timeout=%v", gaps)
+	}
+	now = now.Add(2 * time.Minute)
+	if err := m2.Reconcile("1", "0xabc"); err != nil {
+		t.Fatal(err)
+	}
+	if gaps := m2.Gaps("1", "0xabc"); len(gaps) != 2 || gaps[0] != 5 || gaps[1] != 6 {
+		t.Fatalf("gaps=%v", gaps)
+	}
+}
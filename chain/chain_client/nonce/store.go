@@ -0,0 +1,120 @@
+package nonce
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/h8848/blockchain-infra/pkg/xgorm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MemoryStore keeps the state in process, it is the default store of the manager
+type MemoryStore struct {
+	mu     sync.Mutex
+	states map[Key]State
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{states: make(map[Key]State)}
+}
+
+func (s *MemoryStore) Load(key Key) (*State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.states[key]
+	if !ok {
+		return nil, nil
+	}
+	return st.clone(), nil
+}
+
+func (s *MemoryStore) Save(key Key, st *State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[key] = *st.clone()
+	return nil
+}
+
+func (st *State) clone() *State {
+	return &State{
+		Next: st.Next,
+		Gaps: append([]uint64(nil), st.Gaps...),
+		Sent: append([]Sent(nil), st.Sent...),
+	}
+}
+
+// NonceStateModel is the table used by GormStore
+type NonceStateModel struct {
+	xgorm.BaseModel
+	ChainID string `gorm:"column:chain_id;type:varchar(32);not null;uniqueIndex:uk_chain_address;comment:链ID"`
+	Address string `gorm:"column:address;type:varchar(128);not null;uniqueIndex:uk_chain_address;comment:发送地址"`
+	Next    uint64 `gorm:"column:next_nonce;not null;default:0;comment:下一个nonce"`
+	Gaps    string `gorm:"column:gaps;type:text;comment:待补nonce"`
+	Sent    string `gorm:"column:sent;type:text;comment:已发送nonce"`
+}
+
+func (NonceStateModel) TableName() string {
+	return "nonce_state"
+}
+
+// GormStore is a Store backed by xgorm
+type GormStore struct {
+	db *gorm.DB
+}
+
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// AutoMigrate creates or updates the nonce_state table
+func (g *GormStore) AutoMigrate() error {
+	return xgorm.Primary(g.db).AutoMigrate(&NonceStateModel{})
+}
+
+func (g *GormStore) Load(key Key) (*State, error) {
+	var m NonceStateModel
+	// 从库延迟会读到旧的 Next，导致重复使用nonce
+	err := xgorm.Primary(g.db).Where("chain_id = ? AND address = ?", key.ChainID, key.Address).Take(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	st := State{Next: m.Next}
+	if m.Gaps != "" {
+		if err := json.Unmarshal([]byte(m.Gaps), &st.Gaps); err != nil {
+			return nil, err
+		}
+	}
+	if m.Sent != "" {
+		if err := json.Unmarshal([]byte(m.Sent), &st.Sent); err != nil {
+			return nil, err
+		}
+	}
+	return &st, nil
+}
+
+func (g *GormStore) Save(key Key, st *State) error {
+	gaps, err := json.Marshal(st.Gaps)
+	if err != nil {
+		return err
+	}
+	sent, err := json.Marshal(st.Sent)
+	if err != nil {
+		return err
+	}
+	m := NonceStateModel{
+		ChainID: key.ChainID,
+		Address: key.Address,
+		Next:    st.Next,
+		Gaps:    string(gaps),
+		Sent:    string(sent),
+	}
+	return g.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chain_id"}, {Name: "address"}},
+		DoUpdates: clause.AssignmentColumns([]string{"next_nonce", "gaps", "sent", "updated_at"}),
+	}).Create(&m).Error
+}
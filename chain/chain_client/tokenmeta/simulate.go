@@ -0,0 +1,200 @@
+package tokenmeta
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethclient/gethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// SimulationResult is the balance change observed during a simulated transfer
+type SimulationResult struct {
+	// Debited is how much the sender balance decreased
+	Debited *big.Int
+	// Credited is how much the receiver balance increased
+	Credited *big.Int
+}
+
+// Behavior classifies the token by comparing the balance changes with the transfer amount
+// a fee may be taken from the receiver's credit or charged to the sender on top of the amount
+func (r *SimulationResult) Behavior(amount *big.Int) TokenBehavior {
+	if r.Debited.Cmp(amount) == 0 && r.Credited.Cmp(amount) == 0 {
+		return BehaviorStandard
+	}
+	if r.Debited.Cmp(amount) >= 0 && r.Credited.Cmp(amount) <= 0 {
+		return BehaviorFeeOnTransfer
+	}
+	return BehaviorRebasing
+}
+
+// TransferSimulator executes a token transfer without broadcasting it
+type TransferSimulator interface {
+	SimulateTransfer(contract, holder string, amount *big.Int) (*SimulationResult, error)
+}
+
+// ProbeReceiver is the address that receives the simulated transfer
+var ProbeReceiver = common.HexToAddress("0x00000000000000000000000000000000000Be1e5")
+
+// EVMTransferSimulator simulates transfers with eth_call and a state override.
+// The holder's code is replaced by a probe which reads both balances, calls transfer and reads them again,
+// so the node must support the state override parameter of eth_call.
+type EVMTransferSimulator struct {
+	client *gethclient.Client
+}
+
+// NewEVMTransferSimulator creates the simulator over a rpc connection
+func NewEVMTransferSimulator(client *rpc.Client) *EVMTransferSimulator {
+	return &EVMTransferSimulator{client: gethclient.New(client)}
+}
+
+// SimulateTransfer implements TransferSimulator
+func (s *EVMTransferSimulator) SimulateTransfer(contract, holder string, amount *big.Int) (*SimulationResult, error) {
+	if !common.IsHexAddress(contract) || !common.IsHexAddress(holder) {
+		return nil, fmt.Errorf("invalid address, contract=%s, holder=%s", contract, holder)
+	}
+	holderAddr := common.HexToAddress(holder)
+	overrides := map[common.Address]gethclient.OverrideAccount{
+		holderAddr: {Code: probeCode},
+	}
+	msg := ethereum.CallMsg{
+		To:   &holderAddr,
+		Data: ProbeCallData(common.HexToAddress(contract), ProbeReceiver, amount),
+	}
+	result, err := s.client.CallContract(context.Background(), msg, nil, &overrides)
+	if err != nil {
+		return nil, fmt.Errorf("eth_call failed, err=%s", err)
+	}
+	return ParseProbeResult(result)
+}
+
+// ProbeCallData is the input of the probe: token, receiver and amount as 32 byte words
+func ProbeCallData(token, receiver common.Address, amount *big.Int) []byte {
+	data := make([]byte, 0, 96)
+	data = append(data, common.LeftPadBytes(token.Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(receiver.Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(amount.Bytes(), 32)...)
+	return data
+}
+
+// ParseProbeResult decodes the five words returned by the probe:
+// transfer success, sender and receiver balances before, sender and receiver balances after
+// a transfer that returned false or did not debit the sender is a failed probe
+func ParseProbeResult(data []byte) (*SimulationResult, error) {
+	if len(data) != 5*32 {
+		return nil, fmt.Errorf("unexpected probe result length=%d", len(data))
+	}
+	word := func(i int) *big.Int {
+		return new(big.Int).SetBytes(data[i*32 : (i+1)*32])
+	}
+	if word(0).Sign() == 0 {
+		return nil, fmt.Errorf("transfer reverted or returned false")
+	}
+	senderBefore, receiverBefore, senderAfter, receiverAfter := word(1), word(2), word(3), word(4)
+	result := &SimulationResult{
+		Debited:  new(big.Int).Sub(senderBefore, senderAfter),
+		Credited: new(big.Int).Sub(receiverAfter, receiverBefore),
+	}
+	if result.Debited.Sign() <= 0 {
+		return nil, fmt.Errorf("transfer did not debit the sender, debited=%s", result.Debited)
+	}
+	return result, nil
+}
+
+// probeTransferRet is the memory slot of the transfer return value, it stays zero when nothing is returned
+const probeTransferRet = 0xe0
+
+// memory slots of the probe results
+const (
+	probeOutOK = 0x100 + iota*0x20
+	probeOutSenderBefore
+	probeOutReceiverBefore
+	probeOutSenderAfter
+	probeOutReceiverAfter
+)
+
+// probeCode is the runtime code placed on the holder, it has no jumps so it can be read top down
+var probeCode = func() []byte {
+	var code []byte
+	op := func(ops ...vm.OpCode) {
+		for _, o := range ops {
+			code = append(code, byte(o))
+		}
+	}
+	push := func(v ...byte) {
+		code = append(code, byte(vm.PUSH1)+byte(len(v)-1))
+		code = append(code, v...)
+	}
+	push16 := func(v int) {
+		push(byte(v>>8), byte(v))
+	}
+	selector := func(sel ...byte) {
+		// mstore(0, sel << 224)
+		push(sel...)
+		push(0xe0)
+		op(vm.SHL)
+		push(0x00)
+		op(vm.MSTORE)
+	}
+	token := func() {
+		push(0x00)
+		op(vm.CALLDATALOAD)
+	}
+	receiver := func() {
+		push(0x20)
+		op(vm.CALLDATALOAD)
+	}
+	balanceOf := func(account func(), out int) {
+		selector(0x70, 0xa0, 0x82, 0x31)
+		account()
+		push(0x04)
+		op(vm.MSTORE)
+		// staticcall(gas, token, 0, 0x24, out, 0x20)
+		push(0x20)
+		push16(out)
+		push(0x24)
+		push(0x00)
+		token()
+		op(vm.GAS, vm.STATICCALL, vm.POP)
+	}
+	sender := func() { op(vm.ADDRESS) }
+
+	balanceOf(sender, probeOutSenderBefore)
+	balanceOf(receiver, probeOutReceiverBefore)
+
+	// transfer(receiver, amount), USDT style tokens return nothing, others must return true
+	selector(0xa9, 0x05, 0x9c, 0xbb)
+	receiver()
+	push(0x04)
+	op(vm.MSTORE)
+	push(0x40)
+	op(vm.CALLDATALOAD)
+	push(0x24)
+	op(vm.MSTORE)
+	// ok = call(gas, token, 0, 0, 0x44, ret, 0x20) && (returndatasize() == 0 || mload(ret) != 0)
+	push(0x20)
+	push16(probeTransferRet)
+	push(0x44)
+	push(0x00)
+	push(0x00)
+	token()
+	op(vm.GAS, vm.CALL)
+	op(vm.RETURNDATASIZE, vm.ISZERO)
+	push16(probeTransferRet)
+	op(vm.MLOAD, vm.ISZERO, vm.ISZERO, vm.OR, vm.AND)
+	push16(probeOutOK)
+	op(vm.MSTORE)
+
+	balanceOf(sender, probeOutSenderAfter)
+	balanceOf(receiver, probeOutReceiverAfter)
+
+	// return(0x100, 0xa0)
+	push(0xa0)
+	push16(probeOutOK)
+	op(vm.RETURN)
+	return code
+}()
@@ -0,0 +1,77 @@
+package tokenmeta
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+	"github.com/h8848/blockchain-infra/chain/ethereum/eth_abi"
+)
+
+func TestProbeStandardToken(t *testing.T) {
+	holder := common.HexToAddress("0x00000000000000000000000000000000000a11ce")
+	cfg := &runtime.Config{Origin: holder}
+
+	// Erc20Token mints 10000 tokens to the deployer
+	_, token, _, err := runtime.Create(common.FromHex(eth_abi.Erc20TokenBin), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statedb := cfg.State
+	statedb.SetCode(holder, probeCode)
+
+	amount := big.NewInt(1_000_000)
+	ret, _, err := runtime.Call(holder, ProbeCallData(token, ProbeReceiver, amount), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := ParseProbeResult(ret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Debited.Cmp(amount) != 0 || result.Credited.Cmp(amount) != 0 {
+		t.Fatalf("debited=%s credited=%s, want %s", result.Debited, result.Credited, amount)
+	}
+	if b := result.Behavior(amount); b != BehaviorStandard {
+		t.Fatalf("behavior=%s", b)
+	}
+
+	fee := &SimulationResult{Debited: amount, Credited: big.NewInt(990_000)}
+	if b := fee.Behavior(amount); b != BehaviorFeeOnTransfer {
+		t.Fatalf("behavior=%s", b)
+	}
+	senderFee := &SimulationResult{Debited: big.NewInt(1_010_000), Credited: amount}
+	if b := senderFee.Behavior(amount); b != BehaviorFeeOnTransfer {
+		t.Fatalf("sender fee behavior=%s", b)
+	}
+
+	// a token answering every call with false, and one that accepts the call but moves nothing
+	for name, code := range map[string][]byte{
+		"returns false": {0x60, 0x20, 0x60, 0x00, 0xf3},
+		"no debit":      {0x00},
+	} {
+		statedb.SetCode(token, code)
+		ret, _, err := runtime.Call(holder, ProbeCallData(token, ProbeReceiver, amount), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result, err := ParseProbeResult(ret); err == nil {
+			t.Fatalf("%s: probe succeeded, result=%+v", name, result)
+		}
+	}
+}
+
+func TestDecodeString(t *testing.T) {
+	mkr := common.RightPadBytes([]byte("MKR"), 32)
+	if s, err := DecodeString(mkr); err != nil || s != "MKR" {
+		t.Fatalf("bytes32: %q %v", s, err)
+	}
+	encoded, err := stringArgs.Pack("Tether USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := DecodeString(encoded); err != nil || s != "Tether USD" {
+		t.Fatalf("string: %q %v", s, err)
+	}
+}
@@ -0,0 +1,93 @@
+package tokenmeta
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/h8848/blockchain-infra/pkg/xgorm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store persists token metadata, Load returns nil without error when the token is not stored
+type Store interface {
+	Load(chainID, contract string) (*TokenMetadata, error)
+	Save(meta *TokenMetadata) error
+}
+
+// TokenMetadataModel is the table used by GormStore
+type TokenMetadataModel struct {
+	xgorm.BaseModel
+	ChainID     string `gorm:"column:chain_id;type:varchar(32);not null;uniqueIndex:uk_chain_contract;comment:链ID"`
+	Contract    string `gorm:"column:contract;type:varchar(128);not null;uniqueIndex:uk_chain_contract;comment:合约地址"`
+	Name        string `gorm:"column:name;type:varchar(128);not null;default:'';comment:名称"`
+	Symbol      string `gorm:"column:symbol;type:varchar(64);not null;default:'';comment:符号"`
+	Decimals    uint8  `gorm:"column:decimals;not null;default:0;comment:精度"`
+	TotalSupply string `gorm:"column:total_supply;type:varchar(80);not null;default:'0';comment:发行总量"`
+	Behavior    string `gorm:"column:behavior;type:varchar(32);not null;default:'unknown';comment:转账行为"`
+}
+
+func (TokenMetadataModel) TableName() string {
+	return "token_metadata"
+}
+
+// GormStore is a Store backed by xgorm
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates the store, call AutoMigrate once to create the table
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// AutoMigrate creates or updates the token_metadata table
+func (g *GormStore) AutoMigrate() error {
+	return xgorm.Primary(g.db).AutoMigrate(&TokenMetadataModel{})
+}
+
+// Load implements Store
+func (g *GormStore) Load(chainID, contract string) (*TokenMetadata, error) {
+	var m TokenMetadataModel
+	err := xgorm.Primary(g.db).Where("chain_id = ? AND contract = ?", chainID, contract).Take(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	totalSupply, ok := new(big.Int).SetString(m.TotalSupply, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid total supply=%s", m.TotalSupply)
+	}
+	return &TokenMetadata{
+		ChainID:     m.ChainID,
+		Contract:    m.Contract,
+		Name:        m.Name,
+		Symbol:      m.Symbol,
+		Decimals:    m.Decimals,
+		TotalSupply: totalSupply,
+		Behavior:    TokenBehavior(m.Behavior),
+		UpdatedAt:   time.Unix(m.UpdatedAt, 0),
+	}, nil
+}
+
+// Save implements Store
+func (g *GormStore) Save(meta *TokenMetadata) error {
+	m := TokenMetadataModel{
+		ChainID:     meta.ChainID,
+		Contract:    meta.Contract,
+		Name:        meta.Name,
+		Symbol:      meta.Symbol,
+		Decimals:    meta.Decimals,
+		TotalSupply: meta.TotalSupply.String(),
+		Behavior:    string(meta.Behavior),
+	}
+	m.UpdatedAt = meta.UpdatedAt.Unix()
+	return g.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chain_id"}, {Name: "contract"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "symbol", "decimals", "total_supply", "behavior", "updated_at"}),
+	}).Create(&m).Error
+}
@@ -0,0 +1,357 @@
+package tokenmeta
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/h8848/blockchain-infra/chain/chain_client"
+	"golang.org/x/sync/singleflight"
+)
+
+const defaultTTL = 10 * time.Minute
+
+var (
+	selectorName   = []byte{0x06, 0xfd, 0xde, 0x03} // name()
+	selectorSymbol = []byte{0x95, 0xd8, 0x9b, 0x41} // symbol()
+
+	stringArgs = abi.Arguments{{Type: mustType("string")}}
+)
+
+func mustType(t string) abi.Type {
+	typ, err := abi.NewType(t, "", nil)
+	if err != nil {
+		panic(err)
+	}
+	return typ
+}
+
+// TokenBehavior describes how balances move when the token is transferred
+type TokenBehavior string
+
+const (
+	// BehaviorUnknown is used when the transfer has not been simulated
+	BehaviorUnknown TokenBehavior = "unknown"
+	// BehaviorStandard credits the receiver exactly the amount debited from the sender
+	BehaviorStandard TokenBehavior = "standard"
+	// BehaviorFeeOnTransfer credits the receiver less than the amount or debits the sender more
+	BehaviorFeeOnTransfer TokenBehavior = "fee_on_transfer"
+	// BehaviorRebasing moves balances by amounts that do not match the transfer amount,
+	// which is typical for share based tokens
+	BehaviorRebasing TokenBehavior = "rebasing"
+)
+
+// TokenMetadata is the cached information of a token contract
+type TokenMetadata struct {
+	ChainID     string
+	Contract    string
+	Name        string
+	Symbol      string
+	Decimals    uint8
+	TotalSupply *big.Int
+	Behavior    TokenBehavior
+	UpdatedAt   time.Time
+}
+
+// Config is the config for the metadata service
+// ChainID is used as part of the key when metadata is persisted
+// TTL is how long an entry is served from cache before it is reloaded from chain, default is 10 minutes
+// Store is optional, when set the metadata is persisted and loaded on cache miss
+// Simulator is optional, when set DetectBehavior can classify fee-on-transfer and rebasing tokens
+type Config struct {
+	ChainID   *big.Int
+	TTL       time.Duration
+	Store     Store
+	Simulator TransferSimulator
+}
+
+type cacheEntry struct {
+	meta     *TokenMetadata
+	expireAt time.Time
+}
+
+// Service wraps a BlockChainClient and caches token metadata
+type Service struct {
+	client  chain_client.BlockChainClient
+	chainID string
+	ttl     time.Duration
+	store   Store
+	sim     TransferSimulator
+
+	mu    sync.RWMutex
+	cache map[string]*cacheEntry
+	group singleflight.Group
+	now   func() time.Time
+}
+
+// NewService creates the metadata service
+func NewService(client chain_client.BlockChainClient, conf *Config) *Service {
+	if conf == nil {
+		conf = &Config{}
+	}
+	s := &Service{
+		client: client,
+		ttl:    conf.TTL,
+		store:  conf.Store,
+		sim:    conf.Simulator,
+		cache:  make(map[string]*cacheEntry),
+		now:    time.Now,
+	}
+	if s.ttl <= 0 {
+		s.ttl = defaultTTL
+	}
+	if conf.ChainID != nil {
+		s.chainID = conf.ChainID.String()
+	}
+	return s
+}
+
+// Metadata returns the metadata of a contract, served from cache while it is fresh
+// the result is a copy, changing it does not affect the cache
+func (s *Service) Metadata(contract string) (*TokenMetadata, error) {
+	key := s.key(contract)
+	if key == "" {
+		return nil, fmt.Errorf("invalid contract address=%s", contract)
+	}
+	if meta, ok := s.fromCache(key); ok {
+		return meta.clone(), nil
+	}
+	v, err, _ := s.group.Do(key, func() (interface{}, error) {
+		return s.load(key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*TokenMetadata).clone(), nil
+}
+
+// Decimals returns the cached decimals of a contract
+func (s *Service) Decimals(contract string) (uint8, error) {
+	meta, err := s.Metadata(contract)
+	if err != nil {
+		return 0, err
+	}
+	return meta.Decimals, nil
+}
+
+// Symbol returns the cached symbol of a contract
+func (s *Service) Symbol(contract string) (string, error) {
+	meta, err := s.Metadata(contract)
+	if err != nil {
+		return "", err
+	}
+	return meta.Symbol, nil
+}
+
+// Name returns the cached name of a contract
+func (s *Service) Name(contract string) (string, error) {
+	meta, err := s.Metadata(contract)
+	if err != nil {
+		return "", err
+	}
+	return meta.Name, nil
+}
+
+// TotalSupply returns the cached total supply of a contract
+func (s *Service) TotalSupply(contract string) (*big.Int, error) {
+	meta, err := s.Metadata(contract)
+	if err != nil {
+		return nil, err
+	}
+	return meta.TotalSupply, nil
+}
+
+// Invalidate drops a contract from the cache so the next lookup goes to chain
+func (s *Service) Invalidate(contract string) {
+	key := s.key(contract)
+	s.mu.Lock()
+	delete(s.cache, key)
+	s.mu.Unlock()
+}
+
+// DetectBehavior simulates a transfer of amount from holder and records the result in the metadata
+// holder must own at least amount of the token, a nil amount uses half of the holder's balance
+func (s *Service) DetectBehavior(contract, holder string, amount *big.Int) (TokenBehavior, error) {
+	if s.sim == nil {
+		return BehaviorUnknown, fmt.Errorf("transfer simulator is not configured")
+	}
+	meta, err := s.Metadata(contract)
+	if err != nil {
+		return BehaviorUnknown, err
+	}
+	if amount == nil {
+		balance, err := s.client.BalanceOf(meta.Contract, holder)
+		if err != nil {
+			return BehaviorUnknown, fmt.Errorf("get holder balance failed, err=%s", err)
+		}
+		amount = new(big.Int).Rsh(balance, 1)
+		if amount.Sign() == 0 {
+			amount = balance
+		}
+	}
+	if amount.Sign() <= 0 {
+		return BehaviorUnknown, fmt.Errorf("holder=%s has no balance to simulate a transfer", holder)
+	}
+	result, err := s.sim.SimulateTransfer(meta.Contract, holder, amount)
+	if err != nil {
+		return BehaviorUnknown, fmt.Errorf("simulate transfer failed, err=%s", err)
+	}
+	behavior := result.Behavior(amount)
+
+	updated := *meta
+	updated.Behavior = behavior
+	updated.UpdatedAt = s.now()
+	if s.store != nil {
+		if err := s.store.Save(&updated); err != nil {
+			return behavior, fmt.Errorf("save metadata failed, err=%s", err)
+		}
+	}
+	s.put(s.key(meta.Contract), &updated)
+	return behavior, nil
+}
+
+func (m *TokenMetadata) clone() *TokenMetadata {
+	c := *m
+	if m.TotalSupply != nil {
+		c.TotalSupply = new(big.Int).Set(m.TotalSupply)
+	}
+	return &c
+}
+
+func (s *Service) key(contract string) string {
+	return s.client.NormalizeAddress(contract)
+}
+
+func (s *Service) fromCache(key string) (*TokenMetadata, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.cache[key]
+	if !ok || s.now().After(entry.expireAt) {
+		return nil, false
+	}
+	return entry.meta, true
+}
+
+func (s *Service) put(key string, meta *TokenMetadata) {
+	s.mu.Lock()
+	s.cache[key] = &cacheEntry{meta: meta, expireAt: meta.UpdatedAt.Add(s.ttl)}
+	s.mu.Unlock()
+}
+
+func (s *Service) load(contract string) (*TokenMetadata, error) {
+	previous, _ := s.cached(contract)
+	if s.store != nil {
+		stored, err := s.store.Load(s.chainID, contract)
+		if err != nil {
+			return nil, fmt.Errorf("load metadata failed, err=%s", err)
+		}
+		if stored != nil && s.now().Before(stored.UpdatedAt.Add(s.ttl)) {
+			s.put(contract, stored)
+			return stored, nil
+		}
+		if stored != nil {
+			previous = stored
+		}
+	}
+
+	meta, err := s.fetch(contract)
+	if err != nil {
+		return nil, err
+	}
+	// the transfer behavior does not change with a refresh, keep the last detection
+	if previous != nil {
+		meta.Behavior = previous.Behavior
+	}
+	if s.store != nil {
+		if err := s.store.Save(meta); err != nil {
+			return nil, fmt.Errorf("save metadata failed, err=%s", err)
+		}
+	}
+	s.put(contract, meta)
+	return meta, nil
+}
+
+func (s *Service) fetch(contract string) (*TokenMetadata, error) {
+	decimals, err := s.client.DecimalsOf(contract)
+	if err != nil {
+		return nil, fmt.Errorf("get decimals failed, contract=%s, err=%s", contract, err)
+	}
+	totalSupply, err := s.client.TotalSupplyOf(contract)
+	if err != nil {
+		return nil, fmt.Errorf("get total supply failed, contract=%s, err=%s", contract, err)
+	}
+	symbol, err := s.client.SymbolOf(contract)
+	if err != nil || symbol == "" {
+		// MKR style tokens return bytes32 instead of string
+		if symbol, err = s.callString(contract, selectorSymbol); err != nil {
+			return nil, fmt.Errorf("get symbol failed, contract=%s, err=%s", contract, err)
+		}
+	}
+	// name is optional in ERC20, a missing name is not an error
+	name, _ := s.callString(contract, selectorName)
+
+	meta := &TokenMetadata{
+		ChainID:     s.chainID,
+		Contract:    contract,
+		Name:        name,
+		Symbol:      symbol,
+		Decimals:    decimals,
+		TotalSupply: totalSupply,
+		Behavior:    BehaviorUnknown,
+		UpdatedAt:   s.now(),
+	}
+	return meta, nil
+}
+
+// cached returns the entry even if it is expired
+func (s *Service) cached(key string) (*TokenMetadata, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.cache[key]
+	if !ok {
+		return nil, false
+	}
+	return entry.meta, true
+}
+
+func (s *Service) callString(contract string, selector []byte) (string, error) {
+	result, err := s.client.CallContract(&chain_client.Transaction{To: contract, Data: selector})
+	if err != nil {
+		return "", err
+	}
+	return DecodeString(result)
+}
+
+// DecodeString decodes the result of a string getter such as name() or symbol()
+// it accepts both the ABI encoded string and the bytes32 form used by older tokens
+func DecodeString(data []byte) (string, error) {
+	if len(data) == 32 {
+		return bytes32ToString(data)
+	}
+	if len(data) > 32 {
+		values, err := stringArgs.Unpack(data)
+		if err == nil && len(values) == 1 {
+			if str, ok := values[0].(string); ok {
+				return str, nil
+			}
+		}
+		// some tokens declare bytes32 but pad the return data
+		return bytes32ToString(data[:32])
+	}
+	return "", fmt.Errorf("cannot decode string from %d bytes", len(data))
+}
+
+func bytes32ToString(data []byte) (string, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("bytes32 value is not valid utf8")
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,176 @@
+package tokenmeta
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/h8848/blockchain-infra/chain/chain_client"
+)
+
+type fakeClient struct {
+	chain_client.BlockChainClient
+	symbol  string
+	fetches int32
+	// block holds DecimalsOf until it is closed
+	block chan struct{}
+}
+
+func (f *fakeClient) NormalizeAddress(address string) string {
+	if !common.IsHexAddress(address) {
+		return ""
+	}
+	return strings.ToLower(address)
+}
+
+func (f *fakeClient) DecimalsOf(string) (uint8, error) {
+	atomic.AddInt32(&f.fetches, 1)
+	if f.block != nil {
+		<-f.block
+	}
+	return 18, nil
+}
+
+func (f *fakeClient) TotalSupplyOf(string) (*big.Int, error) {
+	return big.NewInt(1000), nil
+}
+
+func (f *fakeClient) SymbolOf(string) (string, error) {
+	if f.symbol == "" {
+		return "", fmt.Errorf("abi: cannot unmarshal [32]uint8 in to string")
+	}
+	return f.symbol, nil
+}
+
+func (f *fakeClient) CallContract(td *chain_client.Transaction) ([]byte, error) {
+	switch {
+	case bytes.Equal(td.Data, selectorSymbol):
+		return common.RightPadBytes([]byte("MKR"), 32), nil
+	case bytes.Equal(td.Data, selectorName):
+		return common.RightPadBytes([]byte("Maker"), 32), nil
+	}
+	return nil, fmt.Errorf("execution reverted")
+}
+
+type mapStore struct {
+	mu    sync.Mutex
+	metas map[string]*TokenMetadata
+	loads int
+}
+
+func (s *mapStore) Load(chainID, contract string) (*TokenMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loads++
+	if m, ok := s.metas[chainID+contract]; ok {
+		return m.clone(), nil
+	}
+	return nil, nil
+}
+
+func (s *mapStore) Save(meta *TokenMetadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metas[meta.ChainID+meta.Contract] = meta.clone()
+	return nil
+}
+
+const testToken = "0xdAC17F958D2ee523a2206206994597C13D831ec7"
+
+func TestMetadataCache(t *testing.T) {
+	client := &fakeClient{symbol: "USDT"}
+	s := NewService(client, &Config{TTL: time.Minute})
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	meta, err := s.Metadata(testToken)
+	if err != nil || meta.Symbol != "USDT" || meta.Decimals != 18 || meta.Behavior != BehaviorUnknown {
+		t.Fatalf("meta=%+v, err=%v", meta, err)
+	}
+	// the caller's copy does not alias the cache
+	meta.Symbol = "FAKE"
+	meta.TotalSupply.SetInt64(0)
+	again, _ := s.Metadata(strings.ToLower(testToken))
+	if again.Symbol != "USDT" || again.TotalSupply.Int64() != 1000 || client.fetches != 1 {
+		t.Fatalf("meta=%+v, fetches=%d", again, client.fetches)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := s.Metadata(testToken); err != nil || client.fetches != 2 {
+		t.Fatalf("fetches after ttl=%d, err=%v", client.fetches, err)
+	}
+	if _, err := s.Metadata("not an address"); err == nil {
+		t.Fatal("invalid address accepted")
+	}
+}
+
+func TestMetadataStore(t *testing.T) {
+	client := &fakeClient{symbol: "USDT"}
+	store := &mapStore{metas: map[string]*TokenMetadata{}}
+	s := NewService(client, &Config{ChainID: big.NewInt(1), TTL: time.Minute, Store: store})
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	key := strings.ToLower(testToken)
+
+	// a fresh stored entry is served without going to chain
+	_ = store.Save(&TokenMetadata{ChainID: "1", Contract: key, Symbol: "STORED", UpdatedAt: now})
+	if meta, err := s.Metadata(testToken); err != nil || meta.Symbol != "STORED" || client.fetches != 0 {
+		t.Fatalf("meta=%+v, fetches=%d, err=%v", meta, client.fetches, err)
+	}
+
+	// a stale entry is reloaded, the detected behavior is kept and the result is saved
+	_ = store.Save(&TokenMetadata{ChainID: "1", Contract: key, Symbol: "STORED", Behavior: BehaviorFeeOnTransfer, UpdatedAt: now.Add(-time.Hour)})
+	s.Invalidate(testToken)
+	meta, err := s.Metadata(testToken)
+	if err != nil || meta.Symbol != "USDT" || meta.Behavior != BehaviorFeeOnTransfer || client.fetches != 1 {
+		t.Fatalf("meta=%+v, fetches=%d, err=%v", meta, client.fetches, err)
+	}
+	if stored, _ := store.Load("1", key); stored.Symbol != "USDT" {
+		t.Fatalf("stored=%+v", stored)
+	}
+
+	// a miss goes to chain and is saved
+	other := "0x6B175474E89094C44Da98b954EedeAC495271d0F"
+	if _, err := s.Metadata(other); err != nil || client.fetches != 2 {
+		t.Fatalf("fetches=%d, err=%v", client.fetches, err)
+	}
+	if stored, _ := store.Load("1", strings.ToLower(other)); stored == nil {
+		t.Fatal("metadata was not saved")
+	}
+}
+
+func TestMetadataSingleflight(t *testing.T) {
+	client := &fakeClient{symbol: "USDT", block: make(chan struct{})}
+	s := NewService(client, nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Metadata(testToken); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// let every caller reach the in-flight load before it finishes
+	time.Sleep(50 * time.Millisecond)
+	close(client.block)
+	wg.Wait()
+	if client.fetches != 1 {
+		t.Fatalf("fetches=%d, want 1", client.fetches)
+	}
+}
+
+func TestMetadataBytes32Symbol(t *testing.T) {
+	s := NewService(&fakeClient{}, nil)
+	meta, err := s.Metadata(testToken)
+	if err != nil || meta.Symbol != "MKR" || meta.Name != "Maker" {
+		t.Fatalf("meta=%+v, err=%v", meta, err)
+	}
+}
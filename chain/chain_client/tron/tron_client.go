@@ -101,7 +101,10 @@ func (tc *TronClient) BalanceOf(contract, from string) (*big.Int, error) {
 // DecimalsOf returns the decimals of an contract
 func (tc *TronClient) DecimalsOf(contract string) (uint8, error) {
 	decimals, err := tc.c.DecimalsOf(contract)
-	return uint8(decimals.Uint64()), err
+	if err != nil {
+		return 0, err
+	}
+	return uint8(decimals.Uint64()), nil
 }
 
 // TotalSupplyOf returns the total supply of a contract
@@ -507,6 +510,7 @@ func (tc *TronClient) GetTransactionByHash(transactionHash string) (*chain_clien
 	tx.ChainID = tc.chainID
 	if txInfo.BlockNumber != nil {
 		info.IsPending = false
+		info.BlockNumber = txInfo.BlockNumber
 	}
 	if strings.EqualFold(transaction.Ret[0].ContractRet, "SUCCESS") {
 		info.Status = chain_client.TransactionStatusSuccess
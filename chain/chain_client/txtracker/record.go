@@ -0,0 +1,91 @@
+package txtracker
+
+import (
+	"time"
+
+	"github.com/h8848/blockchain-infra/chain/chain_client"
+)
+
+// State is the lifecycle state of a tracked transaction
+type State string
+
+const (
+	StatePending   State = "pending"
+	StateMined     State = "mined"
+	StateConfirmed State = "confirmed"
+	StateFailed    State = "failed"
+	StateReplaced  State = "replaced"
+	StateDropped   State = "dropped"
+)
+
+// transitions are the allowed record state changes
+// mined can go back to pending when the block is reorged out
+var transitions = map[State][]State{
+	StatePending: {StateMined, StateDropped},
+	StateMined:   {StatePending, StateConfirmed, StateFailed},
+}
+
+func canTransition(from, to State) bool {
+	if from == "" {
+		return to == StatePending
+	}
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Final reports whether the tracker stops following a record in this state
+func (s State) Final() bool {
+	return s == StateConfirmed || s == StateFailed || s == StateDropped
+}
+
+// AttemptKind is why a transaction with the nonce was sent
+type AttemptKind string
+
+const (
+	KindOriginal AttemptKind = "original"
+	KindSpeedUp  AttemptKind = "speed_up"
+	KindCancel   AttemptKind = "cancel"
+)
+
+// Attempt is one broadcast transaction using the nonce of a record
+type Attempt struct {
+	Hash       string
+	Fee        *chain_client.FeeLimit
+	Kind       AttemptKind
+	SentAt     time.Time
+	LastSeenAt time.Time
+	State      State
+}
+
+// Record is a sender nonce followed by the tracker, every transaction sent with the nonce is an attempt
+// MinedHash is the attempt that was mined, Confirmations counts the mined block itself
+type Record struct {
+	ID            string
+	ChainID       string
+	Tx            *chain_client.Transaction
+	Attempts      []*Attempt
+	State         State
+	MinedHash     string
+	BlockNumber   uint64
+	Confirmations uint64
+	Error         string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (r *Record) lastAttempt() *Attempt {
+	return r.Attempts[len(r.Attempts)-1]
+}
+
+func (r *Record) attempt(hash string) *Attempt {
+	for _, a := range r.Attempts {
+		if a.Hash == hash {
+			return a
+		}
+	}
+	return nil
+}
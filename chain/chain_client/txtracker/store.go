@@ -0,0 +1,151 @@
+package txtracker
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/h8848/blockchain-infra/pkg/xgorm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store persists records, Load returns nil without error for unknown ids
+// ListActive returns the records of a chain that are not final
+type Store interface {
+	Load(id string) (*Record, error)
+	Save(rec *Record) error
+	ListActive(chainID string) ([]*Record, error)
+}
+
+// MemoryStore keeps the records in process, it is the default store of the tracker
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) Load(id string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.records[id]
+	if !ok {
+		return nil, nil
+	}
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (s *MemoryStore) Save(rec *Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.records[rec.ID] = data
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) ListActive(chainID string) ([]*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*Record
+	for _, data := range s.records {
+		var rec Record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, err
+		}
+		if rec.ChainID == chainID && !rec.State.Final() {
+			list = append(list, &rec)
+		}
+	}
+	return list, nil
+}
+
+// TxRecordModel is the table used by GormStore, attempts and the transaction are stored as json
+type TxRecordModel struct {
+	xgorm.BaseModel
+	RecordID  string `gorm:"column:record_id;type:varchar(255);not null;uniqueIndex:uk_record_id;comment:链ID:地址:nonce 或 链ID:交易哈希"`
+	ChainID   string `gorm:"column:chain_id;type:varchar(32);not null;index:idx_chain_state;comment:链ID"`
+	State     string `gorm:"column:state;type:varchar(16);not null;index:idx_chain_state;comment:状态"`
+	MinedHash string `gorm:"column:mined_hash;type:varchar(128);comment:上链交易hash"`
+	Data      string `gorm:"column:data;type:text;comment:交易记录"`
+}
+
+func (TxRecordModel) TableName() string {
+	return "tx_record"
+}
+
+// GormStore is a Store backed by xgorm
+type GormStore struct {
+	db *gorm.DB
+}
+
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// AutoMigrate creates or updates the tx_record table
+func (g *GormStore) AutoMigrate() error {
+	return xgorm.Primary(g.db).AutoMigrate(&TxRecordModel{})
+}
+
+func (g *GormStore) Load(id string) (*Record, error) {
+	var m TxRecordModel
+	// 读出后会修改保存，从主库读
+	err := xgorm.Primary(g.db).Where("record_id = ?", id).Take(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rec Record
+	if err := json.Unmarshal([]byte(m.Data), &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (g *GormStore) Save(rec *Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	m := TxRecordModel{
+		RecordID:  rec.ID,
+		ChainID:   rec.ChainID,
+		State:     string(rec.State),
+		MinedHash: rec.MinedHash,
+		Data:      string(data),
+	}
+	return g.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "record_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"state", "mined_hash", "data", "updated_at"}),
+	}).Create(&m).Error
+}
+
+func (g *GormStore) ListActive(chainID string) ([]*Record, error) {
+	var models []TxRecordModel
+	err := xgorm.Primary(g.db).Where("chain_id = ? AND state NOT IN ?", chainID,
+		[]string{string(StateConfirmed), string(StateFailed), string(StateDropped)}).Find(&models).Error
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*Record, 0, len(models))
+	for _, m := range models {
+		var rec Record
+		if err := json.Unmarshal([]byte(m.Data), &rec); err != nil {
+			return nil, err
+		}
+		list = append(list, &rec)
+	}
+	return list, nil
+}
@@ -0,0 +1,510 @@
+package txtracker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/h8848/blockchain-infra/chain/chain_client"
+)
+
+const (
+	defaultPollInterval = 10 * time.Second
+	defaultDropTimeout  = 10 * time.Minute
+	defaultBumpPercent  = 12
+	cancelGas           = 21000
+)
+
+// SignFunc signs the hash returned by BlockChainClient.GetTransaction for td
+type SignFunc func(td *chain_client.Transaction, hash []byte) ([]byte, error)
+
+// Callback is called after every state transition, hash is the attempt the transition is about
+type Callback func(rec *Record, hash string, from, to State)
+
+// BumpPolicy controls replace-by-fee
+// After is how long an attempt may stay pending before it is sped up automatically, 0 disables auto speed up
+// Percent is the minimum increase of both fee caps, nodes reject replacements below 10%
+// MaxFeeCap is the highest GasFeeCap a replacement may use, nil means no limit
+// MaxAttempts limits the number of transactions sent with the same nonce, 0 means no limit
+type BumpPolicy struct {
+	After       time.Duration
+	Percent     int64
+	MaxFeeCap   *big.Int
+	MaxAttempts int
+}
+
+// Config is the config for the tracker
+// Confirmations is the number of blocks including the mined block after which a transaction is final
+// DropTimeout is how long the node may not know any attempt of a pending record before it is dropped
+// IsNotFound reports whether an error of GetTransactionByHash means the node does not know the transaction,
+// the default matches ethereum.NotFound. Only such answers count toward DropTimeout, other errors are returned
+// NoReplaceByFee must be set for chains without account nonces such as Tron, records are keyed by
+// the transaction hash and SpeedUp, Cancel and the automatic bump are disabled
+type Config struct {
+	ChainID        string
+	Confirmations  uint64
+	PollInterval   time.Duration
+	DropTimeout    time.Duration
+	Bump           BumpPolicy
+	NoReplaceByFee bool
+	IsNotFound     func(err error) bool
+	Store          Store
+	Sign           SignFunc
+}
+
+// Tracker follows broadcast transactions until they are final
+// A record is loaded, changed and saved under a lock for its id, so only one tracker may use a store
+type Tracker struct {
+	client chain_client.BlockChainClient
+	conf   Config
+	store  Store
+
+	mu        sync.Mutex
+	callbacks []Callback
+	locks     map[string]*recordLock
+	now       func() time.Time
+}
+
+type recordLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// NewTracker creates the tracker
+func NewTracker(client chain_client.BlockChainClient, conf *Config) *Tracker {
+	t := &Tracker{client: client, conf: *conf, store: conf.Store, locks: make(map[string]*recordLock), now: time.Now}
+	if t.store == nil {
+		t.store = NewMemoryStore()
+	}
+	if t.conf.Confirmations == 0 {
+		t.conf.Confirmations = 1
+	}
+	if t.conf.PollInterval <= 0 {
+		t.conf.PollInterval = defaultPollInterval
+	}
+	if t.conf.DropTimeout <= 0 {
+		t.conf.DropTimeout = defaultDropTimeout
+	}
+	if t.conf.IsNotFound == nil {
+		t.conf.IsNotFound = func(err error) bool { return errors.Is(err, ethereum.NotFound) }
+	}
+	if t.conf.Bump.Percent < 10 {
+		t.conf.Bump.Percent = defaultBumpPercent
+	}
+	return t
+}
+
+// OnTransition registers a callback for state transitions
+func (t *Tracker) OnTransition(cb Callback) {
+	t.mu.Lock()
+	t.callbacks = append(t.callbacks, cb)
+	t.mu.Unlock()
+}
+
+// lock serializes the changes of one record, the returned func unlocks it
+func (t *Tracker) lock(id string) func() {
+	t.mu.Lock()
+	l := t.locks[id]
+	if l == nil {
+		l = &recordLock{}
+		t.locks[id] = l
+	}
+	l.refs++
+	t.mu.Unlock()
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		t.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(t.locks, id)
+		}
+		t.mu.Unlock()
+	}
+}
+
+// RecordID is the id of the record for a sender and nonce
+func RecordID(chainID, from string, nonce uint64) string {
+	return fmt.Sprintf("%s:%s:%d", chainID, strings.ToLower(from), nonce)
+}
+
+// HashRecordID is the id of the record for a transaction on a chain without replace-by-fee
+func HashRecordID(chainID, hash string) string {
+	return fmt.Sprintf("%s:%s", chainID, strings.ToLower(hash))
+}
+
+// Track starts following a transaction which was broadcast with hash
+// td must be the same transaction that was passed to GetTransaction, including Nonce and Fee
+// A new hash for a confirmed or failed record is rejected because its nonce is already used
+func (t *Tracker) Track(td *chain_client.Transaction, hash string) (*Record, error) {
+	id := RecordID(t.conf.ChainID, td.From, td.Nonce)
+	if t.conf.NoReplaceByFee {
+		id = HashRecordID(t.conf.ChainID, hash)
+	}
+	defer t.lock(id)()
+	rec, err := t.store.Load(id)
+	if err != nil {
+		return nil, fmt.Errorf("load record failed, err=%s", err)
+	}
+	now := t.now()
+	attempt := &Attempt{Hash: hash, Fee: td.Fee, Kind: KindOriginal, SentAt: now, LastSeenAt: now, State: StatePending}
+	// a dropped nonce handed out again starts a new record
+	if rec != nil && rec.State != StateDropped {
+		if rec.attempt(hash) != nil {
+			return rec, nil
+		}
+		if rec.State.Final() {
+			return nil, fmt.Errorf("record=%s is %s, hash=%s cannot use its nonce", id, rec.State, hash)
+		}
+		// sent again with the same nonce outside of the tracker
+		attempt.Kind = KindSpeedUp
+		t.supersede(rec, attempt)
+		return rec, t.store.Save(rec)
+	}
+	rec = &Record{
+		ID:        id,
+		ChainID:   t.conf.ChainID,
+		Tx:        td,
+		Attempts:  []*Attempt{attempt},
+		State:     StatePending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := t.store.Save(rec); err != nil {
+		return nil, fmt.Errorf("save record failed, err=%s", err)
+	}
+	t.emit(rec, hash, "", StatePending)
+	return rec, nil
+}
+
+// Get returns a tracked record
+func (t *Tracker) Get(id string) (*Record, error) {
+	return t.store.Load(id)
+}
+
+// SpeedUp replaces the pending transaction with the same one paying a higher fee
+func (t *Tracker) SpeedUp(id string) (string, error) {
+	defer t.lock(id)()
+	rec, err := t.pendingRecord(id)
+	if err != nil {
+		return "", err
+	}
+	last := rec.lastAttempt()
+	td := *rec.Tx
+	return t.replace(rec, &td, last.Fee, KindSpeedUp)
+}
+
+// Cancel replaces the pending transaction with a zero value transfer to the sender itself
+func (t *Tracker) Cancel(id string) (string, error) {
+	defer t.lock(id)()
+	rec, err := t.pendingRecord(id)
+	if err != nil {
+		return "", err
+	}
+	td, fee := cancelTx(rec)
+	return t.replace(rec, td, fee, KindCancel)
+}
+
+// cancelTx is a zero value self transfer with the nonce of rec and the fee of its last attempt
+func cancelTx(rec *Record) (*chain_client.Transaction, *chain_client.FeeLimit) {
+	last := rec.lastAttempt()
+	td := &chain_client.Transaction{
+		From:    rec.Tx.From,
+		To:      rec.Tx.From,
+		Amount:  big.NewInt(0),
+		Nonce:   rec.Tx.Nonce,
+		ChainID: rec.Tx.ChainID,
+	}
+	fee := &chain_client.FeeLimit{Gas: big.NewInt(cancelGas)}
+	if last.Fee != nil {
+		fee.GasFeeCap, fee.GasTipCap = last.Fee.GasFeeCap, last.Fee.GasTipCap
+	}
+	return td, fee
+}
+
+func (t *Tracker) pendingRecord(id string) (*Record, error) {
+	rec, err := t.store.Load(id)
+	if err != nil {
+		return nil, fmt.Errorf("load record failed, err=%s", err)
+	}
+	if rec == nil {
+		return nil, fmt.Errorf("record=%s not found", id)
+	}
+	if rec.State != StatePending {
+		return nil, fmt.Errorf("record=%s is %s, only pending transactions can be replaced", id, rec.State)
+	}
+	return rec, nil
+}
+
+func (t *Tracker) replace(rec *Record, td *chain_client.Transaction, prev *chain_client.FeeLimit, kind AttemptKind) (string, error) {
+	if t.conf.NoReplaceByFee {
+		return "", fmt.Errorf("chain=%s does not support replace-by-fee", t.conf.ChainID)
+	}
+	if t.conf.Sign == nil {
+		return "", fmt.Errorf("sign function is not configured")
+	}
+	if t.conf.Bump.MaxAttempts > 0 && len(rec.Attempts) >= t.conf.Bump.MaxAttempts {
+		return "", fmt.Errorf("record=%s reached max attempts=%d", rec.ID, t.conf.Bump.MaxAttempts)
+	}
+	fee, err := t.bumpFee(td, prev)
+	if err != nil {
+		return "", err
+	}
+	td.Fee = fee
+	raw, hash, err := t.client.GetTransaction(td)
+	if err != nil {
+		return "", fmt.Errorf("build replacement failed, err=%s", err)
+	}
+	sig, err := t.conf.Sign(td, hash)
+	if err != nil {
+		return "", fmt.Errorf("sign replacement failed, err=%s", err)
+	}
+	txid, err := t.client.BroadcastTransaction(raw, sig)
+	if err != nil {
+		return "", fmt.Errorf("broadcast replacement failed, err=%s", err)
+	}
+	now := t.now()
+	attempt := &Attempt{
+		Hash:       fmt.Sprintf("0x%x", txid),
+		Fee:        fee,
+		Kind:       kind,
+		SentAt:     now,
+		LastSeenAt: now,
+		State:      StatePending,
+	}
+	t.supersede(rec, attempt)
+	if err := t.store.Save(rec); err != nil {
+		return attempt.Hash, fmt.Errorf("save record failed, err=%s", err)
+	}
+	return attempt.Hash, nil
+}
+
+// supersede adds a new attempt, the previous pending attempts are marked replaced
+func (t *Tracker) supersede(rec *Record, attempt *Attempt) {
+	for _, a := range rec.Attempts {
+		if a.State == StatePending {
+			a.State = StateReplaced
+			t.emit(rec, a.Hash, StatePending, StateReplaced)
+		}
+	}
+	rec.Attempts = append(rec.Attempts, attempt)
+	rec.UpdatedAt = t.now()
+}
+
+// bumpFee raises both caps by the policy percent but never below the current suggestion
+func (t *Tracker) bumpFee(td *chain_client.Transaction, prev *chain_client.FeeLimit) (*chain_client.FeeLimit, error) {
+	if prev == nil || prev.GasFeeCap == nil {
+		return nil, fmt.Errorf("previous fee is unknown, cannot replace")
+	}
+	fee := &chain_client.FeeLimit{Gas: prev.Gas}
+	fee.GasFeeCap = bump(prev.GasFeeCap, t.conf.Bump.Percent)
+	if prev.GasTipCap != nil {
+		fee.GasTipCap = bump(prev.GasTipCap, t.conf.Bump.Percent)
+	}
+	if suggested, err := t.client.GetSuggestFee(td); err == nil && suggested != nil {
+		if suggested.GasFeeCap != nil && suggested.GasFeeCap.Cmp(fee.GasFeeCap) > 0 {
+			fee.GasFeeCap = suggested.GasFeeCap
+		}
+		if fee.GasTipCap != nil && suggested.GasTipCap != nil && suggested.GasTipCap.Cmp(fee.GasTipCap) > 0 {
+			fee.GasTipCap = suggested.GasTipCap
+		}
+		if fee.Gas == nil {
+			fee.Gas = suggested.Gas
+		}
+	}
+	if fee.GasTipCap != nil && fee.GasTipCap.Cmp(fee.GasFeeCap) > 0 {
+		fee.GasFeeCap = new(big.Int).Set(fee.GasTipCap)
+	}
+	if max := t.conf.Bump.MaxFeeCap; max != nil && fee.GasFeeCap.Cmp(max) > 0 {
+		return nil, fmt.Errorf("bumped fee cap=%s exceeds max=%s", fee.GasFeeCap, max)
+	}
+	return fee, nil
+}
+
+func bump(v *big.Int, percent int64) *big.Int {
+	n := new(big.Int).Mul(v, big.NewInt(100+percent))
+	n.Add(n, big.NewInt(99))
+	return n.Div(n, big.NewInt(100))
+}
+
+// Run polls the active records until ctx is done
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.conf.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = t.Poll()
+		}
+	}
+}
+
+// Poll checks every active record once, the first error is returned after all records are checked
+func (t *Tracker) Poll() error {
+	records, err := t.store.ListActive(t.conf.ChainID)
+	if err != nil {
+		return fmt.Errorf("list records failed, err=%s", err)
+	}
+	latest, err := t.client.GetLatestBlockNumber()
+	if err != nil {
+		return fmt.Errorf("get latest block failed, err=%s", err)
+	}
+	var firstErr error
+	for _, rec := range records {
+		if err := t.checkID(rec.ID, latest.Uint64()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// checkID reloads the record under its lock, SpeedUp or Cancel may have saved it after ListActive
+func (t *Tracker) checkID(id string, latest uint64) error {
+	defer t.lock(id)()
+	rec, err := t.store.Load(id)
+	if err != nil {
+		return fmt.Errorf("load record failed, err=%s", err)
+	}
+	if rec == nil || rec.State.Final() {
+		return nil
+	}
+	return t.check(rec, latest)
+}
+
+func (t *Tracker) check(rec *Record, latest uint64) error {
+	now := t.now()
+	var mined *Attempt
+	var minedInfo *chain_client.TransactionInfo
+	var lookupErr error
+	for _, a := range rec.Attempts {
+		info, err := t.client.GetTransactionByHash(a.Hash)
+		if err != nil && !t.conf.IsNotFound(err) {
+			lookupErr = fmt.Errorf("get transaction=%s failed, err=%s", a.Hash, err)
+			continue
+		}
+		if err != nil || info == nil || (info.BlockNumber == nil && !info.IsPending) {
+			continue
+		}
+		a.LastSeenAt = now
+		if info.BlockNumber != nil && mined == nil {
+			mined, minedInfo = a, info
+		}
+	}
+
+	switch {
+	case mined != nil:
+		t.onMined(rec, mined, minedInfo, latest)
+	case lookupErr != nil:
+		// the node did not answer for every attempt, a missing transaction is not proven
+		if err := t.store.Save(rec); err != nil {
+			return err
+		}
+		return lookupErr
+	case rec.State == StateMined:
+		// the block was reorged out, the transaction is back in the pool or gone
+		t.unmine(rec)
+	default:
+		t.onPending(rec, now)
+	}
+	rec.UpdatedAt = now
+	return t.store.Save(rec)
+}
+
+func (t *Tracker) onMined(rec *Record, mined *Attempt, info *chain_client.TransactionInfo, latest uint64) {
+	block := info.BlockNumber.Uint64()
+	if rec.State == StateMined && (rec.MinedHash != mined.Hash || rec.BlockNumber != block) {
+		// reorg into another block or a different attempt won
+		t.unmine(rec)
+	}
+	if rec.State == StatePending {
+		rec.MinedHash, rec.BlockNumber = mined.Hash, block
+		for _, a := range rec.Attempts {
+			if a == mined {
+				a.State = StateMined
+			} else if a.State == StatePending || a.State == StateMined {
+				a.State = StateReplaced
+				t.emit(rec, a.Hash, StatePending, StateReplaced)
+			}
+		}
+		t.transition(rec, mined.Hash, StateMined)
+	}
+	if latest >= block {
+		rec.Confirmations = latest - block + 1
+	}
+	if rec.Confirmations < t.conf.Confirmations {
+		return
+	}
+	if info.Status == chain_client.TransactionStatusSuccess {
+		mined.State = StateConfirmed
+		t.transition(rec, mined.Hash, StateConfirmed)
+	} else {
+		mined.State = StateFailed
+		rec.Error = info.Error
+		t.transition(rec, mined.Hash, StateFailed)
+	}
+}
+
+func (t *Tracker) unmine(rec *Record) {
+	hash := rec.MinedHash
+	if a := rec.attempt(hash); a != nil {
+		a.State = StatePending
+	}
+	rec.MinedHash, rec.BlockNumber, rec.Confirmations = "", 0, 0
+	t.transition(rec, hash, StatePending)
+}
+
+func (t *Tracker) onPending(rec *Record, now time.Time) {
+	last := rec.lastAttempt()
+	seen := last.LastSeenAt
+	for _, a := range rec.Attempts {
+		if a.LastSeenAt.After(seen) {
+			seen = a.LastSeenAt
+		}
+	}
+	if now.Sub(seen) > t.conf.DropTimeout {
+		for _, a := range rec.Attempts {
+			if a.State == StatePending {
+				a.State = StateDropped
+			}
+		}
+		t.transition(rec, last.Hash, StateDropped)
+		return
+	}
+	if !t.conf.NoReplaceByFee && t.conf.Bump.After > 0 && now.Sub(last.SentAt) > t.conf.Bump.After {
+		var err error
+		if last.Kind == KindCancel {
+			td, fee := cancelTx(rec)
+			_, err = t.replace(rec, td, fee, KindCancel)
+		} else {
+			td := *rec.Tx
+			_, err = t.replace(rec, &td, last.Fee, KindSpeedUp)
+		}
+		if err != nil {
+			rec.Error = err.Error()
+		}
+	}
+}
+
+func (t *Tracker) transition(rec *Record, hash string, to State) {
+	from := rec.State
+	if from == to || !canTransition(from, to) {
+		return
+	}
+	rec.State = to
+	t.emit(rec, hash, from, to)
+}
+
+func (t *Tracker) emit(rec *Record, hash string, from, to State) {
+	t.mu.Lock()
+	callbacks := append([]Callback(nil), t.callbacks...)
+	t.mu.Unlock()
+	for _, cb := range callbacks {
+		cb(rec, hash, from, to)
+	}
+}
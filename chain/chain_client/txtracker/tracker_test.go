@@ -0,0 +1,226 @@
+package txtracker
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/h8848/blockchain-infra/chain/chain_client"
+)
+
+type fakeClient struct {
+	chain_client.BlockChainClient
+	latest int64
+	txs    map[string]*chain_client.TransactionInfo
+	sent   int
+	down   bool
+}
+
+func (f *fakeClient) GetLatestBlockNumber() (*big.Int, error) {
+	return big.NewInt(f.latest), nil
+}
+
+func (f *fakeClient) GetTransactionByHash(hash string) (*chain_client.TransactionInfo, error) {
+	if f.down {
+		return nil, fmt.Errorf("connection refused")
+	}
+	info, ok := f.txs[hash]
+	if !ok {
+		return nil, ethereum.NotFound
+	}
+	return info, nil
+}
+
+func (f *fakeClient) GetSuggestFee(td *chain_client.Transaction) (*chain_client.FeeLimit, error) {
+	return nil, fmt.Errorf("unavailable")
+}
+
+func (f *fakeClient) GetTransaction(td *chain_client.Transaction) ([]byte, []byte, error) {
+	return []byte("raw"), []byte("hash"), nil
+}
+
+func (f *fakeClient) BroadcastTransaction(trans, sig []byte) ([]byte, error) {
+	f.sent++
+	txid := []byte{byte(f.sent)}
+	f.txs[fmt.Sprintf("0x%x", txid)] = &chain_client.TransactionInfo{IsPending: true}
+	return txid, nil
+}
+
+func TestSpeedUpAndConfirm(t *testing.T) {
+	client := &fakeClient{latest: 100, txs: map[string]*chain_client.TransactionInfo{
+		"0xaa": {IsPending: true},
+	}}
+	tr := NewTracker(client, &Config{
+		ChainID:       "1",
+		Confirmations: 3,
+		Sign:          func(*chain_client.Transaction, []byte) ([]byte, error) { return []byte("sig"), nil },
+	})
+	var states []State
+	tr.OnTransition(func(rec *Record, hash string, from, to State) {
+		if hash == rec.MinedHash || to != StateReplaced {
+			states = append(states, to)
+		}
+	})
+
+	td := &chain_client.Transaction{From: "0xA", To: "0xB", Nonce: 7, Fee: &chain_client.FeeLimit{
+		Gas: big.NewInt(21000), GasFeeCap: big.NewInt(100), GasTipCap: big.NewInt(10),
+	}}
+	rec, err := tr.Track(td, "0xaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := tr.SpeedUp(rec.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, _ = tr.Get(rec.ID)
+	if fee := rec.lastAttempt().Fee; fee.GasFeeCap.Int64() != 112 || fee.GasTipCap.Int64() != 12 {
+		t.Fatalf("bumped fee=%s/%s", fee.GasFeeCap, fee.GasTipCap)
+	}
+
+	// the replacement is mined in block 100
+	client.txs[hash] = &chain_client.TransactionInfo{Status: chain_client.TransactionStatusSuccess, BlockNumber: big.NewInt(100)}
+	delete(client.txs, "0xaa")
+	if err := tr.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	rec, _ = tr.Get(rec.ID)
+	if rec.State != StateMined || rec.MinedHash != hash || rec.Confirmations != 1 {
+		t.Fatalf("state=%s mined=%s confirmations=%d", rec.State, rec.MinedHash, rec.Confirmations)
+	}
+
+	client.latest = 102
+	if err := tr.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	rec, _ = tr.Get(rec.ID)
+	if rec.State != StateConfirmed || rec.attempt("0xaa").State != StateReplaced {
+		t.Fatalf("state=%s original=%s", rec.State, rec.attempt("0xaa").State)
+	}
+	want := []State{StatePending, StateMined, StateConfirmed}
+	if fmt.Sprint(states) != fmt.Sprint(want) {
+		t.Fatalf("transitions=%v, want %v", states, want)
+	}
+	// the nonce of a confirmed record cannot be used by another transaction
+	if _, err := tr.Track(td, "0xcc"); err == nil {
+		t.Fatal("new hash accepted for a confirmed record")
+	}
+	if got, err := tr.Track(td, hash); err != nil || len(got.Attempts) != 2 {
+		t.Fatalf("track again attempts=%d, err=%v", len(got.Attempts), err)
+	}
+}
+
+// racingStore speeds the record up after Poll listed it
+type racingStore struct {
+	*MemoryStore
+	race func()
+}
+
+func (s *racingStore) ListActive(chainID string) ([]*Record, error) {
+	list, err := s.MemoryStore.ListActive(chainID)
+	if s.race != nil {
+		s.race()
+		s.race = nil
+	}
+	return list, err
+}
+
+func TestPollKeepsReplacement(t *testing.T) {
+	client := &fakeClient{latest: 1, txs: map[string]*chain_client.TransactionInfo{"0xaa": {IsPending: true}}}
+	store := &racingStore{MemoryStore: NewMemoryStore()}
+	tr := NewTracker(client, &Config{
+		ChainID: "1",
+		Store:   store,
+		Sign:    func(*chain_client.Transaction, []byte) ([]byte, error) { return []byte("sig"), nil },
+	})
+	fee := &chain_client.FeeLimit{Gas: big.NewInt(21000), GasFeeCap: big.NewInt(100)}
+	rec, err := tr.Track(&chain_client.Transaction{From: "0xA", Nonce: 1, Fee: fee}, "0xaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hash string
+	store.race = func() {
+		if hash, err = tr.SpeedUp(rec.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	rec, _ = tr.Get(rec.ID)
+	if len(rec.Attempts) != 2 || rec.lastAttempt().Hash != hash {
+		t.Fatalf("replacement lost, attempts=%d", len(rec.Attempts))
+	}
+}
+
+func TestDropped(t *testing.T) {
+	client := &fakeClient{latest: 1, txs: map[string]*chain_client.TransactionInfo{}}
+	tr := NewTracker(client, &Config{ChainID: "1", DropTimeout: time.Minute})
+	now := time.Now()
+	tr.now = func() time.Time { return now }
+	rec, err := tr.Track(&chain_client.Transaction{From: "0xA", Nonce: 1}, "0xbb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an unreachable node is not proof the transaction is gone
+	client.down = true
+	now = now.Add(2 * time.Minute)
+	if err := tr.Poll(); err == nil {
+		t.Fatal("rpc error was not returned")
+	}
+	rec, _ = tr.Get(rec.ID)
+	if rec.State != StatePending {
+		t.Fatalf("state after rpc error=%s", rec.State)
+	}
+	client.down = false
+	if err := tr.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	rec, _ = tr.Get(rec.ID)
+	if rec.State != StateDropped {
+		t.Fatalf("state=%s", rec.State)
+	}
+}
+
+func TestNoReplaceByFee(t *testing.T) {
+	// tron has no nonce, every transaction from an address reports nonce 0
+	client := &fakeClient{latest: 1, txs: map[string]*chain_client.TransactionInfo{
+		"0xaa": {IsPending: true},
+		"0xbb": {IsPending: true},
+	}}
+	tr := NewTracker(client, &Config{
+		ChainID:        "tron",
+		NoReplaceByFee: true,
+		Bump:           BumpPolicy{After: time.Minute},
+		Sign:           func(*chain_client.Transaction, []byte) ([]byte, error) { return []byte("sig"), nil },
+	})
+	now := time.Now()
+	tr.now = func() time.Time { return now }
+	fee := &chain_client.FeeLimit{Gas: big.NewInt(1), GasFeeCap: big.NewInt(1)}
+	first, err := tr.Track(&chain_client.Transaction{From: "TA", Fee: fee}, "0xaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := tr.Track(&chain_client.Transaction{From: "TA", Fee: fee}, "0xbb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == second.ID || len(second.Attempts) != 1 {
+		t.Fatalf("second transfer was taken as a replacement, id=%s attempts=%d", second.ID, len(second.Attempts))
+	}
+	if _, err := tr.SpeedUp(first.ID); err == nil {
+		t.Fatal("speed up accepted")
+	}
+	if _, err := tr.Cancel(first.ID); err == nil {
+		t.Fatal("cancel accepted")
+	}
+	now = now.Add(2 * time.Minute)
+	if err := tr.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	if client.sent != 0 {
+		t.Fatalf("sent=%d replacements", client.sent)
+	}
+}
@@ -0,0 +1,127 @@
+package eip712
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// NewDomain creates the domain, empty name, version, zero chain id or empty contract are left out
+func NewDomain(name, version string, chainID *big.Int, verifyingContract common.Address) apitypes.TypedDataDomain {
+	domain := apitypes.TypedDataDomain{Name: name, Version: version}
+	if chainID != nil && chainID.Sign() > 0 {
+		domain.ChainId = (*math.HexOrDecimal256)(chainID)
+	}
+	if verifyingContract != (common.Address{}) {
+		domain.VerifyingContract = verifyingContract.Hex()
+	}
+	return domain
+}
+
+// DomainTypes returns the EIP712Domain type with the fields that are set in domain, in the order of the EIP
+func DomainTypes(domain apitypes.TypedDataDomain) []apitypes.Type {
+	var types []apitypes.Type
+	if domain.Name != "" {
+		types = append(types, apitypes.Type{Name: "name", Type: "string"})
+	}
+	if domain.Version != "" {
+		types = append(types, apitypes.Type{Name: "version", Type: "string"})
+	}
+	if domain.ChainId != nil {
+		types = append(types, apitypes.Type{Name: "chainId", Type: "uint256"})
+	}
+	if domain.VerifyingContract != "" {
+		types = append(types, apitypes.Type{Name: "verifyingContract", Type: "address"})
+	}
+	if domain.Salt != "" {
+		types = append(types, apitypes.Type{Name: "salt", Type: "bytes32"})
+	}
+	return types
+}
+
+// NewTypedData builds the typed data, the EIP712Domain type is added from domain
+func NewTypedData(domain apitypes.TypedDataDomain, primaryType string, types apitypes.Types, message apitypes.TypedDataMessage) apitypes.TypedData {
+	all := apitypes.Types{"EIP712Domain": DomainTypes(domain)}
+	for name, fields := range types {
+		all[name] = fields
+	}
+	return apitypes.TypedData{Types: all, PrimaryType: primaryType, Domain: domain, Message: message}
+}
+
+// DomainSeparator returns hashStruct(domain)
+func DomainSeparator(domain apitypes.TypedDataDomain) ([]byte, error) {
+	td := apitypes.TypedData{Types: apitypes.Types{"EIP712Domain": DomainTypes(domain)}, Domain: domain}
+	hash, err := td.HashStruct("EIP712Domain", domain.Map())
+	if err != nil {
+		return nil, fmt.Errorf("hash domain failed, err=%s", err)
+	}
+	return hash, nil
+}
+
+// TypeHash returns keccak256 of the encoded type, such as the PERMIT_TYPEHASH of a contract
+func TypeHash(types apitypes.Types, primaryType string) []byte {
+	td := apitypes.TypedData{Types: types}
+	return td.TypeHash(primaryType)
+}
+
+// Hash returns the digest that is signed: keccak256("\x19\x01" || domainSeparator || hashStruct(message))
+func Hash(td apitypes.TypedData) ([]byte, error) {
+	hash, _, err := apitypes.TypedDataAndHash(td)
+	if err != nil {
+		return nil, fmt.Errorf("hash typed data failed, err=%s", err)
+	}
+	return hash, nil
+}
+
+// Recover returns the address that signed td, V may be 0/1 or 27/28
+func Recover(td apitypes.TypedData, sig []byte) (common.Address, error) {
+	if len(sig) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("signature length=%d, want %d", len(sig), crypto.SignatureLength)
+	}
+	hash, err := Hash(td)
+	if err != nil {
+		return common.Address{}, err
+	}
+	normalized := make([]byte, len(sig))
+	copy(normalized, sig)
+	if normalized[crypto.RecoveryIDOffset] >= 27 {
+		normalized[crypto.RecoveryIDOffset] -= 27
+	}
+	pub, err := crypto.SigToPub(hash, normalized)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("recover signer failed, err=%s", err)
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// Verify checks that td was signed by signer
+func Verify(td apitypes.TypedData, sig []byte, signer common.Address) error {
+	addr, err := Recover(td, sig)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(addr.Bytes(), signer.Bytes()) {
+		return fmt.Errorf("signed by %s, want %s", addr.Hex(), signer.Hex())
+	}
+	return nil
+}
+
+// SplitSignature splits a 65 byte signature into the v, r and s arguments of contracts, v is 27 or 28
+func SplitSignature(sig []byte) (uint8, [32]byte, [32]byte, error) {
+	var r, s [32]byte
+	if len(sig) != crypto.SignatureLength {
+		return 0, r, s, fmt.Errorf("signature length=%d, want %d", len(sig), crypto.SignatureLength)
+	}
+	copy(r[:], sig[:32])
+	copy(s[:], sig[32:64])
+	v := sig[crypto.RecoveryIDOffset]
+	if v < 27 {
+		v += 27
+	}
+	return v, r, s, nil
+}
@@ -0,0 +1,232 @@
+package eip712
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/h8848/blockchain-infra/chain/chain_client"
+	"github.com/h8848/blockchain-infra/chain/ethereum/eth_abi"
+	"github.com/h8848/blockchain-infra/chain/signer"
+)
+
+// PermitTypes are the EIP-2612 message types
+var PermitTypes = apitypes.Types{
+	"Permit": {
+		{Name: "owner", Type: "address"},
+		{Name: "spender", Type: "address"},
+		{Name: "value", Type: "uint256"},
+		{Name: "nonce", Type: "uint256"},
+		{Name: "deadline", Type: "uint256"},
+	},
+}
+
+// domainVersions are tried in order after the result of version(), which most tokens do not expose, USDC uses "2"
+var domainVersions = []string{"1", "2"}
+
+var permitABI = func() *abi.ABI {
+	parsed, err := eth_abi.IERC20PermitMetaData.GetAbi()
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+
+var nameABI = func() *abi.ABI {
+	parsed, err := eth_abi.Erc20TokenMetaData.GetAbi()
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+
+var versionABI = func() *abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(`[{"inputs":[],"name":"version","outputs":[{"name":"","type":"string"}],"stateMutability":"view","type":"function"}]`))
+	if err != nil {
+		panic(err)
+	}
+	return &parsed
+}()
+
+// Permit is an EIP-2612 permit message
+type Permit struct {
+	Owner    common.Address
+	Spender  common.Address
+	Value    *big.Int
+	Nonce    *big.Int
+	Deadline *big.Int
+}
+
+// TypedData returns the typed data of p for domain
+func (p *Permit) TypedData(domain apitypes.TypedDataDomain) apitypes.TypedData {
+	return NewTypedData(domain, "Permit", PermitTypes, apitypes.TypedDataMessage{
+		"owner":    p.Owner.Hex(),
+		"spender":  p.Spender.Hex(),
+		"value":    (*math.HexOrDecimal256)(p.Value),
+		"nonce":    (*math.HexOrDecimal256)(p.Nonce),
+		"deadline": (*math.HexOrDecimal256)(p.Deadline),
+	})
+}
+
+// PermitRequest is a permit ready to be signed by the owner
+type PermitRequest struct {
+	Permit    Permit
+	Contract  common.Address
+	Domain    apitypes.TypedDataDomain
+	TypedData apitypes.TypedData
+}
+
+// Sign signs the request with the owner's signer
+func (r *PermitRequest) Sign(s signer.Signer) ([]byte, error) {
+	if common.HexToAddress(s.Address()) != r.Permit.Owner {
+		return nil, fmt.Errorf("signer=%s is not the owner=%s", s.Address(), r.Permit.Owner.Hex())
+	}
+	return s.SignTypedData(r.TypedData)
+}
+
+// Verify checks that sig is the owner's signature of the request
+func (r *PermitRequest) Verify(sig []byte) error {
+	return Verify(r.TypedData, sig, r.Permit.Owner)
+}
+
+// CallData returns the permit(owner, spender, value, deadline, v, r, s) calldata used to relay the permit
+func (r *PermitRequest) CallData(sig []byte) ([]byte, error) {
+	v, rr, ss, err := SplitSignature(sig)
+	if err != nil {
+		return nil, err
+	}
+	p := r.Permit
+	return permitABI.Pack("permit", p.Owner, p.Spender, p.Value, p.Deadline, v, rr, ss)
+}
+
+// PermitBuilder builds permits by reading the token over a BlockChainClient
+type PermitBuilder struct {
+	client  chain_client.BlockChainClient
+	chainID *big.Int
+}
+
+// NewPermitBuilder creates the builder, chainID is used in the domain
+func NewPermitBuilder(client chain_client.BlockChainClient, chainID *big.Int) *PermitBuilder {
+	return &PermitBuilder{client: client, chainID: chainID}
+}
+
+// Build reads nonces(owner), name(), version() and DOMAIN_SEPARATOR() of contract and returns the permit to sign
+// the domain version is chosen so the computed separator equals the one of the contract
+func (b *PermitBuilder) Build(contract, owner, spender string, value, deadline *big.Int) (*PermitRequest, error) {
+	contractAddr, err := b.client.AddressFromString(contract)
+	if err != nil {
+		return nil, fmt.Errorf("invalid contract=%s, err=%s", contract, err)
+	}
+	ownerAddr, err := b.client.AddressFromString(owner)
+	if err != nil {
+		return nil, fmt.Errorf("invalid owner=%s, err=%s", owner, err)
+	}
+	spenderAddr, err := b.client.AddressFromString(spender)
+	if err != nil {
+		return nil, fmt.Errorf("invalid spender=%s, err=%s", spender, err)
+	}
+
+	nonce, err := b.Nonce(contract, ownerAddr)
+	if err != nil {
+		return nil, err
+	}
+	separator, err := b.DomainSeparator(contract)
+	if err != nil {
+		return nil, err
+	}
+	name, err := b.name(contract)
+	if err != nil {
+		return nil, err
+	}
+	// version() is optional, without it the common versions are tried
+	version, _ := b.version(contract)
+	domain, err := b.matchDomain(name, version, contractAddr, separator)
+	if err != nil {
+		return nil, err
+	}
+	permit := Permit{Owner: ownerAddr, Spender: spenderAddr, Value: value, Nonce: nonce, Deadline: deadline}
+	return &PermitRequest{
+		Permit:    permit,
+		Contract:  contractAddr,
+		Domain:    domain,
+		TypedData: permit.TypedData(domain),
+	}, nil
+}
+
+// Nonce reads nonces(owner) of contract
+func (b *PermitBuilder) Nonce(contract string, owner common.Address) (*big.Int, error) {
+	out, err := b.call(permitABI, contract, "nonces", owner)
+	if err != nil {
+		return nil, err
+	}
+	return *abi.ConvertType(out[0], new(*big.Int)).(**big.Int), nil
+}
+
+// DomainSeparator reads DOMAIN_SEPARATOR() of contract
+func (b *PermitBuilder) DomainSeparator(contract string) ([]byte, error) {
+	out, err := b.call(permitABI, contract, "DOMAIN_SEPARATOR")
+	if err != nil {
+		return nil, err
+	}
+	separator := *abi.ConvertType(out[0], new([32]byte)).(*[32]byte)
+	return separator[:], nil
+}
+
+func (b *PermitBuilder) name(contract string) (string, error) {
+	out, err := b.call(nameABI, contract, "name")
+	if err != nil {
+		return "", err
+	}
+	return *abi.ConvertType(out[0], new(string)).(*string), nil
+}
+
+func (b *PermitBuilder) version(contract string) (string, error) {
+	out, err := b.call(versionABI, contract, "version")
+	if err != nil {
+		return "", err
+	}
+	return *abi.ConvertType(out[0], new(string)).(*string), nil
+}
+
+// matchDomain returns the domain whose separator equals the one of the contract, version is tried first when set
+func (b *PermitBuilder) matchDomain(name, version string, contract common.Address, separator []byte) (apitypes.TypedDataDomain, error) {
+	versions := domainVersions
+	if version != "" {
+		versions = append([]string{version}, domainVersions...)
+	}
+	for _, version := range versions {
+		domain := NewDomain(name, version, b.chainID, contract)
+		hash, err := DomainSeparator(domain)
+		if err != nil {
+			return domain, err
+		}
+		if bytes.Equal(hash, separator) {
+			return domain, nil
+		}
+	}
+	return apitypes.TypedDataDomain{}, fmt.Errorf("domain separator of contract=%s does not match name=%s chainId=%s", contract.Hex(), name, b.chainID)
+}
+
+func (b *PermitBuilder) call(parsed *abi.ABI, contract, method string, args ...interface{}) ([]interface{}, error) {
+	data, err := parsed.Pack(method, args...)
+	if err != nil {
+		return nil, fmt.Errorf("pack %s failed, err=%s", method, err)
+	}
+	result, err := b.client.CallContract(&chain_client.Transaction{To: contract, Data: data, Amount: big.NewInt(0)})
+	if err != nil {
+		return nil, fmt.Errorf("call %s failed, err=%s", method, err)
+	}
+	out, err := parsed.Unpack(method, result)
+	if err != nil {
+		return nil, fmt.Errorf("unpack %s failed, err=%s", method, err)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%s returned nothing", method)
+	}
+	return out, nil
+}
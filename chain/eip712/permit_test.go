@@ -0,0 +1,166 @@
+package eip712
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/h8848/blockchain-infra/chain/chain_client"
+	"github.com/h8848/blockchain-infra/chain/signer"
+)
+
+func TestPermitSignAndVerify(t *testing.T) {
+	want := common.FromHex("0x6e71edae12b1b97f4d1f60370fef10105fa2faae0126114a169c64845d6126c9")
+	if got := TypeHash(PermitTypes, "Permit"); common.Bytes2Hex(got) != common.Bytes2Hex(want) {
+		t.Fatalf("permit typehash=%x", got)
+	}
+
+	key, _ := crypto.GenerateKey()
+	owner, err := signer.NewLocalSigner(key, signer.FamilyEVM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract := common.HexToAddress("0x00000000000000000000000000000000000c0de0")
+	domain := NewDomain("Token", "1", big.NewInt(1), contract)
+
+	// keccak256(abi.encode(DOMAIN_TYPEHASH, keccak256(name), keccak256(version), chainId, contract))
+	domainTypeHash := crypto.Keccak256([]byte("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)"))
+	encoded := append([]byte{}, domainTypeHash...)
+	encoded = append(encoded, crypto.Keccak256([]byte("Token"))...)
+	encoded = append(encoded, crypto.Keccak256([]byte("1"))...)
+	encoded = append(encoded, common.LeftPadBytes([]byte{1}, 32)...)
+	encoded = append(encoded, common.LeftPadBytes(contract.Bytes(), 32)...)
+	separator, err := DomainSeparator(domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if common.Bytes2Hex(separator) != common.Bytes2Hex(crypto.Keccak256(encoded)) {
+		t.Fatalf("domain separator=%x", separator)
+	}
+
+	permit := Permit{
+		Owner:    common.HexToAddress(owner.Address()),
+		Spender:  common.HexToAddress("0x00000000000000000000000000000000000b0b00"),
+		Value:    big.NewInt(1000),
+		Nonce:    big.NewInt(0),
+		Deadline: big.NewInt(1 << 40),
+	}
+	req := &PermitRequest{Permit: permit, Contract: contract, Domain: domain, TypedData: permit.TypedData(domain)}
+	sig, err := req.Sign(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := req.Verify(sig); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := req.CallData(sig); err != nil || len(data) != 4+7*32 {
+		t.Fatalf("calldata len=%d err=%v", len(data), err)
+	}
+
+	req.Permit.Value = big.NewInt(1001)
+	req.TypedData = req.Permit.TypedData(domain)
+	if err := req.Verify(sig); err == nil {
+		t.Fatal("tampered permit verified")
+	}
+}
+
+type fakeToken struct {
+	chain_client.BlockChainClient
+	name      string
+	version   string
+	nonce     *big.Int
+	separator []byte
+	owner     common.Address
+}
+
+func (f *fakeToken) AddressFromString(addr string) (common.Address, error) {
+	if !common.IsHexAddress(addr) {
+		return common.Address{}, fmt.Errorf("invalid address")
+	}
+	return common.HexToAddress(addr), nil
+}
+
+func (f *fakeToken) CallContract(td *chain_client.Transaction) ([]byte, error) {
+	method, err := permitABI.MethodById(td.Data[:4])
+	if err != nil {
+		if method, err = nameABI.MethodById(td.Data[:4]); err != nil {
+			method, err = versionABI.MethodById(td.Data[:4])
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("execution reverted")
+	}
+	switch method.Name {
+	case "nonces":
+		args, err := method.Inputs.Unpack(td.Data[4:])
+		if err != nil || args[0].(common.Address) != f.owner {
+			return nil, fmt.Errorf("unexpected nonces args=%v", args)
+		}
+		return method.Outputs.Pack(f.nonce)
+	case "DOMAIN_SEPARATOR":
+		var separator [32]byte
+		copy(separator[:], f.separator)
+		return method.Outputs.Pack(separator)
+	case "name":
+		return method.Outputs.Pack(f.name)
+	case "version":
+		if f.version == "" {
+			return nil, fmt.Errorf("execution reverted")
+		}
+		return method.Outputs.Pack(f.version)
+	}
+	return nil, fmt.Errorf("execution reverted")
+}
+
+func TestPermitBuilder(t *testing.T) {
+	chainID := big.NewInt(137)
+	contract := common.HexToAddress("0x00000000000000000000000000000000000c0de0")
+	owner := common.HexToAddress("0x00000000000000000000000000000000000a11ce")
+	spender := common.HexToAddress("0x00000000000000000000000000000000000b0b00")
+	separatorOf := func(name, version string) []byte {
+		separator, err := DomainSeparator(NewDomain(name, version, chainID, contract))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return separator
+	}
+	builder := func(token *fakeToken) *PermitBuilder {
+		token.owner, token.nonce = owner, big.NewInt(7)
+		return NewPermitBuilder(token, chainID)
+	}
+
+	cases := []struct {
+		name  string
+		token *fakeToken
+		want  string
+	}{
+		{"version 1 without version()", &fakeToken{name: "Token", separator: separatorOf("Token", "1")}, "1"},
+		{"version 2 without version()", &fakeToken{name: "USD Coin", separator: separatorOf("USD Coin", "2")}, "2"},
+		{"version from version()", &fakeToken{name: "Token", version: "3", separator: separatorOf("Token", "3")}, "3"},
+	}
+	for _, c := range cases {
+		b := builder(c.token)
+		req, err := b.Build(contract.Hex(), owner.Hex(), spender.Hex(), big.NewInt(100), big.NewInt(1<<40))
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if req.Domain.Version != c.want || req.Domain.Name != c.token.name || req.Permit.Nonce.Int64() != 7 || req.Permit.Spender != spender {
+			t.Fatalf("%s: domain=%+v permit=%+v", c.name, req.Domain, req.Permit)
+		}
+		if separator, _ := DomainSeparator(req.Domain); !bytes.Equal(separator, c.token.separator) {
+			t.Fatalf("%s: separator=%x", c.name, separator)
+		}
+	}
+
+	b := builder(&fakeToken{name: "Token", separator: separatorOf("Other", "1")})
+	if _, err := b.Build(contract.Hex(), owner.Hex(), spender.Hex(), big.NewInt(100), big.NewInt(1<<40)); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("err=%v", err)
+	}
+	if _, err := b.Build("bad", owner.Hex(), spender.Hex(), big.NewInt(100), big.NewInt(1<<40)); err == nil {
+		t.Fatal("invalid contract accepted")
+	}
+}
@@ -0,0 +1,95 @@
+package hdwallet
+
+import (
+	"fmt"
+
+	"github.com/h8848/blockchain-infra/chain/chain_client"
+)
+
+// DefaultGapLimit is the BIP-44 address gap limit
+const DefaultGapLimit = 20
+
+// UsageChecker reports whether an address was ever used on chain
+type UsageChecker interface {
+	IsUsed(address string) (bool, error)
+}
+
+// ClientUsageChecker treats an address as used when it has sent a transaction or holds native balance
+// or a balance of one of Tokens. An address that only ever received tokens not listed in Tokens looks unused,
+// so list every token the wallet accepts as deposits or the scan may stop before addresses holding funds
+type ClientUsageChecker struct {
+	Client chain_client.BlockChainClient
+	Tokens []string
+}
+
+func (c *ClientUsageChecker) IsUsed(address string) (bool, error) {
+	nonce, err := c.Client.GetNonce(address)
+	if err != nil {
+		return false, fmt.Errorf("get nonce failed, err=%s", err)
+	}
+	if nonce > 0 {
+		return true, nil
+	}
+	balance, err := c.Client.BalanceAt(address)
+	if err != nil {
+		return false, fmt.Errorf("get balance failed, err=%s", err)
+	}
+	if balance.Sign() > 0 {
+		return true, nil
+	}
+	for _, token := range c.Tokens {
+		balance, err := c.Client.BalanceOf(token, address)
+		if err != nil {
+			return false, fmt.Errorf("get balance of token=%s failed, err=%s", token, err)
+		}
+		if balance.Sign() > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Scan recovers the used addresses of coin following BIP-44 account discovery:
+// addresses of an account are checked until gapLimit unused ones in a row, and accounts are
+// checked in order until one without any used address. gapLimit 0 uses DefaultGapLimit.
+func (w *HDWallet) Scan(coin Coin, checker UsageChecker, gapLimit uint32) ([]*Account, error) {
+	if gapLimit == 0 {
+		gapLimit = DefaultGapLimit
+	}
+	var used []*Account
+	for account := uint32(0); ; account++ {
+		found, err := w.ScanAccount(coin, account, checker, gapLimit)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			return used, nil
+		}
+		used = append(used, found...)
+	}
+}
+
+// ScanAccount returns the used addresses of one account, stopping after gapLimit unused addresses in a row
+func (w *HDWallet) ScanAccount(coin Coin, account uint32, checker UsageChecker, gapLimit uint32) ([]*Account, error) {
+	if gapLimit == 0 {
+		gapLimit = DefaultGapLimit
+	}
+	var used []*Account
+	for index, gap := uint32(0), uint32(0); gap < gapLimit; index++ {
+		acc, err := w.Derive(coin, account, index)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := checker.IsUsed(acc.Address)
+		if err != nil {
+			return nil, fmt.Errorf("check address=%s failed, err=%s", acc.Address, err)
+		}
+		if ok {
+			used = append(used, acc)
+			gap = 0
+		} else {
+			gap++
+		}
+	}
+	return used, nil
+}
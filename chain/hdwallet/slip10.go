@@ -0,0 +1,174 @@
+package hdwallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// HardenedOffset is added to an index for hardened derivation
+const HardenedOffset uint32 = 0x80000000
+
+// Curve is the curve a SLIP-0010 key is derived on
+type Curve string
+
+const (
+	CurveSecp256k1 Curve = "secp256k1"
+	CurveEd25519   Curve = "ed25519"
+)
+
+// seedKey is the HMAC key of the master key, as defined by SLIP-0010
+func (c Curve) seedKey() ([]byte, error) {
+	switch c {
+	case CurveSecp256k1:
+		return []byte("Bitcoin seed"), nil
+	case CurveEd25519:
+		return []byte("ed25519 seed"), nil
+	}
+	return nil, fmt.Errorf("unsupported curve=%s", c)
+}
+
+// Key is a SLIP-0010 extended private key
+// on secp256k1 the derivation is the same as BIP-32, on ed25519 only hardened indexes are allowed
+type Key struct {
+	Curve     Curve
+	Key       []byte
+	ChainCode []byte
+}
+
+// NewMasterKey derives the master key of seed on curve
+func NewMasterKey(curve Curve, seed []byte) (*Key, error) {
+	hmacKey, err := curve.seedKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("seed length=%d, want 16 to 64 bytes", len(seed))
+	}
+	data := seed
+	for {
+		sum := hmacSHA512(hmacKey, data)
+		key := &Key{Curve: curve, Key: sum[:32], ChainCode: sum[32:]}
+		if curve == CurveEd25519 || validSecp256k1(key.Key) {
+			return key, nil
+		}
+		// the key is invalid on secp256k1, SLIP-0010 retries with the output
+		data = sum
+	}
+}
+
+// Derive returns the child key at index, add HardenedOffset for a hardened child
+func (k *Key) Derive(index uint32) (*Key, error) {
+	hardened := index >= HardenedOffset
+	if k.Curve == CurveEd25519 && !hardened {
+		return nil, fmt.Errorf("ed25519 supports hardened derivation only, index=%d", index)
+	}
+	data := make([]byte, 0, 37)
+	if hardened {
+		data = append(data, 0)
+		data = append(data, k.Key...)
+	} else {
+		_, pub := btcec.PrivKeyFromBytes(k.Key)
+		data = append(data, pub.SerializeCompressed()...)
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	for {
+		sum := hmacSHA512(k.ChainCode, data)
+		il, ir := sum[:32], sum[32:]
+		if k.Curve == CurveEd25519 {
+			return &Key{Curve: k.Curve, Key: il, ChainCode: ir}, nil
+		}
+		n := btcec.S256().N
+		child := new(big.Int).SetBytes(il)
+		if child.Cmp(n) < 0 {
+			child.Add(child, new(big.Int).SetBytes(k.Key))
+			child.Mod(child, n)
+			if child.Sign() != 0 {
+				return &Key{Curve: k.Curve, Key: child.FillBytes(make([]byte, 32)), ChainCode: ir}, nil
+			}
+		}
+		// invalid child, SLIP-0010 retries with 0x01 || IR || index
+		data = append([]byte{1}, ir...)
+		data = binary.BigEndian.AppendUint32(data, index)
+	}
+}
+
+// DerivePath derives the key at path such as m/44'/501'/0'/0' from seed
+func DerivePath(curve Curve, seed []byte, path string) (*Key, error) {
+	indexes, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := NewMasterKey(curve, seed)
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range indexes {
+		if key, err = key.Derive(index); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// Ed25519 returns the ed25519 private key, the derived key is its seed
+func (k *Key) Ed25519() (ed25519.PrivateKey, error) {
+	if k.Curve != CurveEd25519 {
+		return nil, fmt.Errorf("key is on curve=%s", k.Curve)
+	}
+	return ed25519.NewKeyFromSeed(k.Key), nil
+}
+
+// ECDSA returns the secp256k1 private key
+func (k *Key) ECDSA() (*ecdsa.PrivateKey, error) {
+	if k.Curve != CurveSecp256k1 {
+		return nil, fmt.Errorf("key is on curve=%s", k.Curve)
+	}
+	return crypto.ToECDSA(k.Key)
+}
+
+// ParsePath parses a derivation path, hardened indexes are marked with ' or h
+func ParsePath(path string) ([]uint32, error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	if len(parts) == 0 || parts[0] != "m" {
+		return nil, fmt.Errorf("derivation path=%s must start with m", path)
+	}
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h") || strings.HasSuffix(part, "H")
+		if hardened {
+			part = part[:len(part)-1]
+		}
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || uint32(n) >= HardenedOffset {
+			return nil, fmt.Errorf("invalid index=%s in derivation path=%s", part, path)
+		}
+		index := uint32(n)
+		if hardened {
+			index += HardenedOffset
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+func hmacSHA512(key, data []byte) []byte {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func validSecp256k1(key []byte) bool {
+	k := new(big.Int).SetBytes(key)
+	return k.Sign() > 0 && k.Cmp(btcec.S256().N) < 0
+}
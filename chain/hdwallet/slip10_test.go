@@ -0,0 +1,50 @@
+package hdwallet
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// test vector 1 of SLIP-0010
+func TestSLIP10Vectors(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	cases := []struct {
+		curve     Curve
+		path      string
+		key       string
+		chainCode string
+	}{
+		{CurveEd25519, "m", "2b4be7f19ee27bbf30c667b642d5f4aa69fd169872f8fc3059c08ebae2eb19e7", "90046a93de5380a72b5e45010748567d5ea02bbf6522f979e05c0d8d8ca9fffb"},
+		{CurveEd25519, "m/0'", "68e0fe46dfb67e368c75379acec591dad19df3cde26e63b93a8e704f1dade7a3", "8b59aa11380b624e81507a27fedda59fea6d0b779a778918a2fd3590e16e9c69"},
+		{CurveEd25519, "m/0'/1'/2'/2'/1000000000'", "8f94d394a8e8fd6b1bc2f3f49f5c47e385281d5c17e65324b0f62483e37e8793", "68789923a0cac2cd5a29172a475fe9e0fb14cd6adb5ad98a3fa70333e7afa230"},
+		{CurveSecp256k1, "m/0'", "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea", "47fdacbd0f1097043b78c63c20c34ef4ed9a111d980047ad16282c7ae6236141"},
+		{CurveSecp256k1, "m/0'/1", "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368", "2a7857631386ba23dacac34180dd1983734e444fdbf774041578e9b6adb37c19"},
+	}
+	for _, c := range cases {
+		key, err := DerivePath(c.curve, seed, c.path)
+		if err != nil {
+			t.Fatalf("%s %s: %v", c.curve, c.path, err)
+		}
+		if hex.EncodeToString(key.Key) != c.key || hex.EncodeToString(key.ChainCode) != c.chainCode {
+			t.Fatalf("%s %s: key=%x chainCode=%x", c.curve, c.path, key.Key, key.ChainCode)
+		}
+	}
+	if _, err := DerivePath(CurveEd25519, seed, "m/0"); err == nil {
+		t.Fatal("non hardened ed25519 derivation accepted")
+	}
+}
+
+func TestLegacySolanaShortScalar(t *testing.T) {
+	// a scalar with a leading zero byte made the legacy derivation panic
+	d, _ := hex.DecodeString("00b2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea")
+	key, err := crypto.ToECDSA(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr := SolanaAddress(LegacySolanaKeyFromSecp256k1((*ecdsa.PrivateKey)(key))); addr == "" {
+		t.Fatal("empty address")
+	}
+}
@@ -0,0 +1,80 @@
+package hdwallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"fmt"
+
+	"github.com/mr-tron/base58"
+)
+
+// SolanaDefaultPath is the derivation path used by Phantom and the Solana CLI for the first account
+const SolanaDefaultPath = "m/44'/501'/0'/0'"
+
+// SolanaPath returns the path of account, m/44'/501'/account'/0'
+func SolanaPath(account uint32) string {
+	return fmt.Sprintf("m/44'/501'/%d'/0'", account)
+}
+
+// SolanaKey derives the Solana key at path from a BIP-39 seed with SLIP-0010
+func SolanaKey(seed []byte, path string) (ed25519.PrivateKey, error) {
+	key, err := DerivePath(CurveEd25519, seed, path)
+	if err != nil {
+		return nil, err
+	}
+	return key.Ed25519()
+}
+
+// SolanaAddress is the base58 encoded public key
+func SolanaAddress(key ed25519.PrivateKey) string {
+	return base58.Encode(key.Public().(ed25519.PublicKey))
+}
+
+// LegacySolanaKeyFromSecp256k1 is the derivation used before SLIP-0010 support:
+// the secp256k1 private scalar is used as the ed25519 seed.
+// It is kept only to find the addresses created that way, new keys must come from SolanaKey.
+// The scalar is left padded to 32 bytes, which gives the same keys as before for every key that
+// did not panic, since a shorter scalar could never be used as a seed.
+func LegacySolanaKeyFromSecp256k1(key *ecdsa.PrivateKey) ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed(key.D.FillBytes(make([]byte, ed25519.SeedSize)))
+}
+
+// SolanaMigration maps an address of the legacy derivation to the SLIP-0010 address of the same account
+type SolanaMigration struct {
+	Account    uint32
+	LegacyPath string
+	OldAddress string
+	NewPath    string
+	NewAddress string
+}
+
+// MigrateSolana derives both addresses for accounts start to start+count-1.
+// legacyPathFormat is the secp256k1 path the legacy keys were derived from, with %d for the account,
+// such as "m/44'/60'/0'/0/%d". The new address uses SolanaPath(account).
+func MigrateSolana(seed []byte, legacyPathFormat string, start, count uint32) ([]SolanaMigration, error) {
+	list := make([]SolanaMigration, 0, count)
+	for account := start; account < start+count; account++ {
+		legacyPath := fmt.Sprintf(legacyPathFormat, account)
+		secp, err := DerivePath(CurveSecp256k1, seed, legacyPath)
+		if err != nil {
+			return nil, err
+		}
+		ecKey, err := secp.ECDSA()
+		if err != nil {
+			return nil, err
+		}
+		newPath := SolanaPath(account)
+		newKey, err := SolanaKey(seed, newPath)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, SolanaMigration{
+			Account:    account,
+			LegacyPath: legacyPath,
+			OldAddress: SolanaAddress(LegacySolanaKeyFromSecp256k1(ecKey)),
+			NewPath:    newPath,
+			NewAddress: SolanaAddress(newKey),
+		})
+	}
+	return list, nil
+}
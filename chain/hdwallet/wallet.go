@@ -0,0 +1,285 @@
+package hdwallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"fmt"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/fbsobreira/gotron-sdk/pkg/address"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// Coin is a chain supported by the wallet
+type Coin string
+
+const (
+	CoinETH  Coin = "ETH"
+	CoinTRON Coin = "TRON"
+	CoinSOL  Coin = "SOL"
+	CoinBTC  Coin = "BTC"
+)
+
+// Path returns the standard derivation path of coin:
+//
+//	ETH  m/44'/60'/account'/0/index   (BIP-44)
+//	TRON m/44'/195'/account'/0/index  (BIP-44)
+//	BTC  m/84'/0'/account'/0/index    (BIP-84, native segwit, HDWallet uses coin type 1' on test networks)
+//	SOL  m/44'/501'/account'/index'   (SLIP-0010, all hardened)
+func (c Coin) Path(account, index uint32) (string, error) {
+	switch c {
+	case CoinETH:
+		return fmt.Sprintf("m/44'/60'/%d'/0/%d", account, index), nil
+	case CoinTRON:
+		return fmt.Sprintf("m/44'/195'/%d'/0/%d", account, index), nil
+	case CoinBTC:
+		return fmt.Sprintf("m/84'/0'/%d'/0/%d", account, index), nil
+	case CoinSOL:
+		return fmt.Sprintf("m/44'/501'/%d'/%d'", account, index), nil
+	}
+	return "", fmt.Errorf("unsupported coin=%s", c)
+}
+
+// AccountPath returns the hardened account level path, which is the parent of the xpub
+func (c Coin) AccountPath(account uint32) (string, error) {
+	switch c {
+	case CoinETH:
+		return fmt.Sprintf("m/44'/60'/%d'", account), nil
+	case CoinTRON:
+		return fmt.Sprintf("m/44'/195'/%d'", account), nil
+	case CoinBTC:
+		return fmt.Sprintf("m/84'/0'/%d'", account), nil
+	}
+	return "", fmt.Errorf("coin=%s has no extended public key", c)
+}
+
+// Account is a derived address
+type Account struct {
+	Coin      Coin
+	Account   uint32
+	Index     uint32
+	Path      string
+	Address   string
+	PublicKey []byte
+}
+
+// HDWallet derives keys of several chains from one BIP-39 mnemonic
+// the seed and master keys are computed once, BTCNet selects the bitcoin network, default mainnet
+type HDWallet struct {
+	BTCNet *chaincfg.Params
+
+	seed []byte
+
+	mu       sync.Mutex
+	secp     *hdkeychain.ExtendedKey
+	ed25519  *Key
+	accounts map[string]*hdkeychain.ExtendedKey
+}
+
+// NewHDWallet creates the wallet from a mnemonic and an optional BIP-39 passphrase
+func NewHDWallet(mnemonic, passphrase string) (*HDWallet, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mnemonic, err=%s", err)
+	}
+	return NewHDWalletFromSeed(seed)
+}
+
+// NewHDWalletFromSeed creates the wallet from a BIP-39 seed
+func NewHDWalletFromSeed(seed []byte) (*HDWallet, error) {
+	if len(seed) < hdkeychain.MinSeedBytes || len(seed) > hdkeychain.MaxSeedBytes {
+		return nil, fmt.Errorf("seed length=%d, want %d to %d bytes", len(seed), hdkeychain.MinSeedBytes, hdkeychain.MaxSeedBytes)
+	}
+	return &HDWallet{
+		BTCNet:   &chaincfg.MainNetParams,
+		seed:     append([]byte(nil), seed...),
+		accounts: make(map[string]*hdkeychain.ExtendedKey),
+	}, nil
+}
+
+func (w *HDWallet) secpMaster() (*hdkeychain.ExtendedKey, error) {
+	if w.secp != nil {
+		return w.secp, nil
+	}
+	master, err := hdkeychain.NewMaster(w.seed, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, fmt.Errorf("create master key failed, err=%s", err)
+	}
+	w.secp = master
+	return master, nil
+}
+
+func (w *HDWallet) edMaster() (*Key, error) {
+	if w.ed25519 != nil {
+		return w.ed25519, nil
+	}
+	master, err := NewMasterKey(CurveEd25519, w.seed)
+	if err != nil {
+		return nil, err
+	}
+	w.ed25519 = master
+	return master, nil
+}
+
+// extendedKey derives path from the secp256k1 master, hardened account keys are cached
+func (w *HDWallet) extendedKey(path string) (*hdkeychain.ExtendedKey, error) {
+	indexes, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	key, err := w.secpMaster()
+	if err != nil {
+		return nil, err
+	}
+	// the first three levels are the hardened purpose, coin and account
+	start := 0
+	prefix := ""
+	if len(indexes) >= 3 {
+		prefix = fmt.Sprint(indexes[:3])
+		if cached, ok := w.accounts[prefix]; ok {
+			key, start = cached, 3
+		}
+	}
+	for i := start; i < len(indexes); i++ {
+		if key, err = key.Derive(indexes[i]); err != nil {
+			return nil, fmt.Errorf("derive %s failed, err=%s", path, err)
+		}
+		if i == 2 && prefix != "" {
+			w.accounts[prefix] = key
+		}
+	}
+	return key, nil
+}
+
+// ECDSAKey returns the secp256k1 private key at path
+func (w *HDWallet) ECDSAKey(path string) (*ecdsa.PrivateKey, error) {
+	key, err := w.extendedKey(path)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := key.ECPrivKey()
+	if err != nil {
+		return nil, err
+	}
+	return priv.ToECDSA(), nil
+}
+
+// Ed25519Key returns the ed25519 private key at path, derived with SLIP-0010
+func (w *HDWallet) Ed25519Key(path string) (ed25519.PrivateKey, error) {
+	indexes, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	w.mu.Lock()
+	key, err := w.edMaster()
+	w.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range indexes {
+		if key, err = key.Derive(index); err != nil {
+			return nil, err
+		}
+	}
+	return key.Ed25519()
+}
+
+// Derive returns the address of coin at the standard path for account and index
+func (w *HDWallet) Derive(coin Coin, account, index uint32) (*Account, error) {
+	path, err := coin.Path(account, index)
+	if w.btcTestnet(coin) {
+		path = fmt.Sprintf("m/84'/1'/%d'/0/%d", account, index)
+	}
+	if err != nil {
+		return nil, err
+	}
+	acc, err := w.DerivePath(coin, path)
+	if err != nil {
+		return nil, err
+	}
+	acc.Account, acc.Index = account, index
+	return acc, nil
+}
+
+// DerivePath returns the address of coin at a custom path
+func (w *HDWallet) DerivePath(coin Coin, path string) (*Account, error) {
+	acc := &Account{Coin: coin, Path: path}
+	if coin == CoinSOL {
+		key, err := w.Ed25519Key(path)
+		if err != nil {
+			return nil, err
+		}
+		acc.PublicKey = key.Public().(ed25519.PublicKey)
+		acc.Address = SolanaAddress(key)
+		return acc, nil
+	}
+	key, err := w.extendedKey(path)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := key.ECPubKey()
+	if err != nil {
+		return nil, err
+	}
+	acc.PublicKey = pub.SerializeCompressed()
+	acc.Address, err = PublicKeyAddress(coin, pub.ToECDSA(), w.BTCNet)
+	if err != nil {
+		return nil, err
+	}
+	return acc, nil
+}
+
+// PublicKeyAddress returns the address of a secp256k1 public key, BTC addresses are P2WPKH on btcNet
+func PublicKeyAddress(coin Coin, pub *ecdsa.PublicKey, btcNet *chaincfg.Params) (string, error) {
+	switch coin {
+	case CoinETH:
+		return crypto.PubkeyToAddress(*pub).Hex(), nil
+	case CoinTRON:
+		return address.PubkeyToAddress(*pub).String(), nil
+	case CoinBTC:
+		addr, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(crypto.CompressPubkey(pub)), btcNet)
+		if err != nil {
+			return "", err
+		}
+		return addr.EncodeAddress(), nil
+	}
+	return "", fmt.Errorf("unsupported coin=%s", coin)
+}
+
+// btcTestnet reports whether coin is BTC on a test network, which uses the BIP-44 coin type 1'
+func (w *HDWallet) btcTestnet(coin Coin) bool {
+	return coin == CoinBTC && w.BTCNet != nil && w.BTCNet.Net != chaincfg.MainNetParams.Net
+}
+
+// ExtendedPublicKey exports the account level xpub of coin for watch-only derivation of account'/0/index
+// the standard BIP-32 version is used for every coin, BTC on a test network exports a tpub,
+// SOL has no xpub since ed25519 only derives hardened keys
+func (w *HDWallet) ExtendedPublicKey(coin Coin, account uint32) (string, error) {
+	path, err := coin.AccountPath(account)
+	if err != nil {
+		return "", err
+	}
+	if w.btcTestnet(coin) {
+		path = fmt.Sprintf("m/84'/1'/%d'", account)
+	}
+	key, err := w.extendedKey(path)
+	if err != nil {
+		return "", err
+	}
+	pub, err := key.Neuter()
+	if err != nil {
+		return "", err
+	}
+	if coin == CoinBTC && w.BTCNet != nil {
+		if pub, err = pub.CloneWithVersion(w.BTCNet.HDPublicKeyID[:]); err != nil {
+			return "", err
+		}
+	}
+	return pub.String(), nil
+}
@@ -0,0 +1,122 @@
+package hdwallet
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/h8848/blockchain-infra/chain/chain_client"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func TestHDWalletDerive(t *testing.T) {
+	w, err := NewHDWallet(testMnemonic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[Coin]string{
+		CoinETH: "0x9858EfFD232B4033E47d90003D41EC34EcaEda94",
+		CoinBTC: "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu",
+	}
+	for coin, want := range cases {
+		acc, err := w.Derive(coin, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if acc.Address != want {
+			t.Fatalf("%s address=%s, want %s", coin, acc.Address, want)
+		}
+	}
+
+	// the xpub derives the same addresses without the private key
+	xpub, err := w.ExtendedPublicKey(CoinETH, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := hdkeychain.NewKeyFromString(xpub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, _ := pub.Derive(0)
+	child, _ = child.Derive(3)
+	ecPub, _ := child.ECPubKey()
+	acc, _ := w.Derive(CoinETH, 0, 3)
+	if addr, _ := PublicKeyAddress(CoinETH, ecPub.ToECDSA(), nil); addr != acc.Address {
+		t.Fatalf("xpub address=%s, want %s", addr, acc.Address)
+	}
+	if _, err := w.ExtendedPublicKey(CoinSOL, 0); err == nil {
+		t.Fatal("sol xpub exported")
+	}
+
+	withPassphrase, _ := NewHDWallet(testMnemonic, "TREZOR")
+	other, _ := withPassphrase.Derive(CoinETH, 0, 0)
+	if other.Address == cases[CoinETH] {
+		t.Fatal("passphrase ignored")
+	}
+	w.BTCNet = &chaincfg.TestNet3Params
+	testAcc, _ := w.Derive(CoinBTC, 0, 0)
+	if testAcc.Address[:3] != "tb1" || testAcc.Path != "m/84'/1'/0'/0/0" {
+		t.Fatalf("testnet address=%s path=%s", testAcc.Address, testAcc.Path)
+	}
+	// the testnet tpub derives the same addresses
+	tpub, err := w.ExtendedPublicKey(CoinBTC, 0)
+	if err != nil || tpub[:4] != "tpub" {
+		t.Fatalf("tpub=%s, err=%v", tpub, err)
+	}
+	key, _ := hdkeychain.NewKeyFromString(tpub)
+	key, _ = key.Derive(0)
+	key, _ = key.Derive(0)
+	ecPub, _ = key.ECPubKey()
+	if addr, _ := PublicKeyAddress(CoinBTC, ecPub.ToECDSA(), w.BTCNet); addr != testAcc.Address {
+		t.Fatalf("tpub address=%s, want %s", addr, testAcc.Address)
+	}
+}
+
+type usedSet map[string]bool
+
+func (u usedSet) IsUsed(address string) (bool, error) {
+	return u[address], nil
+}
+
+func TestHDWalletScan(t *testing.T) {
+	w, _ := NewHDWallet(testMnemonic, "")
+	used := usedSet{}
+	for _, pos := range [][2]uint32{{0, 0}, {0, 4}, {1, 2}, {3, 0}} {
+		acc, _ := w.Derive(CoinTRON, pos[0], pos[1])
+		used[acc.Address] = true
+	}
+	found, err := w.Scan(CoinTRON, used, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// account 2 is empty so account 3 is not discovered
+	if len(found) != 3 || found[1].Index != 4 || found[2].Account != 1 {
+		t.Fatalf("found=%d accounts", len(found))
+	}
+}
+
+type tokenOnlyClient struct {
+	chain_client.BlockChainClient
+	balances map[string]int64
+}
+
+func (c *tokenOnlyClient) GetNonce(string) (uint64, error) { return 0, nil }
+
+func (c *tokenOnlyClient) BalanceAt(string) (*big.Int, error) { return big.NewInt(0), nil }
+
+func (c *tokenOnlyClient) BalanceOf(contract, from string) (*big.Int, error) {
+	return big.NewInt(c.balances[contract+from]), nil
+}
+
+func TestClientUsageCheckerTokens(t *testing.T) {
+	// a deposit address that only received USDT
+	client := &tokenOnlyClient{balances: map[string]int64{"usdt0xA": 5}}
+	if used, _ := (&ClientUsageChecker{Client: client}).IsUsed("0xA"); used {
+		t.Fatal("used without a token list")
+	}
+	if used, err := (&ClientUsageChecker{Client: client, Tokens: []string{"dai", "usdt"}}).IsUsed("0xA"); err != nil || !used {
+		t.Fatalf("used=%v, err=%v", used, err)
+	}
+}
@@ -0,0 +1,267 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Kind is the kind of key material of an entry
+type Kind string
+
+const (
+	// KindPrivateKey is a secp256k1 private key stored in the Ethereum keystore v3 format
+	KindPrivateKey Kind = "private_key"
+	KindMnemonic   Kind = "mnemonic"
+	// KindSecret is any other secret, such as an ed25519 seed
+	KindSecret Kind = "secret"
+)
+
+// KDF is the key derivation function of the secret format
+type KDF string
+
+const (
+	KDFScrypt   KDF = "scrypt"
+	KDFArgon2id KDF = "argon2id"
+)
+
+// secretVersion is the version of the secret format, version 3 is the Ethereum keystore format
+//
+// The secret format is
+//
+//	{
+//	  "version": 1,
+//	  "id": "entry id",
+//	  "kind": "mnemonic",
+//	  "crypto": {
+//	    "cipher": "aes-256-gcm",
+//	    "ciphertext": "hex",
+//	    "cipherparams": {"nonce": "hex"},
+//	    "kdf": "scrypt",
+//	    "kdfparams": {"n": 262144, "r": 8, "p": 1, "dklen": 32, "salt": "hex"}
+//	  }
+//	}
+//
+// argon2id uses the kdfparams {"time", "memory" in KiB, "threads", "dklen", "salt"}.
+// The additional data of the GCM seal is "version:kind:id", so an entry cannot be renamed.
+const secretVersion = 1
+
+// kdf params are read from the file, the maxima stop a crafted entry from exhausting memory or cpu
+const (
+	maxScryptN       = 1 << 20
+	maxScryptR       = 32
+	maxScryptP       = 16
+	maxScryptMemory  = 2 << 30 // 128 * N * r bytes
+	maxArgon2Time    = 16
+	maxArgon2Memory  = 4 * 1024 * 1024 // KiB
+	maxArgon2Threads = 64
+	maxPBKDF2Rounds  = 10_000_000
+)
+
+type secretJSON struct {
+	Version int        `json:"version"`
+	ID      string     `json:"id"`
+	Kind    Kind       `json:"kind"`
+	Address string     `json:"address,omitempty"`
+	Crypto  cryptoJSON `json:"crypto"`
+}
+
+type cryptoJSON struct {
+	Cipher       string       `json:"cipher"`
+	CipherText   string       `json:"ciphertext"`
+	CipherParams cipherParams `json:"cipherparams"`
+	KDF          KDF          `json:"kdf"`
+	KDFParams    kdfParams    `json:"kdfparams"`
+}
+
+type cipherParams struct {
+	Nonce string `json:"nonce"`
+}
+
+type kdfParams struct {
+	N       int    `json:"n,omitempty"`
+	R       int    `json:"r,omitempty"`
+	P       int    `json:"p,omitempty"`
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"`
+	Threads uint8  `json:"threads,omitempty"`
+	DKLen   int    `json:"dklen"`
+	Salt    string `json:"salt"`
+}
+
+// header is the part of an entry that is read without the passphrase
+type header struct {
+	Version int    `json:"version"`
+	ID      string `json:"id"`
+	Kind    Kind   `json:"kind"`
+	Address string `json:"address"`
+}
+
+func encryptSecret(conf *Config, id string, kind Kind, address string, secret []byte, pass string) ([]byte, error) {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	params := kdfParams{DKLen: 32, Salt: hex.EncodeToString(salt)}
+	switch conf.KDF {
+	case KDFScrypt:
+		params.N, params.R, params.P = conf.ScryptN, 8, conf.ScryptP
+	case KDFArgon2id:
+		params.Time, params.Memory, params.Threads = conf.Argon2Time, conf.Argon2Memory, conf.Argon2Threads
+	default:
+		return nil, fmt.Errorf("unsupported kdf=%s", conf.KDF)
+	}
+	key, err := deriveKey(conf.KDF, params, salt, pass)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := gcm.Seal(nil, nonce, secret, additionalData(id, kind))
+	return json.Marshal(&secretJSON{
+		Version: secretVersion,
+		ID:      id,
+		Kind:    kind,
+		Address: address,
+		Crypto: cryptoJSON{
+			Cipher:       "aes-256-gcm",
+			CipherText:   hex.EncodeToString(sealed),
+			CipherParams: cipherParams{Nonce: hex.EncodeToString(nonce)},
+			KDF:          conf.KDF,
+			KDFParams:    params,
+		},
+	})
+}
+
+// decryptSecret opens the entry stored under id, an entry copied to another id does not open
+func decryptSecret(id string, data []byte, pass string) (*secretJSON, []byte, error) {
+	var entry secretJSON
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, nil, fmt.Errorf("decode entry failed, err=%s", err)
+	}
+	if entry.Version != secretVersion || entry.Crypto.Cipher != "aes-256-gcm" {
+		return nil, nil, fmt.Errorf("unsupported entry version=%d, cipher=%s", entry.Version, entry.Crypto.Cipher)
+	}
+	salt, err := hex.DecodeString(entry.Crypto.KDFParams.Salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce, err := hex.DecodeString(entry.Crypto.CipherParams.Nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	sealed, err := hex.DecodeString(entry.Crypto.CipherText)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := deriveKey(entry.Crypto.KDF, entry.Crypto.KDFParams, salt, pass)
+	if err != nil {
+		return nil, nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, nil, fmt.Errorf("invalid nonce size=%d", len(nonce))
+	}
+	secret, err := gcm.Open(nil, nonce, sealed, additionalData(id, entry.Kind))
+	if err != nil {
+		return nil, nil, ErrDecrypt
+	}
+	return &entry, secret, nil
+}
+
+func deriveKey(kdf KDF, p kdfParams, salt []byte, pass string) ([]byte, error) {
+	if p.DKLen != 32 {
+		return nil, fmt.Errorf("unsupported dklen=%d", p.DKLen)
+	}
+	switch kdf {
+	case KDFScrypt:
+		if err := checkScrypt(p); err != nil {
+			return nil, err
+		}
+		key, err := scrypt.Key([]byte(pass), salt, p.N, p.R, p.P, p.DKLen)
+		if err != nil {
+			return nil, fmt.Errorf("scrypt failed, err=%s", err)
+		}
+		return key, nil
+	case KDFArgon2id:
+		if p.Time == 0 || p.Memory == 0 || p.Threads == 0 {
+			return nil, fmt.Errorf("invalid argon2id params")
+		}
+		if p.Time > maxArgon2Time || p.Memory > maxArgon2Memory || p.Threads > maxArgon2Threads {
+			return nil, fmt.Errorf("argon2id params time=%d memory=%d threads=%d are out of range", p.Time, p.Memory, p.Threads)
+		}
+		return argon2.IDKey([]byte(pass), salt, p.Time, p.Memory, p.Threads, uint32(p.DKLen)), nil
+	}
+	return nil, fmt.Errorf("unsupported kdf=%s", kdf)
+}
+
+func checkScrypt(p kdfParams) error {
+	if p.N <= 1 || p.N > maxScryptN || p.R <= 0 || p.R > maxScryptR || p.P <= 0 || p.P > maxScryptP ||
+		128*p.N*p.R > maxScryptMemory {
+		return fmt.Errorf("scrypt params n=%d r=%d p=%d are out of range", p.N, p.R, p.P)
+	}
+	return nil
+}
+
+// v3JSON is the part of a keystore v3 file that is checked before it is passed to go-ethereum
+type v3JSON struct {
+	Crypto struct {
+		KDF       string          `json:"kdf"`
+		KDFParams json.RawMessage `json:"kdfparams"`
+	} `json:"crypto"`
+}
+
+// checkV3Params applies the kdf maxima to a keystore v3 file, go-ethereum uses any params from the file
+func checkV3Params(data []byte) error {
+	var v v3JSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("parse keystore v3 failed, err=%s", err)
+	}
+	switch v.Crypto.KDF {
+	case "scrypt":
+		var p kdfParams
+		if err := json.Unmarshal(v.Crypto.KDFParams, &p); err != nil {
+			return fmt.Errorf("parse scrypt params failed, err=%s", err)
+		}
+		return checkScrypt(p)
+	case "pbkdf2":
+		var p struct {
+			C int `json:"c"`
+		}
+		if err := json.Unmarshal(v.Crypto.KDFParams, &p); err != nil {
+			return fmt.Errorf("parse pbkdf2 params failed, err=%s", err)
+		}
+		if p.C <= 0 || p.C > maxPBKDF2Rounds {
+			return fmt.Errorf("pbkdf2 rounds c=%d are out of range", p.C)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported kdf=%s", v.Crypto.KDF)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func additionalData(id string, kind Kind) []byte {
+	return []byte(fmt.Sprintf("%d:%s:%s", secretVersion, kind, id))
+}
@@ -0,0 +1,225 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotFound is returned for unknown entry ids
+	ErrNotFound = errors.New("keystore entry not found")
+	// ErrDecrypt is returned for a wrong passphrase or a tampered entry
+	ErrDecrypt = errors.New("could not decrypt keystore entry with the given passphrase")
+)
+
+// Config is the config of the keystore
+// private keys always use scrypt as required by the Ethereum keystore v3 format,
+// KDF only selects the derivation of mnemonics and secrets
+type Config struct {
+	KDF           KDF
+	ScryptN       int
+	ScryptP       int
+	Argon2Time    uint32
+	Argon2Memory  uint32
+	Argon2Threads uint8
+}
+
+// DefaultConfig uses the standard go-ethereum scrypt parameters and the RFC 9106 argon2id recommendation
+func DefaultConfig() *Config {
+	return &Config{
+		KDF:           KDFScrypt,
+		ScryptN:       keystore.StandardScryptN,
+		ScryptP:       keystore.StandardScryptP,
+		Argon2Time:    1,
+		Argon2Memory:  2 * 1024 * 1024,
+		Argon2Threads: 4,
+	}
+}
+
+// Entry describes a stored entry without its key material
+type Entry struct {
+	ID      string
+	Kind    Kind
+	Address string
+}
+
+// Keystore encrypts key material at rest in a Storage
+type Keystore struct {
+	conf    Config
+	storage Storage
+}
+
+func New(storage Storage, conf *Config) *Keystore {
+	if conf == nil {
+		conf = DefaultConfig()
+	}
+	return &Keystore{conf: *conf, storage: storage}
+}
+
+// PutPrivateKey stores key in the Ethereum keystore v3 format, the id defaults to the lower case hex address
+func (k *Keystore) PutPrivateKey(id string, key *ecdsa.PrivateKey, pass string) (*Entry, error) {
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	if id == "" {
+		id = strings.ToLower(address.Hex())
+	}
+	data, err := keystore.EncryptKey(&keystore.Key{Id: uuid.New(), Address: address, PrivateKey: key}, pass, k.conf.ScryptN, k.conf.ScryptP)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt private key failed, err=%s", err)
+	}
+	if err := k.storage.Put(id, data); err != nil {
+		return nil, err
+	}
+	return &Entry{ID: id, Kind: KindPrivateKey, Address: address.Hex()}, nil
+}
+
+// PutMnemonic stores a mnemonic in the secret format
+func (k *Keystore) PutMnemonic(id, mnemonic, pass string) (*Entry, error) {
+	return k.PutSecret(id, KindMnemonic, "", []byte(mnemonic), pass)
+}
+
+// PutSecret stores secret in the secret format, address is optional plain metadata
+func (k *Keystore) PutSecret(id string, kind Kind, address string, secret []byte, pass string) (*Entry, error) {
+	if id == "" {
+		return nil, fmt.Errorf("id cannot be empty")
+	}
+	if kind == KindPrivateKey {
+		return nil, fmt.Errorf("use PutPrivateKey for secp256k1 private keys")
+	}
+	data, err := encryptSecret(&k.conf, id, kind, address, secret, pass)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt secret failed, err=%s", err)
+	}
+	if err := k.storage.Put(id, data); err != nil {
+		return nil, err
+	}
+	return &Entry{ID: id, Kind: kind, Address: address}, nil
+}
+
+// GetPrivateKey decrypts a private key entry
+func (k *Keystore) GetPrivateKey(id, pass string) (*ecdsa.PrivateKey, error) {
+	data, err := k.storage.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkV3Params(data); err != nil {
+		return nil, err
+	}
+	key, err := keystore.DecryptKey(data, pass)
+	if errors.Is(err, keystore.ErrDecrypt) {
+		return nil, ErrDecrypt
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decrypt private key failed, err=%s", err)
+	}
+	return key.PrivateKey, nil
+}
+
+// GetMnemonic decrypts a mnemonic entry
+func (k *Keystore) GetMnemonic(id, pass string) (string, error) {
+	secret, err := k.GetSecret(id, KindMnemonic, pass)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// GetSecret decrypts an entry of the secret format and checks its kind
+func (k *Keystore) GetSecret(id string, kind Kind, pass string) ([]byte, error) {
+	data, err := k.storage.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	entry, secret, err := decryptSecret(id, data, pass)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Kind != kind {
+		return nil, fmt.Errorf("entry %s is a %s, not a %s", id, entry.Kind, kind)
+	}
+	return secret, nil
+}
+
+// List returns the entries without decrypting them
+func (k *Keystore) List() ([]*Entry, error) {
+	ids, err := k.storage.List()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ids)
+	list := make([]*Entry, 0, len(ids))
+	for _, id := range ids {
+		data, err := k.storage.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		var h header
+		if err := json.Unmarshal(data, &h); err != nil {
+			return nil, fmt.Errorf("decode entry %s failed, err=%s", id, err)
+		}
+		entry := &Entry{ID: id, Kind: h.Kind, Address: h.Address}
+		if h.Version == 3 {
+			entry.Kind = KindPrivateKey
+			entry.Address = common.HexToAddress(h.Address).Hex()
+		}
+		list = append(list, entry)
+	}
+	return list, nil
+}
+
+// Delete removes an entry
+func (k *Keystore) Delete(id string) error {
+	return k.storage.Delete(id)
+}
+
+// Rotate re-encrypts an entry with newPass and the current config
+func (k *Keystore) Rotate(id, oldPass, newPass string) error {
+	data, err := k.storage.Get(id)
+	if err != nil {
+		return err
+	}
+	var h header
+	if err := json.Unmarshal(data, &h); err != nil {
+		return fmt.Errorf("decode entry %s failed, err=%s", id, err)
+	}
+	if h.Version == 3 {
+		key, err := k.GetPrivateKey(id, oldPass)
+		if err != nil {
+			return err
+		}
+		_, err = k.PutPrivateKey(id, key, newPass)
+		return err
+	}
+	entry, secret, err := decryptSecret(id, data, oldPass)
+	if err != nil {
+		return err
+	}
+	_, err = k.PutSecret(id, entry.Kind, entry.Address, secret, newPass)
+	return err
+}
+
+// RotateAll re-encrypts every entry, it stops at the first entry that cannot be rotated
+// and returns the ids already rotated so a failed run can be resumed
+func (k *Keystore) RotateAll(oldPass, newPass string) ([]string, error) {
+	ids, err := k.storage.List()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ids)
+	var done []string
+	for _, id := range ids {
+		if err := k.Rotate(id, oldPass, newPass); err != nil {
+			return done, fmt.Errorf("rotate %s failed, err=%s", id, err)
+		}
+		done = append(done, id)
+	}
+	return done, nil
+}
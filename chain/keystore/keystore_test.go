@@ -0,0 +1,126 @@
+package keystore
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func testConfig(kdf KDF) *Config {
+	return &Config{
+		KDF:           kdf,
+		ScryptN:       keystore.LightScryptN,
+		ScryptP:       keystore.LightScryptP,
+		Argon2Time:    1,
+		Argon2Memory:  8 * 1024,
+		Argon2Threads: 1,
+	}
+}
+
+func TestKeystore(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := New(storage, testConfig(KDFArgon2id))
+
+	key, _ := crypto.GenerateKey()
+	entry, err := ks.PutPrivateKey("", key, "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the file is a standard v3 keystore
+	data, _ := os.ReadFile(filepath.Join(dir, entry.ID+".json"))
+	v3, err := keystore.DecryptKey(data, "pass")
+	if err != nil || v3.Address != crypto.PubkeyToAddress(key.PublicKey) {
+		t.Fatalf("not a v3 keystore, err=%v", err)
+	}
+
+	const mnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	if _, err := ks.PutMnemonic("main", mnemonic, "pass"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.GetMnemonic("main", "wrong"); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("wrong passphrase err=%v", err)
+	}
+	if _, err := ks.GetSecret("main", KindSecret, "pass"); err == nil {
+		t.Fatal("kind not checked")
+	}
+	// an entry cannot be moved to another id
+	moved, _ := storage.Get("main")
+	_ = storage.Put("other", moved)
+	if _, err := ks.GetMnemonic("other", "pass"); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("renamed entry err=%v", err)
+	}
+	_ = ks.Delete("other")
+
+	list, _ := ks.List()
+	if len(list) != 2 || list[0].Kind != KindPrivateKey || list[0].Address != entry.Address || list[1].Kind != KindMnemonic {
+		t.Fatalf("list=%+v", list)
+	}
+
+	ks.conf.KDF = KDFScrypt
+	if done, err := ks.RotateAll("pass", "new"); err != nil || len(done) != 2 {
+		t.Fatalf("rotate done=%v, err=%v", done, err)
+	}
+	if got, err := ks.GetMnemonic("main", "new"); err != nil || got != mnemonic {
+		t.Fatalf("mnemonic=%s, err=%v", got, err)
+	}
+	got, err := ks.GetPrivateKey(entry.ID, "new")
+	if err != nil || got.D.Cmp(key.D) != 0 {
+		t.Fatalf("private key mismatch, err=%v", err)
+	}
+	if _, err := ks.GetPrivateKey(entry.ID, "pass"); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("old passphrase err=%v", err)
+	}
+	if _, err := storage.Get("../main"); err == nil {
+		t.Fatal("path traversal allowed")
+	}
+}
+
+func TestDeriveKeyLimits(t *testing.T) {
+	salt := make([]byte, 32)
+	for _, c := range []struct {
+		kdf KDF
+		p   kdfParams
+	}{
+		{KDFScrypt, kdfParams{N: 1 << 30, R: 8, P: 1, DKLen: 32}},
+		{KDFScrypt, kdfParams{N: 1 << 20, R: 32, P: 1, DKLen: 32}},
+		{KDFScrypt, kdfParams{N: 1 << 10, R: 8, P: 1 << 20, DKLen: 32}},
+		{KDFArgon2id, kdfParams{Time: 1, Memory: 1 << 31, Threads: 1, DKLen: 32}},
+		{KDFArgon2id, kdfParams{Time: 1 << 20, Memory: 8, Threads: 1, DKLen: 32}},
+		{KDFArgon2id, kdfParams{Time: 1, Memory: 8, Threads: 255, DKLen: 32}},
+	} {
+		if _, err := deriveKey(c.kdf, c.p, salt, "pass"); err == nil {
+			t.Fatalf("%s params %+v accepted", c.kdf, c.p)
+		}
+	}
+	if _, err := deriveKey(KDFScrypt, kdfParams{N: keystore.LightScryptN, R: 8, P: keystore.LightScryptP, DKLen: 32}, salt, "pass"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a v3 private key entry is checked before go-ethereum derives the key
+	storage, _ := NewFileStorage(t.TempDir())
+	ks := New(storage, testConfig(KDFScrypt))
+	key, _ := crypto.GenerateKey()
+	entry, err := ks.PutPrivateKey("", key, "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := storage.Get(entry.ID)
+	var v3 map[string]interface{}
+	_ = json.Unmarshal(data, &v3)
+	v3["crypto"].(map[string]interface{})["kdfparams"].(map[string]interface{})["n"] = 1 << 30
+	data, _ = json.Marshal(v3)
+	_ = storage.Put(entry.ID, data)
+	if _, err := ks.GetPrivateKey(entry.ID, "pass"); err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Fatalf("crafted v3 entry err=%v", err)
+	}
+}
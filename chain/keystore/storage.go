@@ -0,0 +1,169 @@
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/h8848/blockchain-infra/pkg/xgorm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Storage keeps the encrypted entries, Get returns ErrNotFound for unknown ids
+type Storage interface {
+	Get(id string) ([]byte, error)
+	Put(id string, data []byte) error
+	List() ([]string, error)
+	Delete(id string) error
+}
+
+// FileStorage keeps one id.json file per entry in a directory
+type FileStorage struct {
+	dir string
+}
+
+// NewFileStorage creates dir with mode 0700 if it does not exist
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create keystore dir failed, err=%s", err)
+	}
+	return &FileStorage{dir: dir}, nil
+}
+
+func (f *FileStorage) path(id string) (string, error) {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return "", fmt.Errorf("invalid keystore id=%s", id)
+	}
+	return filepath.Join(f.dir, id+".json"), nil
+}
+
+func (f *FileStorage) Get(id string) ([]byte, error) {
+	path, err := f.path(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// Put writes a temporary file and renames it, so a crash never leaves a partial entry
+func (f *FileStorage) Put(id string, data []byte) error {
+	path, err := f.path(id)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(f.dir, "."+id+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (f *FileStorage) List() ([]string, error) {
+	files, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(name, ".json"))
+	}
+	return ids, nil
+}
+
+func (f *FileStorage) Delete(id string) error {
+	path, err := f.path(id)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// KeystoreEntryModel is the table used by GormStorage
+type KeystoreEntryModel struct {
+	xgorm.BaseModel
+	EntryID string `gorm:"column:entry_id;type:varchar(128);not null;uniqueIndex:uk_entry_id;comment:条目ID"`
+	Data    string `gorm:"column:data;type:text;not null;comment:加密后的密钥json"`
+}
+
+func (KeystoreEntryModel) TableName() string {
+	return "keystore_entry"
+}
+
+// GormStorage is a Storage backed by xgorm
+type GormStorage struct {
+	db *gorm.DB
+}
+
+func NewGormStorage(db *gorm.DB) *GormStorage {
+	return &GormStorage{db: db}
+}
+
+// AutoMigrate creates or updates the keystore_entry table
+func (g *GormStorage) AutoMigrate() error {
+	return xgorm.Primary(g.db).AutoMigrate(&KeystoreEntryModel{})
+}
+
+func (g *GormStorage) Get(id string) ([]byte, error) {
+	var m KeystoreEntryModel
+	err := xgorm.Primary(g.db).Where("entry_id = ?", id).Take(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(m.Data), nil
+}
+
+func (g *GormStorage) Put(id string, data []byte) error {
+	m := KeystoreEntryModel{EntryID: id, Data: string(data)}
+	return g.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "entry_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"data", "updated_at"}),
+	}).Create(&m).Error
+}
+
+func (g *GormStorage) List() ([]string, error) {
+	var ids []string
+	err := g.db.Model(&KeystoreEntryModel{}).Order("entry_id").Pluck("entry_id", &ids).Error
+	return ids, err
+}
+
+// Delete removes the row, deleted key material is not kept as a soft deleted row
+func (g *GormStorage) Delete(id string) error {
+	res := g.db.Unscoped().Where("entry_id = ?", id).Delete(&KeystoreEntryModel{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
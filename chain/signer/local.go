@@ -0,0 +1,74 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// LocalSigner signs with a private key held in memory
+type LocalSigner struct {
+	key     *ecdsa.PrivateKey
+	family  Family
+	address string
+}
+
+// NewLocalSigner creates the signer for key
+func NewLocalSigner(key *ecdsa.PrivateKey, family Family) (*LocalSigner, error) {
+	addr, err := AddressOf(&key.PublicKey, family)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalSigner{key: key, family: family, address: addr}, nil
+}
+
+// NewLocalSignerFromHex creates the signer for a hex encoded private key, the 0x prefix is optional
+func NewLocalSignerFromHex(hexKey string, family Family) (*LocalSigner, error) {
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(hexKey, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("parse private key failed, err=%s", err)
+	}
+	return NewLocalSigner(key, family)
+}
+
+// NewKeystoreSigner decrypts an Ethereum keystore v3 file, the key only lives inside the signer
+func NewKeystoreSigner(path, passphrase string, family Family) (*LocalSigner, error) {
+	keyJSON, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read keystore failed, err=%s", err)
+	}
+	return NewKeystoreSignerFromJSON(keyJSON, passphrase, family)
+}
+
+// NewKeystoreSignerFromJSON decrypts the content of an Ethereum keystore v3 file
+func NewKeystoreSignerFromJSON(keyJSON []byte, passphrase string, family Family) (*LocalSigner, error) {
+	key, err := keystore.DecryptKey(keyJSON, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt keystore failed, err=%s", err)
+	}
+	return NewLocalSigner(key.PrivateKey, family)
+}
+
+func (s *LocalSigner) Address() string {
+	return s.address
+}
+
+func (s *LocalSigner) Family() Family {
+	return s.family
+}
+
+func (s *LocalSigner) SignHash(hash []byte) ([]byte, error) {
+	if len(hash) != 32 {
+		return nil, fmt.Errorf("hash length=%d, want 32", len(hash))
+	}
+	return crypto.Sign(hash, s.key)
+}
+
+func (s *LocalSigner) SignTypedData(data apitypes.TypedData) ([]byte, error) {
+	return SignTypedDataWith(s, data)
+}
@@ -0,0 +1,160 @@
+package signer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+const defaultRemoteTimeout = 10 * time.Second
+
+// RemoteConfig is the config for the remote signer
+// URL is the base url of the signing service, Token is sent as a bearer token when set
+// Family defaults to FamilyEVM
+type RemoteConfig struct {
+	URL     string
+	Address string
+	Family  Family
+	Token   string
+	Timeout time.Duration
+}
+
+// RemoteSigner asks a signing service over HTTP, the key never leaves the service
+//
+// POST {URL}/sign_hash        {"address", "family", "hash"}       -> {"signature"}
+// POST {URL}/sign_typed_data  {"address", "family", "typed_data"} -> {"signature"}
+//
+// hash and signature are 0x prefixed hex, the service returns an error as {"error"} with a non 2xx status
+// every signature is checked to recover to Address, so a misrouted or compromised service cannot sign for another key
+// the service may return V in {0, 1} or {27, 28}, it is normalized to the form of the Signer contract
+type RemoteSigner struct {
+	conf   RemoteConfig
+	client *http.Client
+}
+
+type remoteRequest struct {
+	Address   string              `json:"address"`
+	Family    Family              `json:"family"`
+	Hash      string              `json:"hash,omitempty"`
+	TypedData *apitypes.TypedData `json:"typed_data,omitempty"`
+}
+
+type remoteResponse struct {
+	Signature string `json:"signature"`
+	Error     string `json:"error"`
+}
+
+// NewRemoteSigner creates the remote signer
+func NewRemoteSigner(conf *RemoteConfig) (*RemoteSigner, error) {
+	if conf.URL == "" || conf.Address == "" {
+		return nil, fmt.Errorf("remote signer url and address are required")
+	}
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = defaultRemoteTimeout
+	}
+	c := *conf
+	c.URL = strings.TrimRight(c.URL, "/")
+	if c.Family == "" {
+		c.Family = FamilyEVM
+	}
+	if c.Family != FamilyEVM && c.Family != FamilyTron {
+		return nil, fmt.Errorf("unsupported chain family=%s", c.Family)
+	}
+	return &RemoteSigner{conf: c, client: &http.Client{Timeout: timeout}}, nil
+}
+
+func (s *RemoteSigner) Address() string {
+	return s.conf.Address
+}
+
+func (s *RemoteSigner) Family() Family {
+	return s.conf.Family
+}
+
+func (s *RemoteSigner) SignHash(hash []byte) ([]byte, error) {
+	if len(hash) != 32 {
+		return nil, fmt.Errorf("hash length=%d, want 32", len(hash))
+	}
+	return s.call("/sign_hash", hash, 0, &remoteRequest{Hash: "0x" + hex.EncodeToString(hash)})
+}
+
+func (s *RemoteSigner) SignTypedData(data apitypes.TypedData) ([]byte, error) {
+	hash, err := TypedDataHash(data)
+	if err != nil {
+		return nil, err
+	}
+	return s.call("/sign_typed_data", hash, 27, &remoteRequest{TypedData: &data})
+}
+
+// call asks the service to sign hash, the returned V is the recovery id plus vBase
+func (s *RemoteSigner) call(path string, hash []byte, vBase byte, req *remoteRequest) ([]byte, error) {
+	req.Address, req.Family = s.conf.Address, s.conf.Family
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("encode request failed, err=%s", err)
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, s.conf.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request failed, err=%s", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if s.conf.Token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+s.conf.Token)
+	}
+	res, err := s.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("request remote signer failed, err=%s", err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response failed, err=%s", err)
+	}
+	var resp remoteResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("decode response failed, status=%d, err=%s", res.StatusCode, err)
+	}
+	if res.StatusCode/100 != 2 || resp.Error != "" {
+		return nil, fmt.Errorf("remote signer failed, status=%d, err=%s", res.StatusCode, resp.Error)
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(resp.Signature, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("decode signature failed, err=%s", err)
+	}
+	if len(sig) != 65 {
+		return nil, fmt.Errorf("signature length=%d, want 65", len(sig))
+	}
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	if err := s.verify(hash, sig); err != nil {
+		return nil, err
+	}
+	sig[crypto.RecoveryIDOffset] += vBase
+	return sig, nil
+}
+
+// verify checks that sig over hash with V in {0, 1} recovers to the configured address
+func (s *RemoteSigner) verify(hash, sig []byte) error {
+	pub, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return fmt.Errorf("recover signer failed, err=%s", err)
+	}
+	addr, err := AddressOf(pub, s.conf.Family)
+	if err != nil {
+		return err
+	}
+	if addr != s.conf.Address && !(s.conf.Family == FamilyEVM && strings.EqualFold(addr, s.conf.Address)) {
+		return fmt.Errorf("remote signature is from address=%s, want %s", addr, s.conf.Address)
+	}
+	return nil
+}
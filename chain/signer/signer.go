@@ -0,0 +1,89 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/fbsobreira/gotron-sdk/pkg/address"
+	"github.com/h8848/blockchain-infra/chain/chain_client"
+)
+
+// Family is the chain family of a signer, it decides how the address is encoded
+type Family string
+
+const (
+	FamilyEVM  Family = "evm"
+	FamilyTron Family = "tron"
+)
+
+// Signer signs on behalf of one account, so business code never holds the private key
+// SignHash returns the 65 byte [R || S || V] signature with V in {0, 1}, as expected by
+// BlockChainClient.BroadcastTransaction and go-ethereum's Transaction.WithSignature
+// SignTypedData signs the EIP-712 hash of data and returns V in {27, 28}, as expected by contracts and wallets
+type Signer interface {
+	Address() string
+	Family() Family
+	SignHash(hash []byte) ([]byte, error)
+	SignTypedData(data apitypes.TypedData) ([]byte, error)
+}
+
+// AddressOf encodes the address of pub for family
+func AddressOf(pub *ecdsa.PublicKey, family Family) (string, error) {
+	switch family {
+	case FamilyEVM:
+		return crypto.PubkeyToAddress(*pub).Hex(), nil
+	case FamilyTron:
+		return address.PubkeyToAddress(*pub).String(), nil
+	}
+	return "", fmt.Errorf("unsupported chain family=%s", family)
+}
+
+// TypedDataHash returns the EIP-712 hash of data
+func TypedDataHash(data apitypes.TypedData) ([]byte, error) {
+	hash, _, err := apitypes.TypedDataAndHash(data)
+	if err != nil {
+		return nil, fmt.Errorf("hash typed data failed, err=%s", err)
+	}
+	return hash, nil
+}
+
+// SignTypedDataWith hashes data and signs it with s.SignHash, V is moved to {27, 28}
+// it is the default SignTypedData for signers that can only sign hashes
+func SignTypedDataWith(s Signer, data apitypes.TypedData) ([]byte, error) {
+	hash, err := TypedDataHash(data)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := s.SignHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	sig[crypto.RecoveryIDOffset] += 27
+	return sig, nil
+}
+
+// SignAndBroadcast builds td with client, signs the hash with s and broadcasts it
+// td.From is set to the signer address when empty
+func SignAndBroadcast(client chain_client.BlockChainClient, s Signer, td *chain_client.Transaction) ([]byte, error) {
+	if td.From == "" {
+		td.From = s.Address()
+	}
+	tx, hash, err := client.GetTransaction(td)
+	if err != nil {
+		return nil, fmt.Errorf("get transaction failed, err=%s", err)
+	}
+	sig, err := s.SignHash(hash)
+	if err != nil {
+		return nil, fmt.Errorf("sign transaction failed, err=%s", err)
+	}
+	return client.BroadcastTransaction(tx, sig)
+}
+
+// SignFunc adapts s to the hash signing callback used by txtracker
+func SignFunc(s Signer) func(td *chain_client.Transaction, hash []byte) ([]byte, error) {
+	return func(td *chain_client.Transaction, hash []byte) ([]byte, error) {
+		return s.SignHash(hash)
+	}
+}
@@ -0,0 +1,91 @@
+package signer
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+)
+
+func TestSigners(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := NewLocalSigner(key, FamilyEVM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := crypto.Keccak256([]byte("message"))
+
+	keyJSON, err := keystore.EncryptKey(&keystore.Key{Id: uuid.New(), Address: crypto.PubkeyToAddress(key.PublicKey), PrivateKey: key},
+		"secret", keystore.LightScryptN, keystore.LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := NewKeystoreSignerFromJSON(keyJSON, "secret", FamilyEVM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewKeystoreSignerFromJSON(keyJSON, "wrong", FamilyEVM); err == nil {
+		t.Fatal("wrong passphrase accepted")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req remoteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(remoteResponse{Error: "bad request"})
+			return
+		}
+		h, _ := hex.DecodeString(req.Hash[2:])
+		sig, _ := local.SignHash(h)
+		// the service answers in the {27, 28} form, SignHash must still return {0, 1}
+		sig[crypto.RecoveryIDOffset] += 27
+		_ = json.NewEncoder(w).Encode(remoteResponse{Signature: "0x" + hex.EncodeToString(sig)})
+	}))
+	defer server.Close()
+	remote, err := NewRemoteSigner(&RemoteConfig{URL: server.URL, Address: local.Address(), Token: "token"})
+	if err != nil || remote.Family() != FamilyEVM {
+		t.Fatalf("family=%v, err=%v", remote, err)
+	}
+	if _, err := NewRemoteSigner(&RemoteConfig{URL: server.URL, Address: local.Address(), Family: "btc"}); err == nil {
+		t.Fatal("unsupported family accepted")
+	}
+
+	for name, s := range map[string]Signer{"local": local, "keystore": stored, "remote": remote} {
+		sig, err := s.SignHash(hash)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		pub, err := crypto.SigToPub(hash, sig)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if addr := crypto.PubkeyToAddress(*pub).Hex(); addr != s.Address() {
+			t.Fatalf("%s: recovered %s, want %s", name, addr, s.Address())
+		}
+	}
+
+	// a service answering with another key is rejected
+	other, err := NewRemoteSigner(&RemoteConfig{URL: server.URL, Address: "0x000000000000000000000000000000000000dEaD", Family: FamilyEVM, Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.SignHash(hash); err == nil {
+		t.Fatal("signature of another address accepted")
+	}
+
+	tron, err := NewLocalSigner(key, FamilyTron)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr := tron.Address(); len(addr) != 34 || addr[0] != 'T' {
+		t.Fatalf("tron address=%s", addr)
+	}
+}
@@ -0,0 +1,79 @@
+package watchonly
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Service hands out deposit addresses of a WatchOnly wallet and persists every derived address,
+// so incoming transfers can be mapped back to their index without deriving again
+type Service struct {
+	wallet *WatchOnly
+	store  Store
+	// mu serializes Next within the process, use AddressAt with indexes assigned elsewhere
+	// (such as the user id) when several servers allocate from the same xpub
+	mu sync.Mutex
+}
+
+func NewService(wallet *WatchOnly, store Store) *Service {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	return &Service{wallet: wallet, store: store}
+}
+
+// Wallet returns the underlying wallet
+func (s *Service) Wallet() *WatchOnly {
+	return s.wallet
+}
+
+// AddressAt derives and persists the address at change/index, the mapping is deterministic
+func (s *Service) AddressAt(change, index uint32) (*Address, error) {
+	addr, err := s.wallet.Derive(change, index)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.Save([]*Address{addr}); err != nil {
+		return nil, fmt.Errorf("save address failed, err=%s", err)
+	}
+	return addr, nil
+}
+
+// Next allocates the address after the highest persisted index of change
+func (s *Service) Next(change uint32) (*Address, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, err := s.store.NextIndex(s.wallet.ID(), change)
+	if err != nil {
+		return nil, fmt.Errorf("get next index failed, err=%s", err)
+	}
+	return s.AddressAt(change, index)
+}
+
+// Batch derives and persists count addresses of change starting at start
+func (s *Service) Batch(change, start, count uint32) ([]*Address, error) {
+	addrs, err := s.wallet.DeriveBatch(change, start, count)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.Save(addrs); err != nil {
+		return nil, fmt.Errorf("save addresses failed, err=%s", err)
+	}
+	return addrs, nil
+}
+
+// Verify reports whether address belongs to the xpub with an index in [from, to)
+// persisted addresses are answered from the store, others are derived
+func (s *Service) Verify(address string, from, to uint32) (*Address, bool, error) {
+	stored, err := s.store.FindByAddress(s.wallet.conf.Coin, address)
+	if err != nil {
+		return nil, false, fmt.Errorf("find address failed, err=%s", err)
+	}
+	if stored != nil {
+		if stored.XpubID != s.wallet.ID() || stored.Index < from || stored.Index >= to {
+			return nil, false, nil
+		}
+		return stored, true, nil
+	}
+	return s.wallet.Find(address, from, to)
+}
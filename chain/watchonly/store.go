@@ -0,0 +1,156 @@
+package watchonly
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/h8848/blockchain-infra/chain/hdwallet"
+	"github.com/h8848/blockchain-infra/pkg/xgorm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store persists the index to address mapping, saving an existing xpub/change/index is a no-op
+// FindByAddress returns nil without error for unknown addresses, NextIndex is 0 for an empty branch
+type Store interface {
+	Save(addrs []*Address) error
+	FindByAddress(coin hdwallet.Coin, address string) (*Address, error)
+	NextIndex(xpubID string, change uint32) (uint32, error)
+}
+
+type branchKey struct {
+	xpubID string
+	change uint32
+}
+
+// MemoryStore keeps the addresses in process
+type MemoryStore struct {
+	mu        sync.Mutex
+	byAddress map[string]*Address
+	next      map[branchKey]uint32
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{byAddress: make(map[string]*Address), next: make(map[branchKey]uint32)}
+}
+
+func (s *MemoryStore) Save(addrs []*Address) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range addrs {
+		key := addressKey(a.Coin, a.Address)
+		if _, ok := s.byAddress[key]; ok {
+			continue
+		}
+		cp := *a
+		s.byAddress[key] = &cp
+		bk := branchKey{xpubID: a.XpubID, change: a.Change}
+		if a.Index >= s.next[bk] {
+			s.next[bk] = a.Index + 1
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) FindByAddress(coin hdwallet.Coin, address string) (*Address, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.byAddress[addressKey(coin, address)]
+	if !ok {
+		return nil, nil
+	}
+	cp := *a
+	return &cp, nil
+}
+
+func (s *MemoryStore) NextIndex(xpubID string, change uint32) (uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.next[branchKey{xpubID: xpubID, change: change}], nil
+}
+
+// addressKey normalizes EVM addresses to lower case
+func addressKey(coin hdwallet.Coin, address string) string {
+	if coin == hdwallet.CoinETH {
+		address = strings.ToLower(address)
+	}
+	return string(coin) + ":" + address
+}
+
+// WatchAddressModel is the table used by GormStore
+type WatchAddressModel struct {
+	xgorm.BaseModel
+	Coin      string `gorm:"column:coin;type:varchar(16);not null;uniqueIndex:uk_coin_address;comment:币种"`
+	XpubID    string `gorm:"column:xpub_id;type:varchar(32);not null;uniqueIndex:uk_xpub_change_index;comment:xpub标识"`
+	Change    uint32 `gorm:"column:change_no;not null;uniqueIndex:uk_xpub_change_index;comment:0收款 1找零"`
+	AddrIndex uint32 `gorm:"column:addr_index;not null;uniqueIndex:uk_xpub_change_index;comment:地址索引"`
+	Address   string `gorm:"column:address;type:varchar(128);not null;uniqueIndex:uk_coin_address;comment:地址,EVM地址小写"`
+}
+
+func (WatchAddressModel) TableName() string {
+	return "watch_address"
+}
+
+// GormStore is a Store backed by xgorm
+type GormStore struct {
+	db *gorm.DB
+}
+
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// AutoMigrate creates or updates the watch_address table
+func (g *GormStore) AutoMigrate() error {
+	return xgorm.Primary(g.db).AutoMigrate(&WatchAddressModel{})
+}
+
+func (g *GormStore) Save(addrs []*Address) error {
+	if len(addrs) == 0 {
+		return nil
+	}
+	models := make([]WatchAddressModel, 0, len(addrs))
+	for _, a := range addrs {
+		address := a.Address
+		if a.Coin == hdwallet.CoinETH {
+			address = strings.ToLower(address)
+		}
+		models = append(models, WatchAddressModel{
+			Coin:      string(a.Coin),
+			XpubID:    a.XpubID,
+			Change:    a.Change,
+			AddrIndex: a.Index,
+			Address:   address,
+		})
+	}
+	return g.db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&models, 500).Error
+}
+
+func (g *GormStore) FindByAddress(coin hdwallet.Coin, address string) (*Address, error) {
+	if coin == hdwallet.CoinETH {
+		address = strings.ToLower(address)
+	}
+	var m WatchAddressModel
+	err := g.db.Where("coin = ? AND address = ?", string(coin), address).Take(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Address{Coin: hdwallet.Coin(m.Coin), XpubID: m.XpubID, Change: m.Change, Index: m.AddrIndex, Address: m.Address}, nil
+}
+
+func (g *GormStore) NextIndex(xpubID string, change uint32) (uint32, error) {
+	var max *uint32
+	err := xgorm.Primary(g.db).Model(&WatchAddressModel{}).Where("xpub_id = ? AND change_no = ?", xpubID, change).
+		Select("MAX(addr_index)").Scan(&max).Error
+	if err != nil {
+		return 0, err
+	}
+	if max == nil {
+		return 0, nil
+	}
+	return *max + 1, nil
+}
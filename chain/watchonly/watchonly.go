@@ -0,0 +1,165 @@
+package watchonly
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/h8848/blockchain-infra/chain/btc"
+	"github.com/h8848/blockchain-infra/chain/hdwallet"
+)
+
+// Config is the config for a watch-only wallet, Coin defaults to CoinETH
+// BTCType and BTCNet are only used for CoinBTC, default P2WPKH on mainnet
+type Config struct {
+	Coin    hdwallet.Coin
+	BTCType btc.AddressType
+	BTCNet  *chaincfg.Params
+}
+
+// Address is a derived address, Change is 0 for receive and 1 for change addresses
+type Address struct {
+	Coin    hdwallet.Coin
+	XpubID  string
+	Change  uint32
+	Index   uint32
+	Address string
+}
+
+// WatchOnly derives the addresses change/index below an account level extended public key,
+// as exported by HDWallet.ExtendedPublicKey, without any private key
+type WatchOnly struct {
+	conf Config
+	id   string
+	key  *hdkeychain.ExtendedKey
+	mu   sync.Mutex
+	// branches caches the change level keys
+	branches map[uint32]*hdkeychain.ExtendedKey
+}
+
+// New parses xpub, private extended keys are rejected, a nil conf derives ETH addresses
+func New(xpub string, conf *Config) (*WatchOnly, error) {
+	key, err := hdkeychain.NewKeyFromString(xpub)
+	if err != nil {
+		return nil, fmt.Errorf("invalid extended public key, err=%s", err)
+	}
+	if key.IsPrivate() {
+		return nil, fmt.Errorf("extended private key is not allowed for watch-only derivation")
+	}
+	if conf == nil {
+		conf = &Config{}
+	}
+	c := *conf
+	if c.Coin == "" {
+		c.Coin = hdwallet.CoinETH
+	}
+	switch c.Coin {
+	case hdwallet.CoinETH, hdwallet.CoinTRON:
+	case hdwallet.CoinBTC:
+		if c.BTCType == "" {
+			c.BTCType = btc.P2WPKH
+		}
+		if c.BTCNet == nil {
+			c.BTCNet = &chaincfg.MainNetParams
+		}
+	default:
+		return nil, fmt.Errorf("coin=%s does not support watch-only derivation", c.Coin)
+	}
+	return &WatchOnly{conf: c, id: XpubID(xpub), key: key, branches: make(map[uint32]*hdkeychain.ExtendedKey)}, nil
+}
+
+// XpubID identifies an xpub in storage without storing the xpub itself
+func XpubID(xpub string) string {
+	sum := sha256.Sum256([]byte(xpub))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ID returns the XpubID of the wallet
+func (w *WatchOnly) ID() string {
+	return w.id
+}
+
+// Derive returns the address at change/index, only non-hardened indexes can be derived from an xpub
+func (w *WatchOnly) Derive(change, index uint32) (*Address, error) {
+	if change >= hdkeychain.HardenedKeyStart || index >= hdkeychain.HardenedKeyStart {
+		return nil, fmt.Errorf("hardened index cannot be derived from an extended public key")
+	}
+	branch, err := w.branch(change)
+	if err != nil {
+		return nil, err
+	}
+	child, err := branch.Derive(index)
+	if err != nil {
+		return nil, fmt.Errorf("derive index=%d failed, err=%s", index, err)
+	}
+	pub, err := child.ECPubKey()
+	if err != nil {
+		return nil, err
+	}
+	var addr string
+	if w.conf.Coin == hdwallet.CoinBTC {
+		a, err := btc.NewAddress(pub, w.conf.BTCType, w.conf.BTCNet)
+		if err != nil {
+			return nil, err
+		}
+		addr = a.EncodeAddress()
+	} else if addr, err = hdwallet.PublicKeyAddress(w.conf.Coin, pub.ToECDSA(), nil); err != nil {
+		return nil, err
+	}
+	return &Address{Coin: w.conf.Coin, XpubID: w.id, Change: change, Index: index, Address: addr}, nil
+}
+
+func (w *WatchOnly) branch(change uint32) (*hdkeychain.ExtendedKey, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if branch, ok := w.branches[change]; ok {
+		return branch, nil
+	}
+	branch, err := w.key.Derive(change)
+	if err != nil {
+		return nil, fmt.Errorf("derive change=%d failed, err=%s", change, err)
+	}
+	w.branches[change] = branch
+	return branch, nil
+}
+
+// DeriveBatch returns count addresses of change starting at start
+func (w *WatchOnly) DeriveBatch(change, start, count uint32) ([]*Address, error) {
+	list := make([]*Address, 0, count)
+	for i := uint32(0); i < count; i++ {
+		addr, err := w.Derive(change, start+i)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, addr)
+	}
+	return list, nil
+}
+
+// Find looks for address among the receive and change addresses with index in [from, to)
+func (w *WatchOnly) Find(address string, from, to uint32) (*Address, bool, error) {
+	for _, change := range []uint32{0, 1} {
+		for index := from; index < to; index++ {
+			addr, err := w.Derive(change, index)
+			if err != nil {
+				return nil, false, err
+			}
+			if sameAddress(w.conf.Coin, addr.Address, address) {
+				return addr, true, nil
+			}
+		}
+	}
+	return nil, false, nil
+}
+
+// sameAddress compares EVM addresses case-insensitively, the others exactly
+func sameAddress(coin hdwallet.Coin, a, b string) bool {
+	if coin == hdwallet.CoinETH {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
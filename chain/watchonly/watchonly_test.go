@@ -0,0 +1,97 @@
+package watchonly
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/h8848/blockchain-infra/chain/hdwallet"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func TestWatchOnlyMatchesWallet(t *testing.T) {
+	w, err := hdwallet.NewHDWallet(testMnemonic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, coin := range []hdwallet.Coin{hdwallet.CoinETH, hdwallet.CoinTRON, hdwallet.CoinBTC} {
+		xpub, err := w.ExtendedPublicKey(coin, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		watch, err := New(xpub, &Config{Coin: coin})
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs, err := watch.DeriveBatch(0, 0, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, addr := range addrs {
+			acc, _ := w.Derive(coin, 0, uint32(i))
+			if addr.Address != acc.Address {
+				t.Fatalf("%s index=%d address=%s, want %s", coin, i, addr.Address, acc.Address)
+			}
+		}
+	}
+	if _, err := New(xpubOf(t, w), &Config{Coin: hdwallet.CoinSOL}); err == nil {
+		t.Fatal("sol accepted")
+	}
+	// a nil config derives ETH addresses
+	watch, err := New(xpubOf(t, w), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := watch.Derive(0, 0)
+	acc, _ := w.Derive(hdwallet.CoinETH, 0, 0)
+	if err != nil || addr.Address != acc.Address {
+		t.Fatalf("address=%+v, err=%v", addr, err)
+	}
+}
+
+func TestServiceAllocateAndVerify(t *testing.T) {
+	w, _ := hdwallet.NewHDWallet(testMnemonic, "")
+	watch, err := New(xpubOf(t, w), &Config{Coin: hdwallet.CoinETH})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewService(watch, NewMemoryStore())
+	first, _ := s.Next(0)
+	second, _ := s.Next(0)
+	if first.Index != 0 || second.Index != 1 {
+		t.Fatalf("indexes=%d,%d", first.Index, second.Index)
+	}
+	if _, err := s.Batch(0, 5, 2); err != nil {
+		t.Fatal(err)
+	}
+	if next, _ := s.Next(0); next.Index != 7 {
+		t.Fatalf("next index=%d", next.Index)
+	}
+
+	// stored address, any case
+	if addr, ok, err := s.Verify(strings.ToUpper(second.Address[2:]), 0, 10); err != nil || ok || addr != nil {
+		t.Fatalf("malformed address verified, err=%v", err)
+	}
+	if addr, ok, _ := s.Verify(strings.ToLower(second.Address), 0, 10); !ok || addr.Index != 1 {
+		t.Fatal("stored address not verified")
+	}
+	if _, ok, _ := s.Verify(second.Address, 2, 10); ok {
+		t.Fatal("address verified outside of range")
+	}
+	// not stored, found by derivation on the change branch
+	change, _ := watch.Derive(1, 4)
+	if addr, ok, _ := s.Verify(change.Address, 0, 10); !ok || addr.Change != 1 || addr.Index != 4 {
+		t.Fatal("change address not verified")
+	}
+	if _, err := watch.Derive(0, 1<<31); err == nil {
+		t.Fatal("hardened index derived")
+	}
+}
+
+func xpubOf(t *testing.T, w *hdwallet.HDWallet) string {
+	xpub, err := w.ExtendedPublicKey(hdwallet.CoinETH, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return xpub
+}
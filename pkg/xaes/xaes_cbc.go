@@ -8,6 +8,7 @@ import (
 	"errors"
 )
 
+// CBCEncrypt 使用密钥作为IV且不认证，仅用于兼容旧数据，新数据使用 GCMEncryptString
 func CBCEncrypt(orig string, key string) (string, error) {
 	// 转成字节数组
 	origData := []byte(orig)
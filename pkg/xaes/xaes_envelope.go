@@ -0,0 +1,175 @@
+package xaes
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/h8848/blockchain-infra/pkg/xrsa"
+)
+
+// KMS wraps data keys with a master key, keyID names the master key so it can be rotated
+type KMS interface {
+	WrapKey(dataKey []byte) (keyID string, wrapped []byte, err error)
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// EnvelopeEncrypt encrypts plaintext with a fresh AES-256 data key wrapped by kms
+// the result is version || len(keyID) || keyID || len(wrapped) || wrapped || gcm payload of the data key
+func EnvelopeEncrypt(kms KMS, plaintext, aad []byte) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	keyID, wrapped, err := kms.WrapKey(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("wrap data key failed, err=%s", err)
+	}
+	if len(keyID) > 0xff || len(wrapped) > 0xffff {
+		return nil, errors.New("key id or wrapped key is too long")
+	}
+	header := []byte{VersionEnvelope, byte(len(keyID))}
+	header = append(header, keyID...)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(wrapped)))
+	header = append(header, wrapped...)
+	sealed, err := GCMEncrypt(dataKey, plaintext, gcmAAD(header, aad))
+	if err != nil {
+		return nil, err
+	}
+	return append(header, sealed...), nil
+}
+
+// EnvelopeDecrypt unwraps the data key with kms and decrypts a payload of EnvelopeEncrypt
+func EnvelopeDecrypt(kms KMS, data, aad []byte) ([]byte, error) {
+	keyID, wrapped, sealed, err := parseEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := kms.UnwrapKey(keyID, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key failed, err=%s", err)
+	}
+	return GCMDecrypt(dataKey, sealed, gcmAAD(data[:len(data)-len(sealed)], aad))
+}
+
+// EnvelopeKeyID returns the master key id of a payload, such as to find payloads to rewrap after a rotation
+func EnvelopeKeyID(data []byte) (string, error) {
+	keyID, _, _, err := parseEnvelope(data)
+	return keyID, err
+}
+
+func parseEnvelope(data []byte) (keyID string, wrapped, sealed []byte, err error) {
+	if len(data) < 2 || data[0] != VersionEnvelope {
+		return "", nil, nil, errors.New("invalid envelope ciphertext")
+	}
+	n := int(data[1])
+	if len(data) < 2+n+2 {
+		return "", nil, nil, errors.New("envelope ciphertext is truncated")
+	}
+	keyID = string(data[2 : 2+n])
+	rest := data[2+n:]
+	m := int(binary.BigEndian.Uint16(rest))
+	if len(rest) < 2+m {
+		return "", nil, nil, errors.New("envelope ciphertext is truncated")
+	}
+	return keyID, rest[2 : 2+m], rest[2+m:], nil
+}
+
+// LocalKMS wraps data keys with AES-256-GCM master keys held in process
+// new data keys are wrapped by the current key, older keys only unwrap
+type LocalKMS struct {
+	mu      sync.RWMutex
+	current string
+	keys    map[string][]byte
+}
+
+func NewLocalKMS(keyID string, masterKey []byte) (*LocalKMS, error) {
+	k := &LocalKMS{keys: make(map[string][]byte)}
+	if err := k.Rotate(keyID, masterKey); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Rotate adds a master key and makes it the current one
+func (k *LocalKMS) Rotate(keyID string, masterKey []byte) error {
+	if keyID == "" || len(masterKey) != 32 {
+		return errors.New("master key needs an id and 32 bytes")
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[keyID] = append([]byte{}, masterKey...)
+	k.current = keyID
+	return nil
+}
+
+func (k *LocalKMS) WrapKey(dataKey []byte) (string, []byte, error) {
+	k.mu.RLock()
+	keyID, key := k.current, k.keys[k.current]
+	k.mu.RUnlock()
+	wrapped, err := GCMEncrypt(key, dataKey, []byte(keyID))
+	return keyID, wrapped, err
+}
+
+func (k *LocalKMS) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	k.mu.RLock()
+	key, ok := k.keys[keyID]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown master key=%s", keyID)
+	}
+	return GCMDecrypt(key, wrapped, []byte(keyID))
+}
+
+// RSAKMS wraps data keys with RSA-OAEP-SHA256, a KMS with only the public key can encrypt but not decrypt
+type RSAKMS struct {
+	keyID string
+	pub   *rsa.PublicKey
+	priv  *rsa.PrivateKey
+}
+
+// NewRSAKMS parses the PEM keys in the formats of xrsa, privPEM may be empty on encrypt only services
+// the key id is derived from the public key
+func NewRSAKMS(pubPEM, privPEM []byte) (*RSAKMS, error) {
+	pub, err := xrsa.ParseRSAPublicKeyFromPEM(pubPEM)
+	if err != nil {
+		return nil, fmt.Errorf("parse rsa public key failed, err=%s", err)
+	}
+	k := &RSAKMS{pub: pub}
+	if len(privPEM) > 0 {
+		if k.priv, err = xrsa.ParseRSAPrivateKeyFromPEM(privPEM); err != nil {
+			return nil, fmt.Errorf("parse rsa private key failed, err=%s", err)
+		}
+		if !k.priv.PublicKey.Equal(pub) {
+			return nil, errors.New("rsa private key does not match the public key")
+		}
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	k.keyID = "rsa:" + hex.EncodeToString(sum[:8])
+	return k, nil
+}
+
+func (k *RSAKMS) WrapKey(dataKey []byte) (string, []byte, error) {
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, k.pub, dataKey, nil)
+	return k.keyID, wrapped, err
+}
+
+func (k *RSAKMS) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	if k.priv == nil {
+		return nil, errors.New("rsa kms has no private key")
+	}
+	if keyID != k.keyID {
+		return nil, fmt.Errorf("unknown master key=%s", keyID)
+	}
+	return rsa.DecryptOAEP(sha256.New(), rand.Reader, k.priv, wrapped, nil)
+}
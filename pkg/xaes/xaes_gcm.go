@@ -0,0 +1,123 @@
+package xaes
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// ciphertext versions, the first byte of every versioned payload
+const (
+	VersionGCM      byte = 1
+	VersionEnvelope byte = 2
+)
+
+var ErrAuthFailed = errors.New("message authentication failed")
+
+// gcmMinSize is the length of a GCMEncrypt payload of an empty plaintext: version, nonce and tag
+const gcmMinSize = 1 + 12 + 16
+
+// GCMEncrypt encrypts with AES-GCM under a random nonce, key is 16, 24 or 32 bytes
+// the result is version || nonce || ciphertext and tag, aad is authenticated but not stored
+func GCMEncrypt(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 1+gcm.NonceSize(), 1+gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	out[0] = VersionGCM
+	if _, err := rand.Read(out[1:]); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(out, out[1:], plaintext, gcmAAD(out[:1], aad)), nil
+}
+
+// GCMDecrypt decrypts a payload of GCMEncrypt with the same aad
+func GCMDecrypt(key, data, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 1+gcm.NonceSize()+gcm.Overhead() || data[0] != VersionGCM {
+		return nil, errors.New("invalid gcm ciphertext")
+	}
+	nonce := data[1 : 1+gcm.NonceSize()]
+	plaintext, err := gcm.Open(nil, nonce, data[1+gcm.NonceSize():], gcmAAD(data[:1], aad))
+	if err != nil {
+		return nil, ErrAuthFailed
+	}
+	return plaintext, nil
+}
+
+// GCMEncryptString is GCMEncrypt with base64 output, it replaces CBCEncrypt
+func GCMEncryptString(orig string, key string) (string, error) {
+	data, err := GCMEncrypt([]byte(key), []byte(orig), nil)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// GCMDecryptString decrypts a payload of GCMEncryptString
+func GCMDecryptString(cryted string, key string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(cryted)
+	if err != nil {
+		return "", err
+	}
+	orig, err := GCMDecrypt([]byte(key), data, nil)
+	return string(orig), err
+}
+
+// DecryptCompat decrypts a payload of GCMEncryptString or of the legacy CBCEncrypt,
+// legacy reports whether the payload is CBC and should be migrated with GCMEncryptString
+// a payload that has the GCM version byte and length is never decrypted as CBC, so a tampered GCM
+// payload fails with ErrAuthFailed instead of being handed to the unauthenticated CBC decryption
+func DecryptCompat(cryted string, key string) (orig string, legacy bool, err error) {
+	data, err := base64.StdEncoding.DecodeString(cryted)
+	if err != nil {
+		return "", false, err
+	}
+	if len(data) >= gcmMinSize && data[0] == VersionGCM {
+		plaintext, err := GCMDecrypt([]byte(key), data, nil)
+		if err != nil {
+			return "", false, err
+		}
+		return string(plaintext), false, nil
+	}
+	// CryptBlocks needs whole blocks
+	if len(data)%aes.BlockSize != 0 {
+		return "", false, ErrAuthFailed
+	}
+	orig, err = CBCDecrypt(cryted, key)
+	if err != nil {
+		return "", false, fmt.Errorf("decrypt legacy cbc failed, err=%s", err)
+	}
+	return orig, true, nil
+}
+
+// MigrateCBC re-encrypts a legacy CBCEncrypt payload with GCMEncryptString, GCM payloads are returned as is
+func MigrateCBC(cryted string, key string) (string, error) {
+	orig, legacy, err := DecryptCompat(cryted, key)
+	if err != nil {
+		return "", err
+	}
+	if !legacy {
+		return cryted, nil
+	}
+	return GCMEncryptString(orig, key)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func gcmAAD(header, aad []byte) []byte {
+	return append(append([]byte{}, header...), aad...)
+}
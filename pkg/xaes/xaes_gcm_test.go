@@ -0,0 +1,83 @@
+package xaes
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+)
+
+const testKey = "0123456789abcdef0123456789abcdef"
+
+func TestGCM(t *testing.T) {
+	a, _ := GCMEncryptString("hello", testKey)
+	b, _ := GCMEncryptString("hello", testKey)
+	if a == b {
+		t.Fatal("gcm is deterministic")
+	}
+	if orig, err := GCMDecryptString(a, testKey); err != nil || orig != "hello" {
+		t.Fatalf("decrypt=%s, err=%v", orig, err)
+	}
+	sealed, _ := GCMEncrypt([]byte(testKey), []byte("hello"), []byte("user:1"))
+	if _, err := GCMDecrypt([]byte(testKey), sealed, []byte("user:2")); err != ErrAuthFailed {
+		t.Fatalf("aad not authenticated, err=%v", err)
+	}
+
+	legacy, _ := CBCEncrypt("hello", testKey)
+	orig, isLegacy, err := DecryptCompat(legacy, testKey)
+	if err != nil || !isLegacy || orig != "hello" {
+		t.Fatalf("legacy=%v orig=%s err=%v", isLegacy, orig, err)
+	}
+	// a 32 byte gcm payload is also a whole number of cbc blocks, tampering must not fall back to cbc
+	short, _ := GCMEncrypt([]byte(testKey), []byte("abc"), nil)
+	if len(short) != 32 {
+		t.Fatalf("payload length=%d", len(short))
+	}
+	short[len(short)-1] ^= 1
+	if _, _, err := DecryptCompat(base64.StdEncoding.EncodeToString(short), testKey); err != ErrAuthFailed {
+		t.Fatalf("tampered gcm err=%v", err)
+	}
+	migrated, _ := MigrateCBC(legacy, testKey)
+	if orig, isLegacy, err := DecryptCompat(migrated, testKey); err != nil || isLegacy || orig != "hello" {
+		t.Fatalf("migrated legacy=%v orig=%s err=%v", isLegacy, orig, err)
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	local, _ := NewLocalKMS("k1", bytes.Repeat([]byte{1}, 32))
+	sealed, err := EnvelopeEncrypt(local, []byte("secret"), []byte("aad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = local.Rotate("k2", bytes.Repeat([]byte{2}, 32))
+	if id, _ := EnvelopeKeyID(sealed); id != "k1" {
+		t.Fatalf("key id=%s", id)
+	}
+	if got, err := EnvelopeDecrypt(local, sealed, []byte("aad")); err != nil || string(got) != "secret" {
+		t.Fatalf("decrypt=%s, err=%v", got, err)
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := EnvelopeDecrypt(local, sealed, []byte("aad")); err == nil {
+		t.Fatal("tampered envelope decrypted")
+	}
+
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "rsa public key", Bytes: der})
+	privPEM := pem.EncodeToMemory(&pem.Block{Type: "rsa private key", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	encryptOnly, err := NewRSAKMS(pubPEM, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, _ = EnvelopeEncrypt(encryptOnly, []byte("secret"), nil)
+	if _, err := EnvelopeDecrypt(encryptOnly, sealed, nil); err == nil {
+		t.Fatal("decrypted without private key")
+	}
+	full, _ := NewRSAKMS(pubPEM, privPEM)
+	if got, err := EnvelopeDecrypt(full, sealed, nil); err != nil || string(got) != "secret" {
+		t.Fatalf("decrypt=%s, err=%v", got, err)
+	}
+}
@@ -0,0 +1,131 @@
+package xgorm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LockBusyErr 锁被其他实例持有
+var LockBusyErr = errors.New("xgorm: lock is held by another instance")
+
+type localLockKey struct {
+	db   *sql.DB
+	name string
+}
+
+var (
+	localLocksMu sync.Mutex
+	localLocks   = make(map[localLockKey]chan struct{})
+)
+
+// localLock 同一进程内同一个库同名的锁，SQLite 没有跨连接的锁，只能保证进程内互斥
+func localLock(ctx context.Context, key localLockKey, wait time.Duration) (func(), error) {
+	localLocksMu.Lock()
+	ch, ok := localLocks[key]
+	if !ok {
+		ch = make(chan struct{}, 1)
+		localLocks[key] = ch
+	}
+	localLocksMu.Unlock()
+
+	select {
+	case ch <- struct{}{}:
+		return func() { <-ch }, nil
+	default:
+	}
+	if wait <= 0 {
+		return nil, LockBusyErr
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case ch <- struct{}{}:
+		return func() { <-ch }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, LockBusyErr
+	}
+}
+
+// advisoryLock 在单独的连接上加 MySQL GET_LOCK 或 PostgreSQL advisory lock，锁随连接释放
+// wait 为0时不等待，锁被占用时返回 LockBusyErr
+func advisoryLock(ctx context.Context, db *gorm.DB, name string, wait time.Duration) (func(), error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	unlockLocal, err := localLock(ctx, localLockKey{db: sqlDB, name: name}, wait)
+	if err != nil {
+		return nil, err
+	}
+	dialect := db.Dialector.Name()
+	if dialect != DialectMySQL && dialect != DialectPostgres {
+		return unlockLocal, nil
+	}
+	unlock, err := remoteLock(ctx, sqlDB, dialect, name, wait)
+	if err != nil {
+		unlockLocal()
+		return nil, err
+	}
+	return func() {
+		unlock()
+		unlockLocal()
+	}, nil
+}
+
+func remoteLock(ctx context.Context, sqlDB *sql.DB, dialect, name string, wait time.Duration) (func(), error) {
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lockCtx := ctx
+	if wait > 0 {
+		var cancel context.CancelFunc
+		lockCtx, cancel = context.WithTimeout(ctx, wait)
+		defer cancel()
+	}
+	var unlockSQL string
+	var arg interface{}
+	if dialect == DialectMySQL {
+		// GET_LOCK waits whole seconds, a shorter wait is rounded up instead of down to 0
+		var got sql.NullInt64
+		err = conn.QueryRowContext(lockCtx, "SELECT GET_LOCK(?, ?)", name, int((wait+time.Second-1)/time.Second)).Scan(&got)
+		if err == nil && got.Int64 != 1 {
+			err = LockBusyErr
+		}
+		unlockSQL, arg = "SELECT RELEASE_LOCK(?)", name
+	} else {
+		h := fnv.New64a()
+		h.Write([]byte(name))
+		key := int64(h.Sum64())
+		if wait > 0 {
+			_, err = conn.ExecContext(lockCtx, "SELECT pg_advisory_lock($1)", key)
+		} else {
+			var got bool
+			err = conn.QueryRowContext(lockCtx, "SELECT pg_try_advisory_lock($1)", key).Scan(&got)
+			if err == nil && !got {
+				err = LockBusyErr
+			}
+		}
+		unlockSQL, arg = "SELECT pg_advisory_unlock($1)", key
+	}
+	if err != nil {
+		_ = conn.Close()
+		if errors.Is(err, LockBusyErr) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("acquire lock %s failed, err=%s", name, err)
+	}
+	return func() {
+		_, _ = conn.ExecContext(context.Background(), unlockSQL, arg)
+		_ = conn.Close()
+	}, nil
+}
@@ -0,0 +1,256 @@
+package xgorm
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// InvalidCursorErr 游标无法解析或不属于当前的 Keyset
+var InvalidCursorErr = errors.New("xgorm: invalid cursor")
+
+// CursorRequest 游标分页请求，Cursor 为空时从第一页开始，翻页时传上一次返回的 Next 或 Prev
+type CursorRequest struct {
+	Cursor string `json:"cursor"`
+	Limit  int    `json:"limit"`
+	// ApproxCount 为true时返回表的估算行数，不执行count
+	ApproxCount bool `json:"approx_count"`
+}
+
+// CursorPage 游标分页结果
+type CursorPage struct {
+	Next    string `json:"next,omitempty"`
+	Prev    string `json:"prev,omitempty"`
+	HasNext bool   `json:"has_next"`
+	HasPrev bool   `json:"has_prev"`
+	// Total 估算行数，只有 ApproxCount 时才有
+	Total int64 `json:"total,omitempty"`
+}
+
+// Keyset 按有序的列做游标分页，WHERE (created_at, id) < (?, ?) 代替 OFFSET，翻页耗时和页码无关
+// 最后一列必须唯一，没有包含主键时会自动追加主键，列不能为NULL
+type Keyset struct {
+	table  string
+	keys   []Sort
+	fields []*schema.Field
+}
+
+type cursor struct {
+	Keys   []string      `json:"k"`
+	Values []interface{} `json:"v"`
+	// Prev 为true时向前翻页
+	Prev bool `json:"p,omitempty"`
+}
+
+// NewKeyset 创建 model 的游标分页，keys 需要有对应的索引
+func NewKeyset(db *gorm.DB, model interface{}, keys ...Sort) (*Keyset, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, fmt.Errorf("parse model schema failed, err=%s", err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("xgorm: keyset needs at least one column")
+	}
+	k := &Keyset{table: stmt.Schema.Table}
+	hasPrimary := false
+	for _, key := range keys {
+		field, ok := stmt.Schema.FieldsByDBName[key.Field]
+		if !ok {
+			return nil, fmt.Errorf("xgorm: model %s has no column %s", stmt.Schema.Name, key.Field)
+		}
+		// NULL 无法比较，生成的游标也无法解析
+		if nullable(field) {
+			return nil, fmt.Errorf("xgorm: keyset column %s of %s is nullable, declare it not null", key.Field, stmt.Schema.Name)
+		}
+		hasPrimary = hasPrimary || field.PrimaryKey
+		k.keys = append(k.keys, key)
+		k.fields = append(k.fields, field)
+	}
+	if primary := stmt.Schema.PrioritizedPrimaryField; !hasPrimary && primary != nil {
+		k.keys = append(k.keys, Sort{Field: primary.DBName, Desc: keys[len(keys)-1].Desc})
+		k.fields = append(k.fields, primary)
+	}
+	return k, nil
+}
+
+// NewBaseModelKeyset 嵌入 BaseModel 的模型按创建时间倒序分页，即 created_at desc, id desc
+func NewBaseModelKeyset(db *gorm.DB, model interface{}) (*Keyset, error) {
+	return NewKeyset(db, model, Sort{Field: "created_at", Desc: true}, Sort{Field: "id", Desc: true})
+}
+
+// Find 查询一页，dest 为模型切片的指针，tx 上已有的条件(如 Filterable.Where)会保留
+func (k *Keyset) Find(tx *gorm.DB, req *CursorRequest, dest interface{}) (*CursorPage, error) {
+	limit := req.Limit
+	switch {
+	case limit > 100:
+		limit = 100
+	case limit <= 0:
+		limit = 10
+	}
+	page := &CursorPage{}
+	if req.ApproxCount {
+		total, err := k.approxCount(tx)
+		if err != nil {
+			return nil, err
+		}
+		page.Total = total
+	}
+
+	var cur *cursor
+	if req.Cursor != "" {
+		var err error
+		if cur, err = k.decode(req.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	backward := cur != nil && cur.Prev
+	if cur != nil {
+		tx = tx.Where(k.after(cur.Values, backward))
+	}
+	for _, key := range k.keys {
+		// 向前翻页时反向排序，取到结果后再反转
+		tx = tx.Order(clause.OrderByColumn{Column: column(key.Field), Desc: key.Desc != backward})
+	}
+	if err := tx.Limit(limit + 1).Find(dest).Error; err != nil {
+		return nil, err
+	}
+
+	rows := reflect.ValueOf(dest).Elem()
+	more := rows.Len() > limit
+	if more {
+		rows.Set(rows.Slice(0, limit))
+	}
+	if backward {
+		for i, j := 0, rows.Len()-1; i < j; i, j = i+1, j-1 {
+			a, b := rows.Index(i).Interface(), rows.Index(j).Interface()
+			rows.Index(i).Set(reflect.ValueOf(b))
+			rows.Index(j).Set(reflect.ValueOf(a))
+		}
+		page.HasNext, page.HasPrev = true, more
+	} else {
+		page.HasNext, page.HasPrev = more, cur != nil
+	}
+	if rows.Len() == 0 {
+		return page, nil
+	}
+	var err error
+	if page.HasNext {
+		if page.Next, err = k.encode(tx.Statement.Context, rows.Index(rows.Len()-1), false); err != nil {
+			return nil, err
+		}
+	}
+	if page.HasPrev {
+		if page.Prev, err = k.encode(tx.Statement.Context, rows.Index(0), true); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// after 生成在游标之后的条件: a > ? OR (a = ? AND b > ?) ...，降序列用 <
+func (k *Keyset) after(values []interface{}, backward bool) clause.Expression {
+	var or []clause.Expression
+	for i, key := range k.keys {
+		and := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			and = append(and, clause.Eq{Column: column(k.keys[j].Field), Value: values[j]})
+		}
+		if key.Desc != backward {
+			and = append(and, clause.Lt{Column: column(key.Field), Value: values[i]})
+		} else {
+			and = append(and, clause.Gt{Column: column(key.Field), Value: values[i]})
+		}
+		or = append(or, clause.And(and...))
+	}
+	return clause.Or(or...)
+}
+
+// nullable 指针和 sql.Scanner 类型(如 BigInt)的列没有声明 not null 时可能为NULL
+func nullable(field *schema.Field) bool {
+	if field.NotNull || field.PrimaryKey {
+		return false
+	}
+	if field.FieldType.Kind() == reflect.Ptr {
+		return true
+	}
+	_, ok := reflect.New(field.FieldType).Interface().(sql.Scanner)
+	return ok
+}
+
+func (k *Keyset) columns() []string {
+	names := make([]string, 0, len(k.keys))
+	for _, key := range k.keys {
+		names = append(names, key.Field)
+	}
+	return names
+}
+
+func (k *Keyset) encode(ctx context.Context, row reflect.Value, prev bool) (string, error) {
+	row = reflect.Indirect(row)
+	c := cursor{Keys: k.columns(), Prev: prev}
+	for _, field := range k.fields {
+		value, _ := field.ValueOf(ctx, row)
+		c.Values = append(c.Values, value)
+	}
+	data, err := json.Marshal(&c)
+	if err != nil {
+		return "", fmt.Errorf("encode cursor failed, err=%s", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func (k *Keyset) decode(s string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, InvalidCursorErr
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// 大整数不经过float64
+	dec.UseNumber()
+	var c cursor
+	if err := dec.Decode(&c); err != nil || len(c.Values) != len(k.keys) || len(c.Keys) != len(k.keys) {
+		return nil, InvalidCursorErr
+	}
+	for i, key := range k.keys {
+		if c.Keys[i] != key.Field {
+			return nil, InvalidCursorErr
+		}
+		value, err := convertValue(k.fields[i], c.Values[i])
+		if err != nil {
+			return nil, InvalidCursorErr
+		}
+		c.Values[i] = value
+	}
+	return &c, nil
+}
+
+// approxCount MySQL和PostgreSQL读取统计信息中的表行数，其他数据库对整张表执行count，都忽略查询条件和软删除
+func (k *Keyset) approxCount(tx *gorm.DB) (int64, error) {
+	var total int64
+	var err error
+	switch tx.Dialector.Name() {
+	case DialectMySQL:
+		err = tx.Session(&gorm.Session{NewDB: true}).
+			Raw("SELECT COALESCE(MAX(TABLE_ROWS), 0) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?", k.table).
+			Scan(&total).Error
+	case DialectPostgres:
+		err = tx.Session(&gorm.Session{NewDB: true}).
+			Raw("SELECT COALESCE(MAX(reltuples), 0)::bigint FROM pg_class WHERE oid = to_regclass(?)", k.table).
+			Scan(&total).Error
+	default:
+		err = tx.Session(&gorm.Session{NewDB: true}).Table(k.table).Count(&total).Error
+	}
+	if err != nil {
+		return 0, fmt.Errorf("count %s failed, err=%s", k.table, err)
+	}
+	return total, nil
+}
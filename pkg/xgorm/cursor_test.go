@@ -0,0 +1,104 @@
+package xgorm
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestKeyset(t *testing.T) {
+	db, err := NewDB(&GormConf{Dialect: DialectSQLite, DB: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&testOrder{}); err != nil {
+		t.Fatal(err)
+	}
+	var orders []*testOrder
+	for i := 0; i < 25; i++ {
+		// created_at has ties, the id breaks them
+		o := &testOrder{Name: "order", Status: i % 2}
+		o.CreatedAt = int64(1000 + i/3)
+		orders = append(orders, o)
+	}
+	if err := db.Create(orders).Error; err != nil {
+		t.Fatal(err)
+	}
+	k, err := NewBaseModelKeyset(db, &testOrder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(list []*testOrder) []uint64 {
+		var out []uint64
+		for _, o := range list {
+			out = append(out, o.ID)
+		}
+		return out
+	}
+	var pages [][]uint64
+	var cursors []string
+	req := &CursorRequest{Limit: 10, ApproxCount: true}
+	for {
+		var list []*testOrder
+		page, err := k.Find(db, req, &list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pages) == 0 && page.Total != 25 {
+			t.Fatalf("total=%d", page.Total)
+		}
+		pages = append(pages, ids(list))
+		cursors = append(cursors, page.Prev)
+		if !page.HasNext {
+			break
+		}
+		req = &CursorRequest{Cursor: page.Next, Limit: 10}
+	}
+	if len(pages) != 3 || len(pages[2]) != 5 {
+		t.Fatalf("pages=%v", pages)
+	}
+	want := uint64(25)
+	for _, page := range pages {
+		for _, id := range page {
+			if id != want {
+				t.Fatalf("pages=%v", pages)
+			}
+			want--
+		}
+	}
+
+	// the estimate is of the whole table, conditions are ignored
+	var list []*testOrder
+	page, err := k.Find(db.Where("status = ?", 1), &CursorRequest{ApproxCount: true}, &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 25 || len(list) != 10 {
+		t.Fatalf("total=%d, rows=%d", page.Total, len(list))
+	}
+
+	// back from the last page to the second one
+	list = nil
+	page, err = k.Find(db, &CursorRequest{Cursor: cursors[2], Limit: 10}, &list)
+	if err != nil || !page.HasPrev || !page.HasNext {
+		t.Fatalf("page=%+v, err=%v", page, err)
+	}
+	if got := ids(list); len(got) != 10 || got[0] != pages[1][0] || got[9] != pages[1][9] {
+		t.Fatalf("prev page=%v, want %v", got, pages[1])
+	}
+
+	// the cursor belongs to another keyset
+	other, err := NewKeyset(db, &testOrder{}, Sort{Field: "status"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Find(db, &CursorRequest{Cursor: cursors[2]}, &list); !errors.Is(err, InvalidCursorErr) {
+		t.Fatalf("err=%v", err)
+	}
+	if _, err := k.Find(db, &CursorRequest{Cursor: "not a cursor"}, &list); !errors.Is(err, InvalidCursorErr) {
+		t.Fatalf("err=%v", err)
+	}
+	if _, err := NewKeyset(db, &testTransfer{}, Sort{Field: "amount"}); err == nil {
+		t.Fatal("nullable key column accepted")
+	}
+}
@@ -0,0 +1,125 @@
+package xgorm
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const (
+	DialectMySQL    = "mysql"
+	DialectPostgres = "postgres"
+	// DialectSQLite 使用纯Go驱动，不需要cgo，适合集成测试
+	DialectSQLite = "sqlite"
+)
+
+var UnsupportedDialectErr = fmt.Errorf("xgorm: %s", "unsupported dialect")
+
+func (c *GormConf) dialect() string {
+	if c.Dialect == "" {
+		return DialectMySQL
+	}
+	return strings.ToLower(c.Dialect)
+}
+
+// Dialector 返回配置对应的gorm驱动
+func Dialector(gormConf *GormConf) (gorm.Dialector, error) {
+	dsn, err := DSN(gormConf)
+	if err != nil {
+		return nil, err
+	}
+	switch gormConf.dialect() {
+	case DialectMySQL:
+		return mysql.Open(dsn), nil
+	case DialectPostgres:
+		return postgres.Open(dsn), nil
+	case DialectSQLite:
+		return sqlite.Open(dsn), nil
+	}
+	return nil, UnsupportedDialectErr
+}
+
+// DSN 按方言生成连接串
+func DSN(gormConf *GormConf) (string, error) {
+	switch gormConf.dialect() {
+	case DialectMySQL:
+		if gormConf.DB == "" || gormConf.Addr == "" || gormConf.User == "" || gormConf.Passwd == "" {
+			return "", RequireConfErr
+		}
+		dsn := fmt.Sprintf("%s:%s@"+"tcp(%s)/%s?charset=%s",
+			gormConf.User, gormConf.Passwd, gormConf.Addr, gormConf.DB, MysqlDefaultCharset)
+		if gormConf.TimeoutSec > 0 {
+			// timeout in seconds has "s"
+			dsn += fmt.Sprintf("&timeout=%ds", gormConf.TimeoutSec)
+		}
+		dsn += "&parseTime=true"
+		return appendOptions(dsn, gormConf.Options), nil
+	case DialectPostgres:
+		if gormConf.DB == "" || gormConf.Addr == "" || gormConf.User == "" || gormConf.Passwd == "" {
+			return "", RequireConfErr
+		}
+		u := url.URL{
+			Scheme: "postgres",
+			User:   url.UserPassword(gormConf.User, gormConf.Passwd),
+			Host:   gormConf.Addr,
+			Path:   "/" + gormConf.DB,
+		}
+		q := url.Values{}
+		if gormConf.TimeoutSec > 0 {
+			q.Set("connect_timeout", fmt.Sprintf("%d", gormConf.TimeoutSec))
+		}
+		u.RawQuery = q.Encode()
+		dsn := u.String()
+		if u.RawQuery == "" {
+			dsn += "?"
+		}
+		return appendOptions(dsn, gormConf.Options), nil
+	case DialectSQLite:
+		if gormConf.DB == "" {
+			return "", fmt.Errorf("xgorm: %s", "db is required")
+		}
+		sep := "?"
+		if strings.Contains(gormConf.DB, "?") {
+			sep = "&"
+		}
+		dsn := gormConf.DB + sep + "_pragma=foreign_keys(1)"
+		if gormConf.TimeoutSec > 0 {
+			dsn += fmt.Sprintf("&_pragma=busy_timeout(%d)", gormConf.TimeoutSec*1000)
+		}
+		return appendOptions(dsn, gormConf.Options), nil
+	}
+	return "", UnsupportedDialectErr
+}
+
+func appendOptions(dsn, options string) string {
+	options = strings.Trim(options, "&")
+	if options == "" {
+		return strings.TrimSuffix(dsn, "?")
+	}
+	if strings.HasSuffix(dsn, "?") {
+		return dsn + options
+	}
+	return dsn + "&" + options
+}
+
+func isSQLiteMemory(db string) bool {
+	return db == ":memory:" || strings.Contains(db, "mode=memory")
+}
+
+// traceAttributes 链路追踪的数据库属性
+func traceAttributes(gormConf *GormConf) []attribute.KeyValue {
+	switch gormConf.dialect() {
+	case DialectPostgres:
+		return []attribute.KeyValue{semconv.DBSystemPostgreSQL, attribute.String("db.addr", gormConf.Addr)}
+	case DialectSQLite:
+		return []attribute.KeyValue{semconv.DBSystemSqlite}
+	}
+	return []attribute.KeyValue{semconv.DBSystemMySQL, attribute.String("db.addr", gormConf.Addr)}
+}
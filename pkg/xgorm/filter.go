@@ -0,0 +1,377 @@
+package xgorm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// InvalidFilterErr 过滤条件或排序不合法，管理后台接口可以直接返回400
+var InvalidFilterErr = errors.New("xgorm: invalid filter")
+
+// FilterOp 过滤操作
+type FilterOp string
+
+const (
+	OpEq  FilterOp = "eq"
+	OpNe  FilterOp = "ne"
+	OpIn  FilterOp = "in"
+	OpGt  FilterOp = "gt"
+	OpGte FilterOp = "gte"
+	OpLt  FilterOp = "lt"
+	OpLte FilterOp = "lte"
+	// OpBetween 闭区间，Values 为 [from, to]
+	OpBetween FilterOp = "between"
+	// OpPrefix 前缀匹配 LIKE 'value%'，value 中的 % 和 _ 会被转义
+	OpPrefix FilterOp = "prefix"
+	// OpNull Value 为 true 时 IS NULL，false 时 IS NOT NULL
+	OpNull FilterOp = "null"
+)
+
+// maxFilterValues in 条件最多的值个数
+const maxFilterValues = 1000
+
+// Filter 单个过滤条件，Field 为数据库列名
+// 值按列的类型转换，时间列和整数时间戳列(如 created_at)可以传 RFC3339 字符串，BigInt 和 Decimal 列传字符串
+// 从JSON解码时数字保留为 json.Number，超过 2^53 的整数不会丢失精度
+type Filter struct {
+	Field  string        `json:"field"`
+	Op     FilterOp      `json:"op"`
+	Value  interface{}   `json:"value,omitempty"`
+	Values []interface{} `json:"values,omitempty"`
+}
+
+// UnmarshalJSON 用 UseNumber 解码 Value 和 Values
+func (f *Filter) UnmarshalJSON(data []byte) error {
+	type filter Filter
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode((*filter)(f))
+}
+
+// Sort 排序
+type Sort struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc,omitempty"`
+}
+
+// Query 列表查询请求，可以直接绑定管理后台的JSON请求
+//
+//	{
+//	  "page": 1,
+//	  "limit": 20,
+//	  "filters": [
+//	    {"field": "status", "op": "in", "values": [1, 2]},
+//	    {"field": "created_at", "op": "between", "values": ["2024-01-01T00:00:00Z", "2024-02-01T00:00:00Z"]},
+//	    {"field": "name", "op": "prefix", "value": "ali"}
+//	  ],
+//	  "sorts": [{"field": "id", "desc": true}]
+//	}
+type Query struct {
+	Page    int      `json:"page"`
+	Limit   int      `json:"limit"`
+	Filters []Filter `json:"filters,omitempty"`
+	Sorts   []Sort   `json:"sorts,omitempty"`
+}
+
+// Filterable 模型可过滤和排序的列，只有白名单中的列能出现在SQL中
+type Filterable struct {
+	model  interface{}
+	fields map[string]*schema.Field
+}
+
+// NewFilterable 从模型的gorm schema生成列白名单，columns 不为空时只允许其中的列
+func NewFilterable(db *gorm.DB, model interface{}, columns ...string) (*Filterable, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, fmt.Errorf("parse model schema failed, err=%s", err)
+	}
+	fields := make(map[string]*schema.Field)
+	if len(columns) == 0 {
+		columns = stmt.Schema.DBNames
+	}
+	for _, column := range columns {
+		field, ok := stmt.Schema.FieldsByDBName[column]
+		if !ok {
+			return nil, fmt.Errorf("xgorm: model %s has no column %s", stmt.Schema.Name, column)
+		}
+		fields[column] = field
+	}
+	return &Filterable{model: model, fields: fields}, nil
+}
+
+// Where 返回 q 中过滤条件和排序的scope，q 为nil时不过滤
+func (f *Filterable) Where(q *Query) (func(*gorm.DB) *gorm.DB, error) {
+	if q == nil {
+		q = &Query{}
+	}
+	var exprs []clause.Expression
+	for _, filter := range q.Filters {
+		expr, err := f.expression(filter)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+	var orders []clause.OrderByColumn
+	for _, s := range q.Sorts {
+		if _, ok := f.fields[s.Field]; !ok {
+			return nil, fmt.Errorf("%w: cannot sort by %s", InvalidFilterErr, s.Field)
+		}
+		orders = append(orders, clause.OrderByColumn{Column: column(s.Field), Desc: s.Desc})
+	}
+	return func(tx *gorm.DB) *gorm.DB {
+		for _, expr := range exprs {
+			tx = tx.Where(expr)
+		}
+		for _, order := range orders {
+			tx = tx.Order(order)
+		}
+		return tx
+	}, nil
+}
+
+// Find 按 q 统计总数并查询一页，dest 为模型切片的指针，q 为nil时查询第一页
+func (f *Filterable) Find(tx *gorm.DB, q *Query, dest interface{}) (int64, error) {
+	if q == nil {
+		q = &Query{}
+	}
+	where, err := f.Where(q)
+	if err != nil {
+		return 0, err
+	}
+	tx = tx.Model(f.model).Scopes(where).Session(&gorm.Session{})
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Scopes(Paginate(q.Page, q.Limit)).Find(dest).Error; err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+func (f *Filterable) expression(filter Filter) (clause.Expression, error) {
+	field, ok := f.fields[filter.Field]
+	if !ok {
+		return nil, fmt.Errorf("%w: cannot filter by %s", InvalidFilterErr, filter.Field)
+	}
+	col := column(filter.Field)
+	switch filter.Op {
+	case OpNull:
+		isNull, ok := filter.Value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s null needs a bool value", InvalidFilterErr, filter.Field)
+		}
+		if isNull {
+			return clause.Eq{Column: col, Value: nil}, nil
+		}
+		return clause.Neq{Column: col, Value: nil}, nil
+	case OpPrefix:
+		prefix, ok := filter.Value.(string)
+		if !ok || prefix == "" || fieldKind(field) != reflect.String {
+			return nil, fmt.Errorf("%w: %s prefix needs a string column and value", InvalidFilterErr, filter.Field)
+		}
+		// ! 作为转义字符，各数据库的字符串字面量中都不需要转义
+		return clause.Expr{SQL: "? LIKE ? ESCAPE '!'", Vars: []interface{}{col, escapeLike(prefix) + "%"}}, nil
+	case OpIn, OpBetween:
+		if filter.Op == OpIn && (len(filter.Values) == 0 || len(filter.Values) > maxFilterValues) {
+			return nil, fmt.Errorf("%w: %s in needs 1 to %d values", InvalidFilterErr, filter.Field, maxFilterValues)
+		}
+		if filter.Op == OpBetween && len(filter.Values) != 2 {
+			return nil, fmt.Errorf("%w: %s between needs 2 values", InvalidFilterErr, filter.Field)
+		}
+		values := make([]interface{}, 0, len(filter.Values))
+		for _, v := range filter.Values {
+			value, err := convertValue(field, v)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		if filter.Op == OpIn {
+			return clause.IN{Column: col, Values: values}, nil
+		}
+		return clause.Expr{SQL: "? BETWEEN ? AND ?", Vars: []interface{}{col, values[0], values[1]}}, nil
+	}
+	value, err := convertValue(field, filter.Value)
+	if err != nil {
+		return nil, err
+	}
+	switch filter.Op {
+	case OpEq:
+		return clause.Eq{Column: col, Value: value}, nil
+	case OpNe:
+		return clause.Neq{Column: col, Value: value}, nil
+	case OpGt:
+		return clause.Gt{Column: col, Value: value}, nil
+	case OpGte:
+		return clause.Gte{Column: col, Value: value}, nil
+	case OpLt:
+		return clause.Lt{Column: col, Value: value}, nil
+	case OpLte:
+		return clause.Lte{Column: col, Value: value}, nil
+	}
+	return nil, fmt.Errorf("%w: unsupported op=%s", InvalidFilterErr, filter.Op)
+}
+
+func column(name string) clause.Column {
+	return clause.Column{Table: clause.CurrentTable, Name: name}
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	bigIntType  = reflect.TypeOf(BigInt{})
+	decimalType = reflect.TypeOf(Decimal{})
+)
+
+func fieldType(field *schema.Field) reflect.Type {
+	t := field.FieldType
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func fieldKind(field *schema.Field) reflect.Kind {
+	return fieldType(field).Kind()
+}
+
+// convertValue 把JSON解码出的值转换为列的类型，避免字符串和数字混用
+func convertValue(field *schema.Field, v interface{}) (interface{}, error) {
+	invalid := fmt.Errorf("%w: invalid value %v for %s", InvalidFilterErr, v, field.DBName)
+	if v == nil {
+		return nil, invalid
+	}
+	if n, ok := v.(json.Number); ok {
+		v = n.String()
+	}
+	t := fieldType(field)
+	switch t {
+	case bigIntType:
+		var b BigInt
+		if s, ok := v.(string); !ok || b.setString(s) != nil {
+			return nil, invalid
+		}
+		return b, nil
+	case decimalType:
+		s, ok := v.(string)
+		if !ok {
+			return nil, invalid
+		}
+		d, err := decimal.NewFromString(s)
+		if err != nil {
+			return nil, invalid
+		}
+		return NewDecimal(d), nil
+	}
+	if t == timeType {
+		switch val := v.(type) {
+		case string:
+			if tm, err := time.Parse(time.RFC3339, val); err == nil {
+				return tm, nil
+			}
+			if i, err := strconv.ParseInt(val, 10, 64); err == nil {
+				return time.Unix(i, 0), nil
+			}
+			return nil, invalid
+		case float64:
+			if !exactInt(val) {
+				return nil, invalid
+			}
+			return time.Unix(int64(val), 0), nil
+		}
+		return nil, invalid
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch val := v.(type) {
+		case float64:
+			// float64 只能精确表示 2^53 以内的整数，更大的值需要 json.Number 或字符串
+			if !exactInt(val) {
+				return nil, invalid
+			}
+			v = strconv.FormatInt(int64(val), 10)
+		}
+		if val, ok := v.(string); ok {
+			if i, err := strconv.ParseInt(val, 10, t.Bits()); err == nil {
+				return i, nil
+			}
+			// 整数时间戳列可以传 RFC3339 时间
+			if tm, err := time.Parse(time.RFC3339, val); err == nil && t.Bits() == 64 {
+				return tm.Unix(), nil
+			}
+		}
+		return nil, invalid
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch val := v.(type) {
+		case float64:
+			if val < 0 || !exactInt(val) {
+				return nil, invalid
+			}
+			v = strconv.FormatUint(uint64(val), 10)
+		}
+		if val, ok := v.(string); ok {
+			if i, err := strconv.ParseUint(val, 10, t.Bits()); err == nil {
+				return i, nil
+			}
+			if tm, err := time.Parse(time.RFC3339, val); err == nil && tm.Unix() >= 0 && t.Bits() == 64 {
+				return uint64(tm.Unix()), nil
+			}
+		}
+		return nil, invalid
+	case reflect.Float32, reflect.Float64:
+		switch val := v.(type) {
+		case float64:
+			return val, nil
+		case string:
+			if f, err := strconv.ParseFloat(val, 64); err == nil {
+				return f, nil
+			}
+		}
+		return nil, invalid
+	case reflect.Bool:
+		switch val := v.(type) {
+		case bool:
+			return val, nil
+		case string:
+			if b, err := strconv.ParseBool(val); err == nil {
+				return b, nil
+			}
+		}
+		return nil, invalid
+	case reflect.String:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		return nil, invalid
+	}
+	// 其他类型(如decimal)由字段的 Valuer 或驱动处理
+	switch v.(type) {
+	case string, float64, bool:
+		return v, nil
+	}
+	return nil, invalid
+}
+
+// maxExactInt 是 float64 能精确表示的最大整数 2^53
+const maxExactInt = 1 << 53
+
+func exactInt(f float64) bool {
+	return f == math.Trunc(f) && math.Abs(f) <= maxExactInt
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
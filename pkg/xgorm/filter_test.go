@@ -0,0 +1,109 @@
+package xgorm
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+type testOrder struct {
+	BaseModel
+	Name   string  `gorm:"column:name;type:varchar(64);not null"`
+	Status int     `gorm:"column:status;not null"`
+	Memo   *string `gorm:"column:memo"`
+}
+
+func TestFilterable(t *testing.T) {
+	db, err := NewDB(&GormConf{Dialect: DialectSQLite, DB: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&testOrder{}); err != nil {
+		t.Fatal(err)
+	}
+	memo := "vip"
+	orders := []*testOrder{
+		{Name: "alice", Status: 1, Memo: &memo},
+		{Name: "al_ice", Status: 2},
+		{Name: "bob", Status: 3},
+		{Name: "alex", Status: 2},
+	}
+	if err := db.Create(orders).Error; err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFilterable(db, &testOrder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	find := func(body string) ([]string, int64, error) {
+		var q Query
+		if err := json.Unmarshal([]byte(body), &q); err != nil {
+			t.Fatal(err)
+		}
+		var list []*testOrder
+		total, err := f.Find(db, &q, &list)
+		var names []string
+		for _, o := range list {
+			names = append(names, o.Name)
+		}
+		return names, total, err
+	}
+	cases := []struct {
+		body  string
+		want  []string
+		total int64
+	}{
+		{`{"filters":[{"field":"status","op":"in","values":[1,2]}],"sorts":[{"field":"id","desc":true}]}`, []string{"alex", "al_ice", "alice"}, 3},
+		{`{"filters":[{"field":"name","op":"prefix","value":"al_"}]}`, []string{"al_ice"}, 1},
+		{`{"filters":[{"field":"memo","op":"null","value":false}]}`, []string{"alice"}, 1},
+		{`{"filters":[{"field":"status","op":"between","values":["2",3]},{"field":"name","op":"ne","value":"bob"}]}`, []string{"al_ice", "alex"}, 2},
+		{`{"filters":[{"field":"created_at","op":"gte","value":"2000-01-01T00:00:00Z"}],"page":2,"limit":3}`, []string{"alex"}, 4},
+	}
+	for _, c := range cases {
+		names, total, err := find(c.body)
+		if err != nil || total != c.total || len(names) != len(c.want) {
+			t.Fatalf("%s: names=%v, total=%d, err=%v", c.body, names, total, err)
+		}
+		for i := range names {
+			if names[i] != c.want[i] {
+				t.Fatalf("%s: names=%v, want %v", c.body, names, c.want)
+			}
+		}
+	}
+
+	for _, body := range []string{
+		`{"filters":[{"field":"name = name or 1","op":"eq","value":"x"}]}`,
+		`{"sorts":[{"field":"(select 1)"}]}`,
+		`{"filters":[{"field":"status","op":"eq","value":"x"}]}`,
+		`{"filters":[{"field":"status","op":"prefix","value":"1"}]}`,
+		`{"filters":[{"field":"status","op":"between","values":[1]}]}`,
+		`{"filters":[{"field":"status","op":"eq","value":9223372036854775808}]}`,
+		`{"filters":[{"field":"status","op":"eq","value":1.5}]}`,
+	} {
+		if _, _, err := find(body); !errors.Is(err, InvalidFilterErr) {
+			t.Fatalf("%s: err=%v", body, err)
+		}
+	}
+
+	// integers above 2^53 keep their precision when decoded as json.Number
+	var q Query
+	if err := json.Unmarshal([]byte(`{"filters":[{"field":"status","op":"eq","value":9007199254740993}]}`), &q); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := convertValue(f.fields["status"], q.Filters[0].Value); err != nil || v != int64(9007199254740993) {
+		t.Fatalf("value=%v, err=%v", v, err)
+	}
+	if _, err := convertValue(f.fields["status"], float64(1<<60)); !errors.Is(err, InvalidFilterErr) {
+		t.Fatalf("inexact float accepted, err=%v", err)
+	}
+
+	var all []*testOrder
+	if total, err := f.Find(db, nil, &all); err != nil || total != 4 || len(all) != 4 {
+		t.Fatalf("nil query total=%d, err=%v", total, err)
+	}
+
+	if _, err := NewFilterable(db, &testOrder{}, "missing"); err == nil {
+		t.Fatal("unknown column accepted")
+	}
+}
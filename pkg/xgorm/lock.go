@@ -0,0 +1,105 @@
+package xgorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ConflictErr 乐观锁冲突，记录已被其他请求修改或不存在
+var ConflictErr = errors.New("xgorm: optimistic lock conflict")
+
+// Version 乐观锁版本号，模型中声明为
+//
+//	Version xgorm.Version `gorm:"column:version;not null;default:0;comment:版本号"`
+type Version int64
+
+// UpdateWithVersion 按主键和 model 当前的版本号更新 updates，版本号加1
+// 成功后 model 的版本号同步加1，版本号不一致时返回 ConflictErr，主键为零值时返回错误
+func UpdateWithVersion(tx *gorm.DB, model interface{}, updates map[string]interface{}) error {
+	s, field, err := versionField(tx, model)
+	if err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(model)
+	if len(s.PrimaryFields) == 0 {
+		return fmt.Errorf("xgorm: model %s has no primary key", s.Name)
+	}
+	conds := make([]clause.Expression, 0, len(s.PrimaryFields)+1)
+	for _, pk := range s.PrimaryFields {
+		v, zero := pk.ValueOf(tx.Statement.Context, rv)
+		if zero {
+			return fmt.Errorf("xgorm: model %s primary key %s is zero", s.Name, pk.DBName)
+		}
+		conds = append(conds, clause.Eq{Column: column(pk.DBName), Value: v})
+	}
+	current, _ := field.ValueOf(tx.Statement.Context, rv)
+	version := current.(Version)
+	conds = append(conds, clause.Eq{Column: column(field.DBName), Value: version})
+
+	values := make(map[string]interface{}, len(updates)+1)
+	for k, v := range updates {
+		values[k] = v
+	}
+	values[field.DBName] = clause.Expr{SQL: "? + 1", Vars: []interface{}{clause.Column{Name: field.DBName}}}
+	res := tx.Model(model).Where(clause.And(conds...)).Updates(values)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ConflictErr
+	}
+	return field.Set(tx.Statement.Context, rv, version+1)
+}
+
+// RetryOnConflict 在 fn 返回 ConflictErr 时重试，最多执行 attempts 次，attempts 小于1时执行1次，fn 每次需要重新读取记录
+//
+//	err := xgorm.RetryOnConflict(ctx, 3, func() error {
+//		var b Balance
+//		// 读后写，从主库读，从库延迟会导致每次都冲突
+//		if err := xgorm.Primary(db).Take(&b, id).Error; err != nil {
+//			return err
+//		}
+//		return xgorm.UpdateWithVersion(db, &b, map[string]interface{}{"amount": b.Amount.Add(delta)})
+//	})
+func RetryOnConflict(ctx context.Context, attempts int, fn func() error) error {
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = fn(); !errors.Is(err, ConflictErr) || i == attempts-1 {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(i+1) * 10 * time.Millisecond):
+		}
+	}
+	return err
+}
+
+var versionType = reflect.TypeOf(Version(0))
+
+func versionField(tx *gorm.DB, model interface{}) (*schema.Schema, *schema.Field, error) {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		return nil, nil, fmt.Errorf("parse model schema failed, err=%s", err)
+	}
+	if reflect.ValueOf(model).Kind() != reflect.Ptr || reflect.Indirect(reflect.ValueOf(model)).Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("xgorm: model must be a pointer to a struct")
+	}
+	for _, field := range stmt.Schema.Fields {
+		if field.FieldType == versionType && field.DBName != "" {
+			return stmt.Schema, field, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("xgorm: model %s has no Version field", stmt.Schema.Name)
+}
@@ -0,0 +1,79 @@
+package xgorm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type testBalance struct {
+	BaseModel
+	Amount  int64   `gorm:"column:amount;not null"`
+	Version Version `gorm:"column:version;not null;default:0"`
+}
+
+func TestUpdateWithVersion(t *testing.T) {
+	db, err := NewDB(&GormConf{Dialect: DialectSQLite, DB: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&testBalance{}); err != nil {
+		t.Fatal(err)
+	}
+	b := &testBalance{Amount: 100}
+	if err := db.Create(b).Error; err != nil {
+		t.Fatal(err)
+	}
+	var stale testBalance
+	if err := db.Take(&stale, b.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := UpdateWithVersion(db, b, map[string]interface{}{"amount": 150}); err != nil || b.Version != 1 {
+		t.Fatalf("version=%d, err=%v", b.Version, err)
+	}
+	if err := UpdateWithVersion(db, &stale, map[string]interface{}{"amount": 90}); !errors.Is(err, ConflictErr) {
+		t.Fatalf("err=%v", err)
+	}
+
+	attempts := 0
+	err = RetryOnConflict(context.Background(), 3, func() error {
+		attempts++
+		var cur testBalance
+		if attempts == 1 {
+			// the first attempt works on the stale copy
+			cur = stale
+		} else if err := db.Take(&cur, b.ID).Error; err != nil {
+			return err
+		}
+		return UpdateWithVersion(db, &cur, map[string]interface{}{"amount": cur.Amount - 10})
+	})
+	if err != nil || attempts != 2 {
+		t.Fatalf("attempts=%d, err=%v", attempts, err)
+	}
+	var got testBalance
+	if err := db.Take(&got, b.ID).Error; err != nil || got.Amount != 140 || got.Version != 2 {
+		t.Fatalf("balance=%+v, err=%v", got, err)
+	}
+	if err := UpdateWithVersion(db, &testUser{}, nil); err == nil {
+		t.Fatal("model without version accepted")
+	}
+	// a zero primary key would update every row with that version
+	if err := UpdateWithVersion(db, &testBalance{Version: 2}, map[string]interface{}{"amount": 0}); err == nil {
+		t.Fatal("zero primary key accepted")
+	}
+
+	// fn runs at least once and there is no backoff after the last attempt
+	for _, n := range []int{0, 1} {
+		calls := 0
+		start := time.Now()
+		err := RetryOnConflict(context.Background(), n, func() error {
+			calls++
+			return ConflictErr
+		})
+		if !errors.Is(err, ConflictErr) || calls != 1 || time.Since(start) >= 10*time.Millisecond {
+			t.Fatalf("attempts=%d, calls=%d, err=%v, took %s", n, calls, err, time.Since(start))
+		}
+	}
+}
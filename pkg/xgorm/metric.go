@@ -18,7 +18,16 @@ var (
 		Namespace: gormNamespace,
 		Subsystem: "requests",
 		Name:      "error_total",
-		Help:      "gorm chain_client requests error count.",
+		Help:      "gorm chain_client requests error count, is_error is true or not_found, the request count is duration_ms_count.",
 		Labels:    []string{"table", "method", "is_error"},
 	})
+
+	metricClientRowsAffected = metric.NewHistogramVec(&metric.HistogramVecOpts{
+		Namespace: gormNamespace,
+		Subsystem: "requests",
+		Name:      "rows_affected",
+		Help:      "gorm chain_client rows affected or returned.",
+		Labels:    []string{"table", "method"},
+		Buckets:   []float64{0, 1, 10, 100, 1000, 10000},
+	})
 )
@@ -0,0 +1,497 @@
+package xgorm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Migration 一个版本的迁移，Up/Down 为Go函数，UpSQL/DownSQL 为SQL，同一方向只能设置一个
+// 每个迁移在一个事务中执行，MySQL的DDL会隐式提交，失败时需要手动处理
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+	UpSQL   string
+	DownSQL string
+}
+
+// checksum SQL迁移为SQL内容的sha256，Go迁移只能校验名字
+func (m *Migration) checksum() string {
+	content := m.UpSQL + "\n--down\n" + m.DownSQL
+	if m.Up != nil {
+		content = "go:" + m.Name
+	}
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// SchemaMigration 已执行的迁移
+type SchemaMigration struct {
+	BaseModel
+	Version    int64  `gorm:"column:version;not null;uniqueIndex:uk_version;comment:迁移版本"`
+	Name       string `gorm:"column:name;type:varchar(255);not null;comment:迁移名称"`
+	Checksum   string `gorm:"column:checksum;type:varchar(64);not null;comment:迁移内容的sha256"`
+	DurationMs int64  `gorm:"column:duration_ms;not null;default:0;comment:执行耗时"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationStatus 迁移状态，Missing 为已执行但没有注册的迁移
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt int64
+	Missing   bool
+}
+
+// MigratorConfig 迁移配置
+// LockName 为MySQL GET_LOCK 和PostgreSQL advisory lock 的名字，LockTimeout 为等待锁的时间
+type MigratorConfig struct {
+	LockName    string
+	LockTimeout time.Duration
+}
+
+// Migrator 按版本顺序执行迁移，多个实例同时启动时只有拿到锁的实例执行
+type Migrator struct {
+	db         *gorm.DB
+	conf       MigratorConfig
+	migrations map[int64]*Migration
+	// dryRun 不为nil时只输出SQL，不执行
+	dryRun io.Writer
+}
+
+func NewMigrator(db *gorm.DB, conf *MigratorConfig) *Migrator {
+	c := MigratorConfig{}
+	if conf != nil {
+		c = *conf
+	}
+	if c.LockName == "" {
+		c.LockName = "xgorm:schema_migrations"
+	}
+	if c.LockTimeout <= 0 {
+		c.LockTimeout = time.Minute
+	}
+	return &Migrator{db: Primary(db).Session(&gorm.Session{}), conf: c, migrations: make(map[int64]*Migration)}
+}
+
+// WithDryRun 返回只把SQL输出到 out 的 Migrator，Go迁移中的查询不会返回数据
+func (m *Migrator) WithDryRun(out io.Writer) *Migrator {
+	mm := *m
+	mm.dryRun = out
+	return &mm
+}
+
+// Register 注册迁移，版本不能重复
+func (m *Migrator) Register(migrations ...*Migration) error {
+	for _, mig := range migrations {
+		if mig.Version <= 0 || mig.Name == "" {
+			return fmt.Errorf("xgorm: migration needs a positive version and a name")
+		}
+		if (mig.Up == nil) == (mig.UpSQL == "") || mig.Down != nil && mig.DownSQL != "" {
+			return fmt.Errorf("xgorm: migration %d needs one of Up and UpSQL and at most one of Down and DownSQL", mig.Version)
+		}
+		if _, ok := m.migrations[mig.Version]; ok {
+			return fmt.Errorf("xgorm: migration %d is registered twice", mig.Version)
+		}
+		m.migrations[mig.Version] = mig
+	}
+	return nil
+}
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// RegisterFS 注册 dir 下的SQL文件，如 embed.FS，文件名为 0001_create_user.up.sql 和 0001_create_user.down.sql
+func (m *Migrator) RegisterFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return fmt.Errorf("read migrations failed, err=%s", err)
+	}
+	found := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("read migration %s failed, err=%s", entry.Name(), err)
+		}
+		mig, ok := found[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: match[2]}
+			found[version] = mig
+		} else if mig.Name != match[2] {
+			return fmt.Errorf("xgorm: migration %d has names %s and %s", version, mig.Name, match[2])
+		}
+		if match[3] == "up" {
+			mig.UpSQL = string(data)
+		} else {
+			mig.DownSQL = string(data)
+		}
+	}
+	for _, mig := range found {
+		if err := m.Register(mig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) sorted() []*Migration {
+	list := make([]*Migration, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		list = append(list, mig)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list
+}
+
+// Up 执行版本不大于 target 的未执行迁移，target 为0时执行全部，返回执行的版本
+func (m *Migrator) Up(ctx context.Context, target int64) ([]int64, error) {
+	var done []int64
+	err := m.locked(ctx, func(applied map[int64]*SchemaMigration) error {
+		for _, mig := range m.sorted() {
+			if target > 0 && mig.Version > target {
+				break
+			}
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, mig, true); err != nil {
+				return err
+			}
+			done = append(done, mig.Version)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down 回滚最近执行的 steps 个迁移，返回回滚的版本
+func (m *Migrator) Down(ctx context.Context, steps int) ([]int64, error) {
+	var done []int64
+	err := m.locked(ctx, func(applied map[int64]*SchemaMigration) error {
+		list := m.sorted()
+		for i := len(list) - 1; i >= 0 && len(done) < steps; i-- {
+			mig := list[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == nil && mig.DownSQL == "" {
+				return fmt.Errorf("xgorm: migration %d %s cannot be rolled back", mig.Version, mig.Name)
+			}
+			if err := m.apply(ctx, mig, false); err != nil {
+				return err
+			}
+			done = append(done, mig.Version)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status 返回所有注册的和已执行的迁移
+func (m *Migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var list []*MigrationStatus
+	for _, mig := range m.sorted() {
+		s := &MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if a, ok := applied[mig.Version]; ok {
+			s.Applied, s.AppliedAt = true, a.CreatedAt
+			delete(applied, mig.Version)
+		}
+		list = append(list, s)
+	}
+	for _, a := range applied {
+		list = append(list, &MigrationStatus{Version: a.Version, Name: a.Name, Applied: true, AppliedAt: a.CreatedAt, Missing: true})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// locked 拿到锁后校验已执行迁移的checksum再执行fn，dry run 时不加锁
+func (m *Migrator) locked(ctx context.Context, fn func(applied map[int64]*SchemaMigration) error) error {
+	if m.dryRun == nil {
+		unlock, err := m.lock(ctx)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		if err := m.db.WithContext(ctx).AutoMigrate(&SchemaMigration{}); err != nil {
+			return fmt.Errorf("create schema_migrations failed, err=%s", err)
+		}
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	for version, a := range applied {
+		if mig, ok := m.migrations[version]; ok && mig.checksum() != a.Checksum {
+			return fmt.Errorf("xgorm: migration %d %s was changed after it was applied", version, mig.Name)
+		}
+	}
+	return fn(applied)
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]*SchemaMigration, error) {
+	applied := make(map[int64]*SchemaMigration)
+	if !m.db.Migrator().HasTable(&SchemaMigration{}) {
+		return applied, nil
+	}
+	var list []*SchemaMigration
+	if err := m.db.WithContext(ctx).Find(&list).Error; err != nil {
+		return nil, fmt.Errorf("find schema_migrations failed, err=%s", err)
+	}
+	for _, a := range list {
+		applied[a.Version] = a
+	}
+	return applied, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, mig *Migration, up bool) error {
+	run := func(tx *gorm.DB) error {
+		switch {
+		case up && mig.Up != nil:
+			return mig.Up(tx)
+		case up:
+			return execSQL(tx, mig.UpSQL)
+		case mig.Down != nil:
+			return mig.Down(tx)
+		}
+		return execSQL(tx, mig.DownSQL)
+	}
+	direction := "up"
+	if !up {
+		direction = "down"
+	}
+	if m.dryRun != nil {
+		capture := &sqlCapture{}
+		if err := run(m.db.WithContext(ctx).Session(&gorm.Session{DryRun: true, Logger: capture})); err != nil {
+			return fmt.Errorf("migration %d %s %s failed, err=%s", mig.Version, mig.Name, direction, err)
+		}
+		fmt.Fprintf(m.dryRun, "-- %d %s %s\n", mig.Version, mig.Name, direction)
+		for _, s := range capture.sqls {
+			fmt.Fprintf(m.dryRun, "%s;\n", s)
+		}
+		return nil
+	}
+	start := time.Now()
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := run(tx); err != nil {
+			return fmt.Errorf("migration %d %s %s failed, err=%s", mig.Version, mig.Name, direction, err)
+		}
+		if !up {
+			return tx.Unscoped().Where("version = ?", mig.Version).Delete(&SchemaMigration{}).Error
+		}
+		return tx.Create(&SchemaMigration{
+			Version:    mig.Version,
+			Name:       mig.Name,
+			Checksum:   mig.checksum(),
+			DurationMs: time.Since(start).Milliseconds(),
+		}).Error
+	})
+}
+
+// lock 加迁移锁，SQLite 本身只允许一个写事务，只在进程内互斥
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+	unlock, err := advisoryLock(ctx, m.db, m.conf.LockName, m.conf.LockTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("acquire migration lock %s failed, err=%s", m.conf.LockName, err)
+	}
+	return unlock, nil
+}
+
+// execSQL 按分号拆分语句逐条执行，引号、注释和PostgreSQL的 $$ 函数体中的分号不拆分
+func execSQL(tx *gorm.DB, content string) error {
+	for _, stmt := range splitStatements(content, tx.Dialector.Name()) {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitStatements 拆分SQL，MySQL的字符串和PostgreSQL以 E 开头的字符串中反斜杠转义下一个字符
+// -- 注释被去掉，/* */ 注释保留，MySQL 的 /*! */ 仍会执行
+func splitStatements(content, dialect string) []string {
+	var list []string
+	var b strings.Builder
+	runes := []rune(content)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			if i < len(runes) {
+				b.WriteRune('\n')
+			}
+			continue
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			end := indexRunes(runes, i+2, []rune("*/")) + 2
+			b.WriteString(string(runes[i:end]))
+			i = end - 1
+			continue
+		case r == '\'' || r == '"' || r == '`':
+			escape := r != '`' && (dialect == DialectMySQL || dialect == DialectPostgres && r == '\'' && i > 0 &&
+				(runes[i-1] == 'E' || runes[i-1] == 'e') && (i == 1 || !isIdentRune(runes[i-2])))
+			j := i + 1
+			for ; j < len(runes) && runes[j] != r; j++ {
+				if escape && runes[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(runes) {
+				j = len(runes) - 1
+			}
+			b.WriteString(string(runes[i : j+1]))
+			i = j
+			continue
+		case r == '$' && dialect != DialectMySQL && (i == 0 || !isIdentRune(runes[i-1])):
+			if tag := dollarTag(runes[i:]); tag != nil {
+				end := indexRunes(runes, i+len(tag), tag) + len(tag)
+				b.WriteString(string(runes[i:end]))
+				i = end - 1
+				continue
+			}
+		case r == ';':
+			if s := strings.TrimSpace(b.String()); s != "" {
+				list = append(list, s)
+			}
+			b.Reset()
+			continue
+		}
+		b.WriteRune(r)
+	}
+	if s := strings.TrimSpace(b.String()); s != "" {
+		list = append(list, s)
+	}
+	return list
+}
+
+// dollarTag 返回 $tag$ 形式的开头，不是时返回nil，$1 这样的参数不是
+func dollarTag(runes []rune) []rune {
+	for j := 1; j < len(runes); j++ {
+		switch {
+		case runes[j] == '$':
+			return runes[:j+1]
+		case runes[j] == '_' || unicode.IsLetter(runes[j]) || j > 1 && unicode.IsDigit(runes[j]):
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// indexRunes 返回 from 之后 sep 的位置，没有时返回 len(runes)-len(sep)，即一直到结尾
+func indexRunes(runes []rune, from int, sep []rune) int {
+	for i := from; i+len(sep) <= len(runes); i++ {
+		if string(runes[i:i+len(sep)]) == string(sep) {
+			return i
+		}
+	}
+	return len(runes) - len(sep)
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// sqlCapture 记录 dry run 生成的SQL
+type sqlCapture struct {
+	sqls []string
+}
+
+func (c *sqlCapture) LogMode(logger.LogLevel) logger.Interface {
+	return c
+}
+
+func (c *sqlCapture) Info(context.Context, string, ...interface{}) {}
+
+func (c *sqlCapture) Warn(context.Context, string, ...interface{}) {}
+
+func (c *sqlCapture) Error(context.Context, string, ...interface{}) {}
+
+func (c *sqlCapture) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if s, _ := fc(); s != "" {
+		c.sqls = append(c.sqls, s)
+	}
+}
+
+// Command 命令行入口，args 为 up [-to version] [-dry-run]、down [-steps n] [-dry-run] 或 status
+//
+//	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+//		err := migrator.Command(ctx, os.Args[2:], os.Stdout)
+//	}
+func (m *Migrator) Command(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: up [-to version] [-dry-run] | down [-steps n] [-dry-run] | status")
+	}
+	fset := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fset.SetOutput(out)
+	to := fset.Int64("to", 0, "migrate up to this version, 0 for all")
+	steps := fset.Int("steps", 1, "number of migrations to roll back")
+	dryRun := fset.Bool("dry-run", false, "print the SQL without running it")
+	if err := fset.Parse(args[1:]); err != nil {
+		return err
+	}
+	mm := m
+	if *dryRun {
+		mm = m.WithDryRun(out)
+	}
+	switch args[0] {
+	case "up":
+		done, err := mm.Up(ctx, *to)
+		if !*dryRun {
+			fmt.Fprintf(out, "applied %v\n", done)
+		}
+		return err
+	case "down":
+		done, err := mm.Down(ctx, *steps)
+		if !*dryRun {
+			fmt.Fprintf(out, "rolled back %v\n", done)
+		}
+		return err
+	case "status":
+		list, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range list {
+			state := "pending"
+			switch {
+			case s.Missing:
+				state = "missing"
+			case s.Applied:
+				state = "applied at " + time.Unix(s.AppliedAt, 0).Format(time.RFC3339)
+			}
+			fmt.Fprintf(out, "%d\t%s\t%s\n", s.Version, s.Name, state)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown migrate command %s", args[0])
+}
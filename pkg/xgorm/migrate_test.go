@@ -0,0 +1,103 @@
+package xgorm
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gorm.io/gorm"
+)
+
+func TestMigrator(t *testing.T) {
+	db, err := NewDB(&GormConf{Dialect: DialectSQLite, DB: t.TempDir() + "/migrate.db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := fstest.MapFS{
+		"migrations/0001_create_wallet.up.sql":   {Data: []byte("-- wallets; one per user\nCREATE TABLE wallet (id integer PRIMARY KEY, label varchar(64) DEFAULT 'a;b');\nCREATE INDEX idx_wallet_label ON wallet (label);")},
+		"migrations/0001_create_wallet.down.sql": {Data: []byte("DROP TABLE wallet;")},
+		"migrations/README.md":                   {Data: []byte("ignored")},
+	}
+	newMigrator := func() *Migrator {
+		m := NewMigrator(db, nil)
+		if err := m.RegisterFS(files, "migrations"); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Register(&Migration{
+			Version: 2,
+			Name:    "create_user",
+			Up:      func(tx *gorm.DB) error { return tx.AutoMigrate(&testUser{}) },
+			Down:    func(tx *gorm.DB) error { return tx.Migrator().DropTable(&testUser{}) },
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	m := newMigrator()
+	ctx := context.Background()
+
+	var out bytes.Buffer
+	if done, err := m.WithDryRun(&out).Up(ctx, 0); err != nil || len(done) != 2 {
+		t.Fatalf("done=%v, err=%v", done, err)
+	}
+	if !strings.Contains(out.String(), "CREATE TABLE wallet") || !strings.Contains(out.String(), "CREATE TABLE `test_user`") {
+		t.Fatalf("dry run output=%s", out.String())
+	}
+	if db.Migrator().HasTable("wallet") || db.Migrator().HasTable(&SchemaMigration{}) {
+		t.Fatal("dry run changed the schema")
+	}
+
+	if done, err := m.Up(ctx, 1); err != nil || len(done) != 1 || done[0] != 1 {
+		t.Fatalf("done=%v, err=%v", done, err)
+	}
+	if done, err := m.Up(ctx, 0); err != nil || len(done) != 1 || done[0] != 2 {
+		t.Fatalf("done=%v, err=%v", done, err)
+	}
+	if !db.Migrator().HasTable("wallet") || !db.Migrator().HasIndex("wallet", "idx_wallet_label") || !db.Migrator().HasTable(&testUser{}) {
+		t.Fatal("migrations were not applied")
+	}
+
+	out.Reset()
+	if err := m.Command(ctx, []string{"down", "-steps", "1"}, &out); err != nil || db.Migrator().HasTable(&testUser{}) {
+		t.Fatalf("output=%s, err=%v", out.String(), err)
+	}
+	out.Reset()
+	if err := m.Command(ctx, []string{"status"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "applied at") || !strings.HasSuffix(lines[1], "pending") {
+		t.Fatalf("status=%s", out.String())
+	}
+
+	// an applied SQL migration must not change
+	files["migrations/0001_create_wallet.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE wallet (id integer PRIMARY KEY);")}
+	if _, err := newMigrator().Up(ctx, 0); err == nil || !strings.Contains(err.Error(), "changed") {
+		t.Fatalf("err=%v", err)
+	}
+	if err := m.Register(&Migration{Version: 1, Name: "again", UpSQL: "SELECT 1"}); err == nil {
+		t.Fatal("duplicate version accepted")
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	plpgsql := `CREATE FUNCTION touch() RETURNS trigger AS $body$
+BEGIN
+	NEW.updated_at := now(); -- keep; the body
+	RETURN NEW;
+END;
+$body$ LANGUAGE plpgsql;
+/* a; comment */ CREATE TRIGGER t BEFORE UPDATE ON wallet FOR EACH ROW EXECUTE FUNCTION touch();
+SELECT $$a;b$$, $1, E'it\'s; fine', 'c:\';`
+	got := splitStatements(plpgsql, DialectPostgres)
+	if len(got) != 3 || !strings.HasSuffix(got[0], "$body$ LANGUAGE plpgsql") || !strings.HasPrefix(got[1], "/* a; comment */") ||
+		got[2] != `SELECT $$a;b$$, $1, E'it\'s; fine', 'c:\'` {
+		t.Fatalf("statements=%q", got)
+	}
+	got = splitStatements(`INSERT INTO t VALUES ('it\'s; fine', "a\";b"); /*!40101 SET NAMES utf8mb4 */;`, DialectMySQL)
+	if len(got) != 2 || got[1] != "/*!40101 SET NAMES utf8mb4 */" {
+		t.Fatalf("statements=%q", got)
+	}
+}
@@ -0,0 +1,216 @@
+package xgorm
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// BigInt 链上整数金额(wei、sun等)，nil 存为 NULL，JSON 为字符串
+// MySQL 为 DECIMAL(65,0)，MySQL的DECIMAL最多65位，uint256最多78位，超过65位的值写入时返回错误；PostgreSQL 为 NUMERIC(78,0)
+// SQLite 只用于测试，存为 TEXT 保证不丢精度，比较是字符串比较，SUM 会转为浮点数
+type BigInt struct {
+	*big.Int
+}
+
+func NewBigInt(x *big.Int) BigInt {
+	return BigInt{Int: x}
+}
+
+// Scan implements the Scanner interface.
+func (b *BigInt) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		b.Int = nil
+		return nil
+	case int64:
+		b.Int = big.NewInt(v)
+		return nil
+	case float64:
+		f := new(big.Float).SetFloat64(v)
+		if !f.IsInt() {
+			return fmt.Errorf("scan big int failed, %v is not an integer", v)
+		}
+		b.Int, _ = f.Int(nil)
+		return nil
+	case []byte:
+		return b.setString(string(v))
+	case string:
+		return b.setString(v)
+	}
+	return fmt.Errorf("scan big int failed, unsupported type %T", value)
+}
+
+func (b *BigInt) setString(s string) error {
+	x, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return fmt.Errorf("invalid big int %q", s)
+	}
+	b.Int = x
+	return nil
+}
+
+// Value implements the driver Valuer interface.
+func (b BigInt) Value() (driver.Value, error) {
+	if b.Int == nil {
+		return nil, nil
+	}
+	return b.Int.String(), nil
+}
+
+// 各数据库列能保存的最大位数
+const (
+	mysqlMaxDigits    = 65
+	postgresMaxDigits = 78
+)
+
+// GormValue 实现 gorm.Valuer，按数据库检查位数，避免 MySQL 截断或报出难以定位的错误
+func (b BigInt) GormValue(ctx context.Context, db *gorm.DB) clause.Expr {
+	if b.Int == nil {
+		return clause.Expr{SQL: "?", Vars: []interface{}{nil}}
+	}
+	s := b.Int.String()
+	max := 0
+	switch db.Dialector.Name() {
+	case DialectMySQL:
+		max = mysqlMaxDigits
+	case DialectPostgres:
+		max = postgresMaxDigits
+	}
+	if digits := len(strings.TrimPrefix(s, "-")); max > 0 && digits > max {
+		_ = db.AddError(fmt.Errorf("xgorm: big int has %d digits, %s column holds at most %d", digits, db.Dialector.Name(), max))
+	}
+	return clause.Expr{SQL: "?", Vars: []interface{}{s}}
+}
+
+func (b BigInt) MarshalJSON() ([]byte, error) {
+	if b.Int == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(b.Int.String())
+}
+
+// UnmarshalJSON 接受字符串和数字
+func (b *BigInt) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		b.Int = nil
+		return nil
+	}
+	return b.setString(string(bytes.Trim(data, `"`)))
+}
+
+func (BigInt) GormDataType() string {
+	return "decimal"
+}
+
+func (BigInt) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	switch db.Dialector.Name() {
+	case DialectMySQL:
+		return "DECIMAL(65,0)"
+	case DialectPostgres:
+		return "NUMERIC(78,0)"
+	}
+	return "TEXT"
+}
+
+// Decimal 带小数的金额，JSON 为字符串
+// 精度由 precision 和 scale 标签指定，默认 DECIMAL(65,18)
+type Decimal struct {
+	decimal.Decimal
+}
+
+func NewDecimal(d decimal.Decimal) Decimal {
+	return Decimal{Decimal: d}
+}
+
+func (Decimal) GormDataType() string {
+	return "decimal"
+}
+
+func (Decimal) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	precision, scale := 65, 18
+	if field.Precision > 0 {
+		precision, scale = field.Precision, field.Scale
+	}
+	switch db.Dialector.Name() {
+	case DialectMySQL:
+		return fmt.Sprintf("DECIMAL(%d,%d)", precision, scale)
+	case DialectPostgres:
+		return fmt.Sprintf("NUMERIC(%d,%d)", precision, scale)
+	}
+	return "TEXT"
+}
+
+// SumBigInt 求 tx 条件下 column 的和，没有记录时为0
+//
+//	SumBigInt(db.Model(&Transfer{}).Where("token = ?", token), "amount")
+func SumBigInt(tx *gorm.DB, column string) (*big.Int, error) {
+	var sum BigInt
+	if err := sumColumn(tx, column, &sum); err != nil {
+		return nil, err
+	}
+	return sum.Int, nil
+}
+
+// SumDecimal 求 tx 条件下 column 的和，没有记录时为0
+func SumDecimal(tx *gorm.DB, column string) (decimal.Decimal, error) {
+	var sum Decimal
+	if err := sumColumn(tx, column, &sum); err != nil {
+		return decimal.Zero, err
+	}
+	return sum.Decimal, nil
+}
+
+func sumColumn(tx *gorm.DB, col string, dest interface{}) error {
+	tx = tx.Select("COALESCE(SUM(?), 0)", clause.Column{Name: col})
+	row := tx.Row()
+	if row == nil {
+		return fmt.Errorf("sum %s failed, err=%s", col, tx.Error)
+	}
+	if err := row.Scan(dest); err != nil {
+		return fmt.Errorf("sum %s failed, err=%s", col, err)
+	}
+	return nil
+}
+
+// Compare 金额比较条件，op 只支持 eq ne gt gte lt lte，其他 op 执行查询时返回 InvalidFilterErr
+//
+//	db.Where(xgorm.Compare("amount", xgorm.OpGte, xgorm.NewBigInt(min)))
+func Compare(col string, op FilterOp, value driver.Valuer) clause.Expression {
+	c := column(col)
+	switch op {
+	case OpEq:
+		return clause.Eq{Column: c, Value: value}
+	case OpNe:
+		return clause.Neq{Column: c, Value: value}
+	case OpGt:
+		return clause.Gt{Column: c, Value: value}
+	case OpGte:
+		return clause.Gte{Column: c, Value: value}
+	case OpLt:
+		return clause.Lt{Column: c, Value: value}
+	case OpLte:
+		return clause.Lte{Column: c, Value: value}
+	}
+	return errorExpr{err: fmt.Errorf("%w: unsupported compare op=%s", InvalidFilterErr, op)}
+}
+
+// errorExpr 构建SQL时把 err 加到语句上，查询不会执行
+type errorExpr struct {
+	err error
+}
+
+func (e errorExpr) Build(builder clause.Builder) {
+	if stmt, ok := builder.(*gorm.Statement); ok {
+		_ = stmt.AddError(e.err)
+	}
+}
@@ -0,0 +1,123 @@
+package xgorm
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+type testTransfer struct {
+	BaseModel
+	Amount BigInt  `gorm:"column:amount"`
+	Fee    Decimal `gorm:"column:fee;precision:36;scale:18"`
+}
+
+func TestNumeric(t *testing.T) {
+	db, err := NewDB(&GormConf{Dialect: DialectSQLite, DB: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&testTransfer{}); err != nil {
+		t.Fatal(err)
+	}
+	huge := new(big.Int).Lsh(big.NewInt(1), 200)
+	transfers := []*testTransfer{
+		{Amount: NewBigInt(huge), Fee: NewDecimal(decimal.RequireFromString("0.000000000000000001"))},
+		{Amount: NewBigInt(big.NewInt(5)), Fee: NewDecimal(decimal.RequireFromString("1.5"))},
+		{},
+	}
+	if err := db.Create(transfers).Error; err != nil {
+		t.Fatal(err)
+	}
+	var got testTransfer
+	if err := db.Take(&got, transfers[0].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Amount.Cmp(huge) != 0 || !got.Fee.Equal(transfers[0].Fee.Decimal) {
+		t.Fatalf("amount=%s, fee=%s", got.Amount, got.Fee)
+	}
+	var empty testTransfer
+	if err := db.Take(&empty, transfers[2].ID).Error; err != nil || empty.Amount.Int != nil {
+		t.Fatalf("amount=%v, err=%v", empty.Amount, err)
+	}
+
+	data, err := json.Marshal(&transfers[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	_ = json.Unmarshal(data, &decoded)
+	if decoded["Amount"] != "5" || decoded["Fee"] != "1.5" {
+		t.Fatalf("json=%s", data)
+	}
+	var back testTransfer
+	if err := json.Unmarshal([]byte(`{"Amount": 42, "Fee": "0.1"}`), &back); err != nil || back.Amount.Int64() != 42 {
+		t.Fatalf("amount=%v, err=%v", back.Amount, err)
+	}
+
+	sum, err := SumBigInt(db.Model(&testTransfer{}).Where(Compare("amount", OpEq, NewBigInt(big.NewInt(5)))), "amount")
+	if err != nil || sum.Int64() != 5 {
+		t.Fatalf("sum=%v, err=%v", sum, err)
+	}
+	if err := db.Where(Compare("amount", "like", NewBigInt(big.NewInt(5)))).Find(&[]*testTransfer{}).Error; !errors.Is(err, InvalidFilterErr) {
+		t.Fatalf("unsupported op err=%v", err)
+	}
+	fee, err := SumDecimal(db.Model(&testTransfer{}).Where("id = ?", transfers[1].ID), "fee")
+	if err != nil || !fee.Equal(decimal.RequireFromString("1.5")) {
+		t.Fatalf("fee=%s, err=%v", fee, err)
+	}
+
+	f, err := NewFilterable(db, &testTransfer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list []*testTransfer
+	if _, err := f.Find(db, &Query{Filters: []Filter{{Field: "amount", Op: OpEq, Value: huge.String()}}}, &list); err != nil || len(list) != 1 {
+		t.Fatalf("list=%d, err=%v", len(list), err)
+	}
+
+	// MySQL DECIMAL(65,0) cannot hold every uint256, the write fails with a clear error
+	mysqlDB, err := gorm.Open(mysql.New(mysql.Config{DSN: "user:pass@tcp(127.0.0.1:3306)/db", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	max := new(big.Int).Sub(new(big.Int).Exp(big.NewInt(10), big.NewInt(65), nil), big.NewInt(1))
+	if err := mysqlDB.Create(&testTransfer{Amount: NewBigInt(max)}).Error; err != nil {
+		t.Fatalf("65 digits err=%v", err)
+	}
+	uint256 := new(big.Int).Lsh(big.NewInt(1), 255)
+	if err := mysqlDB.Create(&testTransfer{Amount: NewBigInt(uint256)}).Error; err == nil || !strings.Contains(err.Error(), "at most 65") {
+		t.Fatalf("uint256 err=%v", err)
+	}
+
+	s, err := schema.Parse(&testTransfer{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		dialector gorm.Dialector
+		amount    string
+		fee       string
+	}{
+		{mysql.Dialector{}, "DECIMAL(65,0)", "DECIMAL(36,18)"},
+		{postgres.Dialector{}, "NUMERIC(78,0)", "NUMERIC(36,18)"},
+	} {
+		db := &gorm.DB{Config: &gorm.Config{Dialector: c.dialector}}
+		if got := (BigInt{}).GormDBDataType(db, s.FieldsByDBName["amount"]); got != c.amount {
+			t.Fatalf("amount type=%s", got)
+		}
+		if got := (Decimal{}).GormDBDataType(db, s.FieldsByDBName["fee"]); got != c.fee {
+			t.Fatalf("fee type=%s", got)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package xgorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OutboxStatus 事件投递状态
+type OutboxStatus int8
+
+const (
+	OutboxPending OutboxStatus = iota
+	OutboxDelivered
+	// OutboxDead 超过最大重试次数，不再投递，同一key后面的事件继续投递
+	OutboxDead
+)
+
+// OutboxEvent 发件箱事件，和业务数据在同一个事务中写入，由 Relay 投递
+type OutboxEvent struct {
+	BaseModel
+	AggregateKey string       `gorm:"column:aggregate_key;type:varchar(128);not null;index:idx_aggregate_status,priority:1;uniqueIndex:uk_aggregate_seq,priority:1;comment:聚合key，同一key的事件按seq顺序投递"`
+	Seq          int64        `gorm:"column:seq;not null;default:0;uniqueIndex:uk_aggregate_seq,priority:2;comment:同一key内的序号，在写入事务中分配"`
+	Topic        string       `gorm:"column:topic;type:varchar(128);not null;comment:事件主题"`
+	Payload      []byte       `gorm:"column:payload;not null;comment:事件内容"`
+	Status       OutboxStatus `gorm:"column:status;not null;default:0;index:idx_aggregate_status,priority:2;index:idx_status_next,priority:1;comment:0待投递 1已投递 2放弃"`
+	Attempts     int          `gorm:"column:attempts;not null;default:0;comment:投递次数"`
+	NextAttempt  int64        `gorm:"column:next_attempt;not null;default:0;index:idx_status_next,priority:2;comment:下次投递时间"`
+	DeliveredAt  int64        `gorm:"column:delivered_at;not null;default:0;comment:投递时间"`
+	LastError    string       `gorm:"column:last_error;type:varchar(512);not null;default:'';comment:最后一次投递错误"`
+}
+
+func (OutboxEvent) TableName() string {
+	return "outbox_event"
+}
+
+// Enqueue 写入事件，tx 为业务数据所在的事务
+// 事件的 Seq 为同一key已有的最大 Seq 加1，自增id不代表提交顺序，投递按 Seq 排序
+// 同一key并发写入时，后提交的事务因 uk_aggregate_seq 冲突失败，需要重试整个事务
+//
+//	db.Transaction(func(tx *gorm.DB) error {
+//		if err := tx.Create(&deposit).Error; err != nil {
+//			return err
+//		}
+//		return xgorm.Enqueue(tx, deposit.Address, "deposit.credited", payload)
+//	})
+func Enqueue(tx *gorm.DB, aggregateKey, topic string, payload []byte) error {
+	if aggregateKey == "" || topic == "" {
+		return fmt.Errorf("xgorm: outbox aggregate key and topic are required")
+	}
+	if payload == nil {
+		payload = []byte{}
+	}
+	var seq int64
+	err := Primary(tx).Unscoped().Model(&OutboxEvent{}).Where("aggregate_key = ?", aggregateKey).
+		Select("COALESCE(MAX(seq), 0)").Scan(&seq).Error
+	if err != nil {
+		return fmt.Errorf("find outbox seq failed, err=%s", err)
+	}
+	return tx.Create(&OutboxEvent{AggregateKey: aggregateKey, Seq: seq + 1, Topic: topic, Payload: payload}).Error
+}
+
+// Publisher 投递事件，返回nil表示投递成功，同一事件可能被投递多次，消费方需要按 ID 去重
+type Publisher interface {
+	Publish(ctx context.Context, event *OutboxEvent) error
+}
+
+// PublisherFunc 函数形式的 Publisher
+type PublisherFunc func(ctx context.Context, event *OutboxEvent) error
+
+func (f PublisherFunc) Publish(ctx context.Context, event *OutboxEvent) error {
+	return f(ctx, event)
+}
+
+// OutboxConfig Relay 的配置
+// MaxAttempts 为0时一直重试，同一key后面的事件会一直等待
+// Retention 为已投递事件保留的时间，0表示不清理
+// LockName 为多个实例之间互斥的锁名，同一张表只有拿到锁的 Relay 投递
+type OutboxConfig struct {
+	BatchSize      int
+	PollInterval   time.Duration
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	MaxAttempts    int
+	Retention      time.Duration
+	LockName       string
+}
+
+// Relay 把发件箱中的事件投递给 Publisher，至少投递一次
+// 每个key同时只投递最早的待投递事件，每次投递前加锁，多个实例时只有一个在投递
+type Relay struct {
+	db   *gorm.DB
+	pub  Publisher
+	conf OutboxConfig
+	now  func() time.Time
+}
+
+func NewRelay(db *gorm.DB, pub Publisher, conf *OutboxConfig) *Relay {
+	c := *conf
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = time.Second
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = 5 * time.Minute
+	}
+	if c.LockName == "" {
+		c.LockName = "xgorm:outbox_relay"
+	}
+	// 从库有延迟，读写都在主库
+	return &Relay{db: Primary(db).Session(&gorm.Session{}), pub: pub, conf: c, now: time.Now}
+}
+
+// AutoMigrate creates or updates the outbox_event table
+func (r *Relay) AutoMigrate() error {
+	return r.db.AutoMigrate(&OutboxEvent{})
+}
+
+// Run 定时投递和清理，直到ctx结束
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.conf.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.RelayOnce(ctx); err != nil {
+				logx.WithContext(ctx).Errorf("xgorm outbox relay failed, err=%s", err)
+			}
+			if r.conf.Retention > 0 {
+				if _, err := r.Cleanup(ctx); err != nil {
+					logx.WithContext(ctx).Errorf("xgorm outbox cleanup failed, err=%s", err)
+				}
+			}
+		}
+	}
+}
+
+// RelayOnce 投递当前所有可投递的事件，返回投递成功的个数，其他实例正在投递时返回0
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	unlock, err := advisoryLock(ctx, r.db, r.conf.LockName, 0)
+	if errors.Is(err, LockBusyErr) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	delivered := 0
+	for {
+		events, err := r.heads(ctx)
+		if err != nil {
+			return delivered, err
+		}
+		progress := 0
+		for _, event := range events {
+			ok, err := r.deliver(ctx, event)
+			if err != nil {
+				return delivered, err
+			}
+			if ok {
+				progress++
+			}
+		}
+		delivered += progress
+		// 投递成功后同一key的下一个事件成为最早的事件，全部失败时等到下次投递时间
+		if progress == 0 {
+			return delivered, nil
+		}
+	}
+}
+
+// heads 每个key Seq 最小的待投递事件中已到投递时间的
+func (r *Relay) heads(ctx context.Context) ([]*OutboxEvent, error) {
+	var events []*OutboxEvent
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND next_attempt <= ?", OutboxPending, r.now().Unix()).
+		Where("NOT EXISTS (SELECT 1 FROM outbox_event e WHERE e.aggregate_key = outbox_event.aggregate_key AND e.status = ? AND e.seq < outbox_event.seq AND e.deleted_at = 0)", OutboxPending).
+		Order("id").Limit(r.conf.BatchSize).Find(&events).Error
+	if err != nil {
+		return nil, fmt.Errorf("find outbox events failed, err=%s", err)
+	}
+	return events, nil
+}
+
+func (r *Relay) deliver(ctx context.Context, event *OutboxEvent) (bool, error) {
+	perr := r.pub.Publish(ctx, event)
+	now := r.now()
+	updates := map[string]interface{}{"attempts": gorm.Expr("attempts + 1")}
+	if perr == nil {
+		updates["status"], updates["delivered_at"], updates["last_error"] = OutboxDelivered, now.Unix(), ""
+	} else {
+		msg := perr.Error()
+		if len(msg) > 512 {
+			msg = msg[:512]
+		}
+		updates["last_error"] = msg
+		if r.conf.MaxAttempts > 0 && event.Attempts+1 >= r.conf.MaxAttempts {
+			updates["status"] = OutboxDead
+			logx.WithContext(ctx).Errorf("xgorm outbox event %d of %s dead after %d attempts, err=%s", event.ID, event.AggregateKey, event.Attempts+1, msg)
+		} else {
+			updates["next_attempt"] = now.Add(r.backoff(event.Attempts + 1)).Unix()
+		}
+	}
+	err := r.db.WithContext(ctx).Model(&OutboxEvent{}).
+		Where("id = ? AND status = ?", event.ID, OutboxPending).Updates(updates).Error
+	if err != nil {
+		// 已投递的事件会被再次投递
+		return false, fmt.Errorf("update outbox event %d failed, err=%s", event.ID, err)
+	}
+	return perr == nil, nil
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.conf.InitialBackoff
+	for i := 1; i < attempts && d < r.conf.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.conf.MaxBackoff {
+		d = r.conf.MaxBackoff
+	}
+	return d
+}
+
+// Cleanup 物理删除投递超过 Retention 的事件，返回删除的个数
+func (r *Relay) Cleanup(ctx context.Context) (int64, error) {
+	before := r.now().Add(-r.conf.Retention).Unix()
+	var total int64
+	for {
+		var ids []uint64
+		err := r.db.WithContext(ctx).Model(&OutboxEvent{}).
+			Where("status = ? AND delivered_at < ?", OutboxDelivered, before).
+			Limit(r.conf.BatchSize).Pluck("id", &ids).Error
+		if err != nil {
+			return total, fmt.Errorf("find delivered outbox events failed, err=%s", err)
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+		res := r.db.WithContext(ctx).Unscoped().Where(clause.IN{Column: column("id"), Values: uint64Values(ids)}).Delete(&OutboxEvent{})
+		if res.Error != nil {
+			return total, fmt.Errorf("delete outbox events failed, err=%s", res.Error)
+		}
+		total += res.RowsAffected
+		if len(ids) < r.conf.BatchSize {
+			return total, nil
+		}
+	}
+}
+
+func uint64Values(list []uint64) []interface{} {
+	values := make([]interface{}, 0, len(list))
+	for _, v := range list {
+		values = append(values, v)
+	}
+	return values
+}
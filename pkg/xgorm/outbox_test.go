@@ -0,0 +1,167 @@
+package xgorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestOutbox(t *testing.T) {
+	db, err := NewDB(&GormConf{Dialect: DialectSQLite, DB: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var published []string
+	failures := map[string]int{"a1": 1, "c1": 100}
+	relay := NewRelay(db, PublisherFunc(func(ctx context.Context, e *OutboxEvent) error {
+		name := string(e.Payload)
+		if failures[name] > 0 {
+			failures[name]--
+			return errors.New("broker unavailable")
+		}
+		published = append(published, name)
+		return nil
+	}), &OutboxConfig{MaxAttempts: 3, Retention: time.Hour})
+	now := time.Now()
+	relay.now = func() time.Time { return now }
+	if err := relay.AutoMigrate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the event is written or rolled back with the business row
+	_ = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&testUser{Name: "alice"}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := Enqueue(tx, "x", "user.created", []byte("x1")); err != nil {
+			t.Fatal(err)
+		}
+		return errors.New("rollback")
+	})
+	for _, e := range [][2]string{{"a", "a1"}, {"b", "b1"}, {"a", "a2"}, {"c", "c1"}, {"c", "c2"}} {
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return Enqueue(tx, e[0], "deposit.credited", []byte(e[1]))
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a1 fails, so a2 waits for it while b1 is delivered
+	if n, err := relay.RelayOnce(context.Background()); err != nil || n != 1 || len(published) != 1 || published[0] != "b1" {
+		t.Fatalf("delivered=%d, published=%v, err=%v", n, published, err)
+	}
+	// c1 gives up after 3 attempts and c2 follows
+	for i := 0; i < 3; i++ {
+		now = now.Add(10 * time.Minute)
+		if _, err := relay.RelayOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"b1", "a1", "a2", "c2"}
+	if len(published) != len(want) {
+		t.Fatalf("published=%v", published)
+	}
+	for i := range want {
+		if published[i] != want[i] {
+			t.Fatalf("published=%v, want %v", published, want)
+		}
+	}
+	var dead OutboxEvent
+	if err := db.Where("payload = ?", []byte("c1")).Take(&dead).Error; err != nil || dead.Status != OutboxDead || dead.Attempts != 3 {
+		t.Fatalf("event=%+v, err=%v", dead, err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if n, err := relay.Cleanup(context.Background()); err != nil || n != 4 {
+		t.Fatalf("cleaned=%d, err=%v", n, err)
+	}
+}
+
+func TestOutboxSingleRelay(t *testing.T) {
+	db, err := NewDB(&GormConf{Dialect: DialectSQLite, DB: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var other *Relay
+	published := 0
+	relay := NewRelay(db, PublisherFunc(func(ctx context.Context, e *OutboxEvent) error {
+		// another relay started while this one is delivering skips the round
+		if n, err := other.RelayOnce(ctx); err != nil || n != 0 {
+			t.Fatalf("concurrent relay delivered=%d, err=%v", n, err)
+		}
+		published++
+		return nil
+	}), &OutboxConfig{})
+	other = NewRelay(db, PublisherFunc(func(ctx context.Context, e *OutboxEvent) error {
+		t.Fatal("event published by two relays")
+		return nil
+	}), &OutboxConfig{})
+	if err := relay.AutoMigrate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Enqueue(db, "a", "deposit.credited", []byte("a1")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := relay.RelayOnce(context.Background()); err != nil || n != 1 || published != 1 {
+		t.Fatalf("delivered=%d, published=%d, err=%v", n, published, err)
+	}
+	// the lock is released after the round
+	unlock, err := advisoryLock(context.Background(), db, "xgorm:outbox_relay", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+}
+
+func TestOutboxSeqOrder(t *testing.T) {
+	db, err := NewDB(&GormConf{Dialect: DialectSQLite, DB: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var published []string
+	relay := NewRelay(db, PublisherFunc(func(ctx context.Context, e *OutboxEvent) error {
+		published = append(published, string(e.Payload))
+		return nil
+	}), &OutboxConfig{})
+	if err := relay.AutoMigrate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Enqueue(db, "a", "deposit.credited", []byte("a1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Enqueue(db, "a", "deposit.credited", []byte("a2")); err != nil {
+		t.Fatal(err)
+	}
+	var seqs []int64
+	_ = db.Model(&OutboxEvent{}).Order("id").Pluck("seq", &seqs)
+	if len(seqs) != 2 || seqs[0] != 1 || seqs[1] != 2 {
+		t.Fatalf("seqs=%v", seqs)
+	}
+	// the id was taken before the other transaction committed, seq decides the order
+	if err := db.Create(&OutboxEvent{BaseModel: BaseModel{ID: 100}, AggregateKey: "b", Seq: 2, Topic: "t", Payload: []byte("b2")}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&OutboxEvent{BaseModel: BaseModel{ID: 101}, AggregateKey: "b", Seq: 1, Topic: "t", Payload: []byte("b1")}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := Enqueue(db, "b", "t", nil); err != nil {
+		t.Fatal(err)
+	}
+	// a concurrent writer that picked the same seq fails
+	if err := db.Create(&OutboxEvent{AggregateKey: "a", Seq: 2, Topic: "t", Payload: []byte{}}).Error; err == nil {
+		t.Fatal("duplicate seq accepted")
+	}
+	if _, err := relay.RelayOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(published); got != "[a1 b1 a2 b2 ]" {
+		t.Fatalf("published=%s", got)
+	}
+}
@@ -1,6 +1,10 @@
 package xgorm
 
+// GormConf 数据库配置，Dialect 为 mysql、postgres 或 sqlite，sqlite 的 DB 为文件路径或 :memory:
+// Options 为追加到 DSN 的 a=1&b=2 参数
+// Replicas 为只读从库地址，账号和库名与主库相同，读请求按 ReplicaPolicy 路由到健康的从库
 type GormConf struct {
+	Dialect      string `json:",default=mysql,options=mysql|postgres|sqlite"`
 	DB           string
 	Addr         string
 	User         string
@@ -10,5 +14,11 @@ type GormConf struct {
 	MaxOpenConns int    `json:",default=10"`
 	Metric       bool   `json:",default=true"`
 	Trace        bool   `json:",default=true"`
+	SlowQueryMs  int    `json:",default=500"`
 	Options      string `json:",default=''"`
+
+	Replicas         []string `json:",optional"`
+	ReplicaPolicy    string   `json:",default=round_robin,options=round_robin|latency"`
+	MaxReplicaLagSec int      `json:",default=10"`
+	HealthCheckSec   int      `json:",default=5"`
 }
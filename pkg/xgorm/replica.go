@@ -0,0 +1,326 @@
+package xgorm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/zeromicro/go-zero/core/logx"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+const (
+	ReplicaPolicyRoundRobin = "round_robin"
+	// ReplicaPolicyLatency 按 ping 延迟的倒数加权随机选择从库
+	ReplicaPolicyLatency = "latency"
+)
+
+// LagFunc 返回从库的复制延迟
+type LagFunc func(ctx context.Context, db *sql.DB) (time.Duration, error)
+
+type replica struct {
+	addr    string
+	db      *sql.DB
+	healthy bool
+	latency time.Duration
+	lag     time.Duration
+}
+
+// ReplicaSet 读写分离的从库集合，实现 dbresolver.Policy
+// 写请求和事务走主库，读请求走健康的从库，没有健康的从库时读主库
+type ReplicaSet struct {
+	policy  string
+	maxLag  time.Duration
+	primary gorm.ConnPool
+	lagFunc LagFunc
+	next    uint64
+	done    chan struct{}
+	once    sync.Once
+
+	mu       sync.RWMutex
+	replicas []*replica
+	byPool   map[gorm.ConnPool]*replica
+}
+
+// Primary 强制在主库读，用于写后立即读；配置了从库时 AutoMigrate 也要在主库执行
+func Primary(db *gorm.DB) *gorm.DB {
+	return db.Clauses(dbresolver.Write)
+}
+
+// NewDBWithReplicas 与 NewDB 相同，同时返回从库集合，没有配置从库时为nil
+func NewDBWithReplicas(gormConf *GormConf) (*gorm.DB, *ReplicaSet, error) {
+	db, err := newDB(gormConf)
+	if err != nil {
+		return nil, nil, err
+	}
+	set, err := useReplicas(db, gormConf)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, set, nil
+}
+
+func useReplicas(db *gorm.DB, gormConf *GormConf) (*ReplicaSet, error) {
+	if len(gormConf.Replicas) == 0 {
+		return nil, nil
+	}
+	set := &ReplicaSet{
+		policy:  gormConf.ReplicaPolicy,
+		maxLag:  time.Duration(gormConf.MaxReplicaLagSec) * time.Second,
+		lagFunc: defaultLagFunc(gormConf.dialect()),
+		byPool:  make(map[gorm.ConnPool]*replica),
+		done:    make(chan struct{}),
+	}
+	if set.maxLag <= 0 {
+		set.maxLag = 10 * time.Second
+	}
+	dialectors := make([]gorm.Dialector, 0, len(gormConf.Replicas))
+	for _, addr := range gormConf.Replicas {
+		conf := *gormConf
+		conf.Addr, conf.Replicas = addr, nil
+		if conf.dialect() == DialectSQLite {
+			conf.DB = addr
+		}
+		dialector, err := Dialector(&conf)
+		if err != nil {
+			return nil, err
+		}
+		// 先打开连接池，dbresolver 复用这个连接池，健康检查才能对应到从库
+		rdb, err := gorm.Open(dialector, &gorm.Config{Logger: &ormLog{}})
+		if err != nil {
+			set.closeReplicas()
+			return nil, fmt.Errorf("open replica %s failed, err=%s", addr, err)
+		}
+		sqlDB, err := rdb.DB()
+		if err != nil {
+			set.closeReplicas()
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(gormConf.MaxOpenConns)
+		sqlDB.SetMaxIdleConns(gormConf.MaxIdleConns)
+		r := &replica{addr: addr, db: sqlDB, healthy: true}
+		set.replicas = append(set.replicas, r)
+		set.byPool[sqlDB] = r
+		dialectors = append(dialectors, connDialector(conf.dialect(), sqlDB))
+	}
+	// 主库也注册为候选，dbresolver 只有一个从库时不调用 Policy，没有健康从库时由 Resolve 回退到主库
+	primary, err := db.DB()
+	if err != nil {
+		set.closeReplicas()
+		return nil, err
+	}
+	set.primary = primary
+	dialectors = append(dialectors, connDialector(gormConf.dialect(), primary))
+	if err := db.Use(dbresolver.Register(dbresolver.Config{Replicas: dialectors, Policy: set})); err != nil {
+		set.closeReplicas()
+		return nil, err
+	}
+
+	interval := time.Duration(gormConf.HealthCheckSec) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), interval)
+	set.Check(ctx)
+	cancel()
+	go set.run(interval)
+	return set, nil
+}
+
+func connDialector(dialect string, conn *sql.DB) gorm.Dialector {
+	switch dialect {
+	case DialectPostgres:
+		return postgres.New(postgres.Config{Conn: conn})
+	case DialectSQLite:
+		return &sqlite.Dialector{Conn: conn}
+	}
+	return mysql.New(mysql.Config{Conn: conn})
+}
+
+// SetLagFunc 替换复制延迟的查询方法
+func (s *ReplicaSet) SetLagFunc(f LagFunc) {
+	s.mu.Lock()
+	s.lagFunc = f
+	s.mu.Unlock()
+}
+
+// Resolve 实现 dbresolver.Policy
+func (s *ReplicaSet) Resolve(pools []gorm.ConnPool) gorm.ConnPool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	healthy := make([]*replica, 0, len(pools))
+	for _, pool := range pools {
+		if r, ok := s.byPool[pool]; ok && r.healthy {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		return s.primary
+	}
+	if s.policy == ReplicaPolicyLatency {
+		return pickByLatency(healthy).db
+	}
+	return healthy[atomic.AddUint64(&s.next, 1)%uint64(len(healthy))].db
+}
+
+func pickByLatency(replicas []*replica) *replica {
+	weights := make([]float64, len(replicas))
+	var total float64
+	for i, r := range replicas {
+		latency := r.latency
+		if latency < time.Millisecond {
+			latency = time.Millisecond
+		}
+		weights[i] = 1 / float64(latency)
+		total += weights[i]
+	}
+	n := rand.Float64() * total
+	for i, w := range weights {
+		if n < w {
+			return replicas[i]
+		}
+		n -= w
+	}
+	return replicas[len(replicas)-1]
+}
+
+// Check ping 所有从库并查询复制延迟，失败或延迟超过 MaxReplicaLagSec 的从库不再接收读请求
+func (s *ReplicaSet) Check(ctx context.Context) {
+	s.mu.RLock()
+	replicas, lagFunc := s.replicas, s.lagFunc
+	s.mu.RUnlock()
+	for _, r := range replicas {
+		start := time.Now()
+		err := r.db.PingContext(ctx)
+		latency := time.Since(start)
+		var lag time.Duration
+		if err == nil && lagFunc != nil {
+			lag, err = lagFunc(ctx, r.db)
+		}
+		healthy := err == nil && lag <= s.maxLag
+		s.mu.Lock()
+		if healthy != r.healthy {
+			logx.WithContext(ctx).Infof("xgorm replica %s healthy=%v, lag=%s, err=%v", r.addr, healthy, lag, err)
+		}
+		r.healthy, r.latency, r.lag = healthy, latency, lag
+		s.mu.Unlock()
+	}
+}
+
+// Healthy 返回当前健康的从库地址
+func (s *ReplicaSet) Healthy() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []string
+	for _, r := range s.replicas {
+		if r.healthy {
+			list = append(list, r.addr)
+		}
+	}
+	return list
+}
+
+// Close 停止健康检查并关闭从库连接池，主库连接池由调用方关闭，关闭后不要再用 db 读
+func (s *ReplicaSet) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.done)
+		err = s.closeReplicas()
+	})
+	return err
+}
+
+func (s *ReplicaSet) closeReplicas() error {
+	var errs []error
+	for _, r := range s.replicas {
+		if err := r.db.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close replica %s failed, err=%s", r.addr, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *ReplicaSet) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		s.Check(ctx)
+		cancel()
+	}
+}
+
+func defaultLagFunc(dialect string) LagFunc {
+	switch dialect {
+	case DialectMySQL:
+		return mysqlLag
+	case DialectPostgres:
+		return postgresLag
+	}
+	return nil
+}
+
+// mysqlLag 读取 SHOW REPLICA STATUS 的 Seconds_Behind_Source，旧版本为 SHOW SLAVE STATUS
+func mysqlLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	rows, err := db.QueryContext(ctx, "SHOW REPLICA STATUS")
+	if err != nil {
+		if rows, err = db.QueryContext(ctx, "SHOW SLAVE STATUS"); err != nil {
+			return 0, err
+		}
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		return 0, fmt.Errorf("not a replica")
+	}
+	values := make([]sql.RawBytes, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+	for i, col := range cols {
+		if col == "Seconds_Behind_Source" || col == "Seconds_Behind_Master" {
+			if values[i] == nil {
+				return 0, fmt.Errorf("replication is not running")
+			}
+			sec, err := strconv.ParseInt(string(values[i]), 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return time.Duration(sec) * time.Second, nil
+		}
+	}
+	return 0, fmt.Errorf("replica status has no lag column")
+}
+
+// postgresLag 已回放到接收的位置时延迟为0，否则主库空闲时 now() - 最后回放时间会一直增长
+func postgresLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	var sec float64
+	err := db.QueryRowContext(ctx, "SELECT CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0 "+
+		"ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0) END").Scan(&sec)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(sec * float64(time.Second)), nil
+}
@@ -0,0 +1,239 @@
+package xgorm
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// DeletedAt 软删除时间的unix秒，0表示未删除
+// 查询和更新自动加 deleted_at = 0 条件，Delete 改为把它更新为当前时间，Unscoped 时不处理
+// 历史数据中为NULL的行需要先更新为0
+type DeletedAt int64
+
+// Scan implements the Scanner interface.
+func (d *DeletedAt) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*d = 0
+	case int64:
+		*d = DeletedAt(v)
+	case []byte:
+		var i int64
+		if _, err := fmt.Sscan(string(v), &i); err != nil {
+			return fmt.Errorf("scan deleted_at failed, err=%s", err)
+		}
+		*d = DeletedAt(i)
+	default:
+		return fmt.Errorf("scan deleted_at failed, unsupported type %T", value)
+	}
+	return nil
+}
+
+// Value implements the driver Valuer interface.
+func (d DeletedAt) Value() (driver.Value, error) {
+	return int64(d), nil
+}
+
+// Deleted 是否已删除
+func (d DeletedAt) Deleted() bool {
+	return d != 0
+}
+
+func (DeletedAt) QueryClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{softDeleteQueryClause{field: f}}
+}
+
+func (DeletedAt) UpdateClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{softDeleteUpdateClause{field: f}}
+}
+
+func (DeletedAt) DeleteClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{softDeleteDeleteClause{field: f}}
+}
+
+type softDeleteQueryClause struct {
+	field *schema.Field
+}
+
+func (sd softDeleteQueryClause) Name() string {
+	return ""
+}
+
+func (sd softDeleteQueryClause) Build(clause.Builder) {
+}
+
+func (sd softDeleteQueryClause) MergeClause(*clause.Clause) {
+}
+
+func (sd softDeleteQueryClause) ModifyStatement(stmt *gorm.Statement) {
+	if _, ok := stmt.Clauses["soft_delete_enabled"]; ok || stmt.Unscoped {
+		return
+	}
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		// 单独的 Or 条件要先和其他条件合并，否则 deleted_at = 0 只和最后一个条件 AND
+		if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) >= 1 {
+			for _, expr := range where.Exprs {
+				if orCond, ok := expr.(clause.OrConditions); ok && len(orCond.Exprs) == 1 {
+					where.Exprs = []clause.Expression{clause.And(where.Exprs...)}
+					c.Expression = where
+					stmt.Clauses["WHERE"] = c
+					break
+				}
+			}
+		}
+	}
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: sd.field.DBName}, Value: 0},
+	}})
+	stmt.Clauses["soft_delete_enabled"] = clause.Clause{}
+}
+
+type softDeleteUpdateClause struct {
+	field *schema.Field
+}
+
+func (sd softDeleteUpdateClause) Name() string {
+	return ""
+}
+
+func (sd softDeleteUpdateClause) Build(clause.Builder) {
+}
+
+func (sd softDeleteUpdateClause) MergeClause(*clause.Clause) {
+}
+
+func (sd softDeleteUpdateClause) ModifyStatement(stmt *gorm.Statement) {
+	if stmt.SQL.Len() == 0 && !stmt.Unscoped {
+		softDeleteQueryClause(sd).ModifyStatement(stmt)
+	}
+}
+
+type softDeleteDeleteClause struct {
+	field *schema.Field
+}
+
+func (sd softDeleteDeleteClause) Name() string {
+	return ""
+}
+
+func (sd softDeleteDeleteClause) Build(clause.Builder) {
+}
+
+func (sd softDeleteDeleteClause) MergeClause(*clause.Clause) {
+}
+
+// ModifyStatement 把 DELETE 改为 UPDATE ... SET deleted_at = 当前时间
+func (sd softDeleteDeleteClause) ModifyStatement(stmt *gorm.Statement) {
+	if stmt.SQL.Len() != 0 || stmt.Unscoped {
+		return
+	}
+	now := stmt.DB.NowFunc().Unix()
+	stmt.AddClause(clause.Set{{Column: clause.Column{Name: sd.field.DBName}, Value: now}})
+	stmt.SetColumn(sd.field.DBName, now, true)
+
+	if stmt.Schema != nil {
+		_, queryValues := schema.GetIdentityFieldValuesMap(stmt.Context, stmt.ReflectValue, stmt.Schema.PrimaryFields)
+		column, values := schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, queryValues)
+		if len(values) > 0 {
+			stmt.AddClause(clause.Where{Exprs: []clause.Expression{clause.IN{Column: column, Values: values}}})
+		}
+		if stmt.ReflectValue.CanAddr() && stmt.Dest != stmt.Model && stmt.Model != nil {
+			_, queryValues = schema.GetIdentityFieldValuesMap(stmt.Context, reflect.ValueOf(stmt.Model), stmt.Schema.PrimaryFields)
+			column, values = schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, queryValues)
+			if len(values) > 0 {
+				stmt.AddClause(clause.Where{Exprs: []clause.Expression{clause.IN{Column: column, Values: values}}})
+			}
+		}
+	}
+
+	softDeleteQueryClause(sd).ModifyStatement(stmt)
+	stmt.AddClauseIfNotExists(clause.Update{})
+	stmt.Build(stmt.DB.Callback().Update().Clauses...)
+}
+
+// Restore 恢复 tx 条件匹配的已删除记录，未删除的记录不会被更新
+// 条件为空且 model 没有主键时和 Update 一样返回 gorm.ErrMissingWhereClause
+//
+//	xgorm.Restore(db.Where("id = ?", id), &Order{})
+func Restore(tx *gorm.DB, model interface{}) *gorm.DB {
+	// 错误加到新实例上，不能污染传入的根 db
+	tx = tx.Unscoped().Model(model)
+	field, err := deletedAtField(tx, model)
+	if err != nil {
+		_ = tx.AddError(err)
+		return tx
+	}
+	// 下面加的 deleted_at 条件会绕过 gorm 的检查，先按 gorm 的规则检查
+	if _, ok := tx.Statement.Clauses["WHERE"]; !ok && !tx.AllowGlobalUpdate {
+		primary := field.Schema.PrioritizedPrimaryField
+		if primary == nil || isZero(tx, primary, model) {
+			_ = tx.AddError(gorm.ErrMissingWhereClause)
+			return tx
+		}
+	}
+	return tx.Where(clause.Gt{Column: column(field.DBName), Value: 0}).Update(field.DBName, 0)
+}
+
+// Purge 物理删除软删除超过 retention 的记录，每批最多删除 batchSize 条，返回删除的总数
+func Purge(tx *gorm.DB, model interface{}, retention time.Duration, batchSize int) (int64, error) {
+	field, err := deletedAtField(tx, model)
+	if err != nil {
+		return 0, err
+	}
+	primary := field.Schema.PrioritizedPrimaryField
+	if primary == nil {
+		return 0, fmt.Errorf("xgorm: model %s has no primary key", field.Schema.Name)
+	}
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	before := tx.NowFunc().Add(-retention).Unix()
+	var total int64
+	for {
+		var ids []interface{}
+		err := tx.Unscoped().Model(model).
+			Where(clause.Gt{Column: column(field.DBName), Value: 0}).
+			Where(clause.Lt{Column: column(field.DBName), Value: before}).
+			Limit(batchSize).Pluck(primary.DBName, &ids).Error
+		if err != nil {
+			return total, fmt.Errorf("find deleted %s failed, err=%s", field.Schema.Table, err)
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+		result := tx.Unscoped().Where(clause.IN{Column: column(primary.DBName), Values: ids}).Delete(model)
+		if result.Error != nil {
+			return total, fmt.Errorf("purge %s failed, err=%s", field.Schema.Table, result.Error)
+		}
+		total += result.RowsAffected
+		if len(ids) < batchSize {
+			return total, nil
+		}
+	}
+}
+
+var deletedAtType = reflect.TypeOf(DeletedAt(0))
+
+func isZero(tx *gorm.DB, field *schema.Field, model interface{}) bool {
+	_, zero := field.ValueOf(tx.Statement.Context, reflect.Indirect(reflect.ValueOf(model)))
+	return zero
+}
+
+func deletedAtField(tx *gorm.DB, model interface{}) (*schema.Field, error) {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		return nil, fmt.Errorf("parse model schema failed, err=%s", err)
+	}
+	for _, field := range stmt.Schema.Fields {
+		if field.FieldType == deletedAtType && field.DBName != "" {
+			return field, nil
+		}
+	}
+	return nil, fmt.Errorf("xgorm: model %s has no DeletedAt field", stmt.Schema.Name)
+}
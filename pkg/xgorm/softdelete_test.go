@@ -0,0 +1,92 @@
+package xgorm
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestSoftDelete(t *testing.T) {
+	db, err := NewDB(&GormConf{Dialect: DialectSQLite, DB: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	users := []*testUser{{Name: "alice"}, {Name: "bob"}, {Name: "carol"}}
+	if err := db.Create(users).Error; err != nil {
+		t.Fatal(err)
+	}
+	count := func(tx *gorm.DB) int64 {
+		var n int64
+		if err := tx.Model(&testUser{}).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if err := db.Delete(users[0]).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Where("name = ?", "bob").Delete(&testUser{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n := count(db); n != 1 {
+		t.Fatalf("count=%d", n)
+	}
+	// an Or condition must not bypass the filter
+	if n := count(db.Where("name = ?", "alice").Or("name = ?", "carol")); n != 1 {
+		t.Fatalf("or count=%d", n)
+	}
+	var deleted testUser
+	if err := db.Unscoped().Where("name = ?", "alice").Take(&deleted).Error; err != nil || !deleted.DeletedAt.Deleted() {
+		t.Fatalf("user=%+v, err=%v", deleted, err)
+	}
+
+	if err := Restore(db, &testUser{}).Error; !errors.Is(err, gorm.ErrMissingWhereClause) {
+		t.Fatalf("restore without condition, err=%v", err)
+	}
+	if err := Restore(db.Where("name = ?", "alice"), &testUser{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n := count(db); n != 2 {
+		t.Fatalf("count after restore=%d", n)
+	}
+	// live rows matching the condition are left alone
+	if err := db.Model(&testUser{}).Where("name = ?", "carol").UpdateColumn("updated_at", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if res := Restore(db.Where("name IN ?", []string{"alice", "carol"}), &testUser{}); res.Error != nil || res.RowsAffected != 0 {
+		t.Fatalf("restore live rows affected=%d, err=%v", res.RowsAffected, res.Error)
+	}
+	var carol testUser
+	if err := db.Where("name = ?", "carol").Take(&carol).Error; err != nil || carol.UpdatedAt != 1 {
+		t.Fatalf("user=%+v, err=%v", carol, err)
+	}
+	// the primary key of model is enough as a condition
+	if err := db.Delete(&carol).Error; err != nil {
+		t.Fatal(err)
+	}
+	if res := Restore(db, &testUser{BaseModel: BaseModel{ID: carol.ID}}); res.Error != nil || res.RowsAffected != 1 {
+		t.Fatalf("restore by id affected=%d, err=%v", res.RowsAffected, res.Error)
+	}
+
+	// only bob was deleted long enough ago to be purged
+	if err := db.Delete(&testUser{}, users[2].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour).Unix()
+	if err := db.Unscoped().Model(&testUser{}).Where("name = ?", "bob").Update("deleted_at", old).Error; err != nil {
+		t.Fatal(err)
+	}
+	purged, err := Purge(db, &testUser{}, 24*time.Hour, 1)
+	if err != nil || purged != 1 {
+		t.Fatalf("purged=%d, err=%v", purged, err)
+	}
+	if n := count(db.Unscoped()); n != 2 {
+		t.Fatalf("unscoped count after purge=%d", n)
+	}
+}
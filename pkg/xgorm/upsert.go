@@ -0,0 +1,86 @@
+package xgorm
+
+import (
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InsertIgnore 按业务唯一键幂等插入，返回是否新插入，已存在时 value 被替换为已有的记录(包括已软删除的)
+// keys 必须正好是一个唯一索引的列，如 (chain_id, tx_hash, log_index)，MySQL 对任意唯一索引冲突都会忽略
+func InsertIgnore(tx *gorm.DB, value interface{}, keys ...string) (bool, error) {
+	conds, err := keyConditions(tx, value, keys)
+	if err != nil {
+		return false, err
+	}
+	res := tx.Clauses(clause.OnConflict{Columns: keyColumns(keys), DoNothing: true}).Create(value)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected > 0 {
+		return true, nil
+	}
+	// 从库可能还没有已存在的记录，从主库读
+	q := Primary(tx).Unscoped()
+	for _, cond := range conds {
+		q = q.Where(cond)
+	}
+	if err := q.Take(value).Error; err != nil {
+		return false, fmt.Errorf("find existing row failed, err=%s", err)
+	}
+	return false, nil
+}
+
+// Upsert 按业务唯一键插入，已存在时更新 columns，模型有 updated_at 时同时更新
+func Upsert(tx *gorm.DB, value interface{}, keys []string, columns ...string) error {
+	if _, err := keyConditions(tx, value, keys); err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("xgorm: upsert needs columns to update, use InsertIgnore to only insert")
+	}
+	stmt := &gorm.Statement{DB: tx}
+	_ = stmt.Parse(value)
+	if field, ok := stmt.Schema.FieldsByDBName["updated_at"]; ok && field.AutoUpdateTime > 0 {
+		columns = append(append([]string{}, columns...), "updated_at")
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   keyColumns(keys),
+		DoUpdates: clause.AssignmentColumns(columns),
+	}).Create(value).Error
+}
+
+func keyColumns(keys []string) []clause.Column {
+	cols := make([]clause.Column, 0, len(keys))
+	for _, key := range keys {
+		cols = append(cols, clause.Column{Name: key})
+	}
+	return cols
+}
+
+// keyConditions 检查 keys 是 value 的列，返回按 value 中键值查询的条件
+func keyConditions(tx *gorm.DB, value interface{}, keys []string) ([]clause.Expression, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("xgorm: business keys are required")
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("xgorm: value must be a pointer to a struct")
+	}
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(value); err != nil {
+		return nil, fmt.Errorf("parse model schema failed, err=%s", err)
+	}
+	conds := make([]clause.Expression, 0, len(keys))
+	for _, key := range keys {
+		field, ok := stmt.Schema.FieldsByDBName[key]
+		if !ok {
+			return nil, fmt.Errorf("xgorm: model %s has no column %s", stmt.Schema.Name, key)
+		}
+		v, _ := field.ValueOf(tx.Statement.Context, rv)
+		conds = append(conds, clause.Eq{Column: column(key), Value: v})
+	}
+	return conds, nil
+}
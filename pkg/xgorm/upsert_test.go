@@ -0,0 +1,53 @@
+package xgorm
+
+import (
+	"testing"
+)
+
+type testChainEvent struct {
+	BaseModel
+	ChainID  string `gorm:"column:chain_id;type:varchar(32);not null;uniqueIndex:uk_event,priority:1"`
+	TxHash   string `gorm:"column:tx_hash;type:varchar(66);not null;uniqueIndex:uk_event,priority:2"`
+	LogIndex uint32 `gorm:"column:log_index;not null;uniqueIndex:uk_event,priority:3"`
+	Amount   string `gorm:"column:amount;type:varchar(78);not null"`
+	Status   int    `gorm:"column:status;not null"`
+}
+
+func TestUpsert(t *testing.T) {
+	db, err := NewDB(&GormConf{Dialect: DialectSQLite, DB: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&testChainEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{"chain_id", "tx_hash", "log_index"}
+
+	first := &testChainEvent{ChainID: "1", TxHash: "0xabc", LogIndex: 2, Amount: "100", Status: 1}
+	if inserted, err := InsertIgnore(db, first, keys...); err != nil || !inserted {
+		t.Fatalf("inserted=%v, err=%v", inserted, err)
+	}
+	dup := &testChainEvent{ChainID: "1", TxHash: "0xabc", LogIndex: 2, Amount: "999"}
+	if inserted, err := InsertIgnore(db, dup, keys...); err != nil || inserted || dup.ID != first.ID || dup.Amount != "100" {
+		t.Fatalf("inserted=%v, event=%+v, err=%v", inserted, dup, err)
+	}
+
+	update := &testChainEvent{ChainID: "1", TxHash: "0xabc", LogIndex: 2, Amount: "999", Status: 2}
+	if err := Upsert(db, update, keys, "status"); err != nil {
+		t.Fatal(err)
+	}
+	var got testChainEvent
+	if err := db.Take(&got, first.ID).Error; err != nil || got.Status != 2 || got.Amount != "100" {
+		t.Fatalf("event=%+v, err=%v", got, err)
+	}
+	if err := Upsert(db, &testChainEvent{ChainID: "1", TxHash: "0xabc", LogIndex: 3, Amount: "5"}, keys, "status"); err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	if err := db.Model(&testChainEvent{}).Count(&n).Error; err != nil || n != 2 {
+		t.Fatalf("count=%d, err=%v", n, err)
+	}
+	if _, err := InsertIgnore(db, &testChainEvent{}, "missing"); err == nil {
+		t.Fatal("unknown key accepted")
+	}
+}
@@ -5,10 +5,8 @@ import (
 	"fmt"
 	"github.com/uptrace/opentelemetry-go-extra/otelgorm"
 	"github.com/zeromicro/go-zero/core/logx"
-	"go.opentelemetry.io/otel/attribute"
-	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 	"gorm.io/gorm/schema"
 	"reflect"
@@ -17,11 +15,11 @@ import (
 )
 
 type BaseModel struct {
-	ID        uint64 `json:"id" gorm:"primaryKey"`
-	CreatedAt int64  `json:"created_at" gorm:"column:created_at;autoCreateTime;comment:创建时间"`
-	UpdatedAt int64  `json:"updated_at" gorm:"column:updated_at;autoUpdateTime;comment:更新时间"`
-	DeletedAt int64  `json:"deleted_at" gorm:"column:deleted_at;comment:删除时间"`
-	Remark    string `gorm:"column:remark;type:varchar(255);not null;default:'';" json:"remark"` // 备注
+	ID        uint64    `json:"id" gorm:"primaryKey"`
+	CreatedAt int64     `json:"created_at" gorm:"column:created_at;autoCreateTime;comment:创建时间"`
+	UpdatedAt int64     `json:"updated_at" gorm:"column:updated_at;autoUpdateTime;comment:更新时间"`
+	DeletedAt DeletedAt `json:"deleted_at" gorm:"column:deleted_at;default:0;comment:删除时间"`
+	Remark    string    `gorm:"column:remark;type:varchar(255);not null;default:'';" json:"remark"` // 备注
 }
 
 var (
@@ -68,10 +66,31 @@ func (o *ormLog) Trace(ctx context.Context, begin time.Time, fn func() (sql stri
 
 const MysqlDefaultCharset = "utf8mb4"
 
+// MustNewMySql 创建MySQL连接，失败时panic，其他数据库使用 MustNewDB
 func MustNewMySql(gormConf *GormConf) *gorm.DB {
-	// 判断必填参数
-	if gormConf.DB == "" || gormConf.Addr == "" || gormConf.User == "" || gormConf.Passwd == "" {
-		panic(RequireConfErr)
+	gormConf.Dialect = DialectMySQL
+	return MustNewDB(gormConf)
+}
+
+// MustNewDB 与 NewDB 相同，失败时panic
+func MustNewDB(gormConf *GormConf) *gorm.DB {
+	db, err := NewDB(gormConf)
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+// NewDB 按 gormConf.Dialect 创建连接，默认MySQL，配置了 Replicas 时读写分离
+func NewDB(gormConf *GormConf) (*gorm.DB, error) {
+	db, _, err := NewDBWithReplicas(gormConf)
+	return db, err
+}
+
+func newDB(gormConf *GormConf) (*gorm.DB, error) {
+	dialector, err := Dialector(gormConf)
+	if err != nil {
+		return nil, err
 	}
 	if gormConf.MaxOpenConns == 0 {
 		gormConf.MaxOpenConns = 10
@@ -79,18 +98,11 @@ func MustNewMySql(gormConf *GormConf) *gorm.DB {
 	if gormConf.MaxIdleConns == 0 {
 		gormConf.MaxIdleConns = 10
 	}
-
-	dsn := fmt.Sprintf("%s:%s@"+"tcp(%s)/%s?charset=%s",
-		gormConf.User, gormConf.Passwd, gormConf.Addr, gormConf.DB, MysqlDefaultCharset)
-	if gormConf.TimeoutSec > 0 {
-		// timeout in seconds has "s"
-		dsn += fmt.Sprintf("&timeout=%ds", gormConf.TimeoutSec)
-	}
-	dsn += "&parseTime=true"
-	if gormConf.Options != "" {
-		dsn += "&" + strings.Trim(gormConf.Options, "&")
+	if gormConf.dialect() == DialectSQLite && isSQLiteMemory(gormConf.DB) {
+		// 每个连接是独立的内存数据库
+		gormConf.MaxOpenConns, gormConf.MaxIdleConns = 1, 1
 	}
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
+	db, err := gorm.Open(dialector, &gorm.Config{
 		Logger:      &ormLog{},
 		QueryFields: true,
 		NamingStrategy: schema.NamingStrategy{
@@ -98,32 +110,32 @@ func MustNewMySql(gormConf *GormConf) *gorm.DB {
 		},
 	})
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	sqlDB, err := db.DB()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	sqlDB.SetMaxOpenConns(gormConf.MaxOpenConns)
 	sqlDB.SetMaxIdleConns(gormConf.MaxIdleConns)
 	// plugin
 	if gormConf.Metric {
-		if err = db.Use(&CustomerPlugin{}); err != nil {
-			panic(err)
+		if err = db.Use(&CustomerPlugin{SlowThreshold: time.Duration(gormConf.SlowQueryMs) * time.Millisecond}); err != nil {
+			return nil, err
 		}
 	}
 	if gormConf.Trace {
 		if err = db.Use(otelgorm.NewPlugin(
 			otelgorm.WithDBName(gormConf.DB),
-			otelgorm.WithAttributes(semconv.DBSystemMySQL, attribute.String("db.addr", gormConf.Addr)),
+			otelgorm.WithAttributes(traceAttributes(gormConf)...),
 		)); err != nil {
-			panic(err)
+			return nil, err
 		}
 	}
-	return db
+	return db, nil
 }
 
-// Paginate 分页
+// Paginate 分页，OFFSET 随页码变慢，大表使用 Keyset
 func Paginate(page, pageSize int) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		if page <= 0 {
@@ -141,12 +153,17 @@ func Paginate(page, pageSize int) func(db *gorm.DB) *gorm.DB {
 }
 
 // 列表过滤筛选
+//
+// Deprecated: Filters 按key的名字猜测SQL语义，使用 Query 和 Filterable
 type Page struct {
 	Page    int `json:"page"`
 	Limit   int `json:"limit"`
 	Filters map[string]interface{}
 }
 
+// FindPage key 只作为列名引用，不会拼接进SQL
+//
+// Deprecated: 使用 Filterable.Find
 func (p *Page) FindPage(tx *gorm.DB) (*gorm.DB, int64) {
 	i := int64(0)
 	if p != nil {
@@ -159,23 +176,23 @@ func (p *Page) FindPage(tx *gorm.DB) (*gorm.DB, int64) {
 				if strings.Contains(key, "_time") || strings.Contains(key, "_at") {
 					t := strings.Split(fieldValue.String(), ",")
 					if len(t) == 2 {
-						tx = tx.Where(fmt.Sprintf("`%s` between ? and ?", key), t[0], t[1])
+						tx = tx.Where(clause.Expr{SQL: "? between ? and ?", Vars: []interface{}{clause.Column{Name: key}, t[0], t[1]}})
 					}
 				} else if strings.Contains(key, "status") || strings.Contains(key, "state") {
 					t := strings.Split(fmt.Sprintf("%v", value), ",")
 					if len(t) > 1 {
-						tx = tx.Where(fmt.Sprintf("`%s` in (?)", key), t)
+						tx = tx.Where(clause.IN{Column: clause.Column{Name: key}, Values: stringValues(t)})
 					} else {
-						tx = tx.Where(fmt.Sprintf("`%s` = ?", key), fieldValue.Interface())
+						tx = tx.Where(clause.Eq{Column: clause.Column{Name: key}, Value: fieldValue.Interface()})
 					}
 				} else {
 					if fieldValue.Kind() == reflect.String {
 						fv := fieldValue.String()
 						if fv != "" {
-							tx = tx.Where(fmt.Sprintf("`%s` like ?", key), "%"+fv+"%")
+							tx = tx.Where(clause.Like{Column: clause.Column{Name: key}, Value: "%" + fv + "%"})
 						}
 					} else {
-						tx = tx.Where(key, fieldValue.Interface())
+						tx = tx.Where(clause.Eq{Column: clause.Column{Name: key}, Value: fieldValue.Interface()})
 					}
 
 				}
@@ -191,3 +208,11 @@ func (p *Page) FindPage(tx *gorm.DB) (*gorm.DB, int64) {
 	}
 	return tx, i
 }
+
+func stringValues(list []string) []interface{} {
+	values := make([]interface{}, 0, len(list))
+	for _, v := range list {
+		values = append(values, v)
+	}
+	return values
+}
@@ -1,276 +1,132 @@
 package xgorm
 
 import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/logx"
 	"github.com/zeromicro/go-zero/core/trace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	oteltrace "go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
-	"strconv"
-	"time"
 )
 
 const (
 	customerPluginName = "CustomerPlugin"
+	// customerPluginKey 是每条语句的计时和span在 InstanceSet 中的key
+	customerPluginKey = "xgorm:customer_plugin"
+	// DefaultSlowThreshold 慢查询阈值
+	DefaultSlowThreshold = 500 * time.Millisecond
 )
 
-type CustomerPlugin struct{}
+// CustomerPlugin 记录每个操作的耗时、结果和影响行数指标，创建span，并打印慢查询日志
+// SlowThreshold 为0时使用 DefaultSlowThreshold，小于0时不打印慢查询
+type CustomerPlugin struct {
+	SlowThreshold time.Duration
+}
 
 func NewCustomerPlugin() *CustomerPlugin {
 	return &CustomerPlugin{}
 }
 
+type pluginState struct {
+	start time.Time
+	span  oteltrace.Span
+	// ctx 为语句原来的context，结束时恢复
+	ctx context.Context
+}
+
 // ===========implement gorm Plugin interface============
 func (c *CustomerPlugin) Name() string {
 	return customerPluginName
 }
 
+// Initialize 在真正执行SQL的 gorm:create 等回调前后计时，不包含关联和钩子
 func (c *CustomerPlugin) Initialize(db *gorm.DB) error {
-	// before create
-	if err := db.Callback().Create().Before("gorm:create").Register("gorm:createBefore:metric:trace", func(db *gorm.DB) {
-		startTime := time.Now().Unix()
-		db.InstanceSet("gorm:created_start_time", startTime)
-		ctx := db.Statement.Context
-		tracer := trace.TracerFromContext(ctx)
-		_, span := tracer.Start(ctx, "gorm:create", oteltrace.WithSpanKind(oteltrace.SpanKindClient))
-		db.InstanceSet("gorm:trace:span", span)
-	}); err != nil {
-		return err
-	}
-
-	// before query
-	if err := db.Callback().Query().Before("gorm:queryBefore").Register("gorm:queryBefore:metric:trace", func(db *gorm.DB) {
-		startTime := time.Now().Unix()
-		db.InstanceSet("gorm:query_start_time", startTime)
-		ctx := db.Statement.Context
-		tracer := trace.TracerFromContext(ctx)
-		_, span := tracer.Start(ctx, "gorm:query", oteltrace.WithSpanKind(oteltrace.SpanKindClient))
-		db.InstanceSet("gorm:trace:span", span)
-	}); err != nil {
-		return err
-	}
-
-	// before update
-	if err := db.Callback().Update().Before("gorm:updateBefore").Register("gorm:updateBefore:metric:trace", func(db *gorm.DB) {
-		startTime := time.Now().Unix()
-		db.InstanceSet("gorm:update_start_time", startTime)
-		ctx := db.Statement.Context
-		tracer := trace.TracerFromContext(ctx)
-		_, span := tracer.Start(ctx,
-			"gorm:update",
-			oteltrace.WithSpanKind(oteltrace.SpanKindClient),
-		)
-		db.InstanceSet("gorm:update_span", span)
-	}); err != nil {
-		return err
-	}
-
-	// before delete
-	if err := db.Callback().Delete().Before("gorm:deleteBefore").Register("gorm:deleteBefore:metric:trace", func(db *gorm.DB) {
-		startTime := time.Now().Unix()
-		db.InstanceSet("gorm:delete_start_time", startTime)
-
-		ctx := db.Statement.Context
-		tracer := trace.TracerFromContext(ctx)
-		_, span := tracer.Start(ctx,
-			"gorm:delete",
-			oteltrace.WithSpanKind(oteltrace.SpanKindClient),
-		)
-		db.InstanceSet("gorm:delete_span", span)
-	}); err != nil {
-		return err
+	cb := db.Callback()
+	errs := []error{
+		cb.Create().Before("gorm:create").Register("xgorm:before_create", c.before("create")),
+		cb.Create().After("gorm:create").Register("xgorm:after_create", c.after("create")),
+		cb.Query().Before("gorm:query").Register("xgorm:before_query", c.before("query")),
+		cb.Query().After("gorm:query").Register("xgorm:after_query", c.after("query")),
+		cb.Update().Before("gorm:update").Register("xgorm:before_update", c.before("update")),
+		cb.Update().After("gorm:update").Register("xgorm:after_update", c.after("update")),
+		cb.Delete().Before("gorm:delete").Register("xgorm:before_delete", c.before("delete")),
+		cb.Delete().After("gorm:delete").Register("xgorm:after_delete", c.after("delete")),
+		cb.Row().Before("gorm:row").Register("xgorm:before_row", c.before("row")),
+		cb.Row().After("gorm:row").Register("xgorm:after_row", c.after("row")),
+		cb.Raw().Before("gorm:raw").Register("xgorm:before_raw", c.before("raw")),
+		cb.Raw().After("gorm:raw").Register("xgorm:after_raw", c.after("raw")),
 	}
+	return errors.Join(errs...)
+}
 
-	// row before
-	if err := db.Callback().Row().Before("gorm:rowBefore").Register("gorm:rowBefore:metric:trace", func(db *gorm.DB) {
-		startTime := time.Now().Unix()
-		db.InstanceSet("gorm:row_start_time", startTime)
-
-		ctx := db.Statement.Context
-		tracer := trace.TracerFromContext(ctx)
-		_, span := tracer.Start(ctx,
-			"gorm:row",
-			oteltrace.WithSpanKind(oteltrace.SpanKindClient),
-		)
-		db.InstanceSet("gorm:row_span", span)
-	}); err != nil {
-		return err
-	}
-
-	// raw before
-	if err := db.Callback().Raw().Before("gorm:rawBefore").Register("gorm:rawBefore:metric:trace", func(db *gorm.DB) {
-		startTime := time.Now().Unix()
-		db.InstanceSet("gorm:raw_start_time", startTime)
-
+func (c *CustomerPlugin) before(op string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
 		ctx := db.Statement.Context
-		tracer := trace.TracerFromContext(ctx)
-		_, span := tracer.Start(ctx,
-			"gorm:raw",
-			oteltrace.WithSpanKind(oteltrace.SpanKindClient),
-		)
-		db.InstanceSet("gorm:raw_span", span)
-	}); err != nil {
-		return err
-	}
-	// After callbacks
-	if err := db.Callback().Create().After("gorm:createAfter").Register("gorm:createAfter:metric:trace", func(db *gorm.DB) {
-		startTime, ok := db.InstanceGet("gorm:create_start_time")
-		if !ok {
-			return
-		}
-		stSecond := startTime.(int64)
-		st := time.Unix(stSecond, 0)
-		metricClientReqDur.Observe(time.Since(st).Milliseconds(), db.Statement.Table, "create")
-		metricClientReqErrTotal.Inc(db.Statement.Table, "create", strconv.FormatBool(db.Statement.Error != nil))
-		v, ok := db.InstanceGet("gorm:create_span")
-		if !ok {
-			return
-		}
-		span := v.(oteltrace.Span)
-		if db.Statement.Error != nil {
-			span.RecordError(db.Statement.Error)
-		}
-		span.SetAttributes(
-			semconv.DBSQLTableKey.String(db.Statement.Table),
-			semconv.DBStatementKey.String(db.Statement.SQL.String()),
-		)
-		span.End()
-	}); err != nil {
-		return err
+		spanCtx, span := trace.TracerFromContext(ctx).Start(ctx, "gorm:"+op, oteltrace.WithSpanKind(oteltrace.SpanKindClient))
+		db.InstanceSet(customerPluginKey, &pluginState{start: time.Now(), span: span, ctx: ctx})
+		// 驱动和其他插件的span是这个span的子span
+		db.Statement.Context = spanCtx
 	}
+}
 
-	if err := db.Callback().Query().After("gorm:queryAfter").Register("gorm:queryAfter:metric:trace", func(db *gorm.DB) {
-		startTime, ok := db.InstanceGet("gorm:query_start_time")
+func (c *CustomerPlugin) after(op string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		v, ok := db.InstanceGet(customerPluginKey)
 		if !ok {
 			return
 		}
-		stSecond := startTime.(int64)
-		st := time.Unix(stSecond, 0)
-		metricClientReqDur.Observe(time.Since(st).Milliseconds(), db.Statement.Table, "query")
-		metricClientReqErrTotal.Inc(db.Statement.Table, "query", strconv.FormatBool(db.Statement.Error != nil))
+		state := v.(*pluginState)
+		elapsed := time.Since(state.start)
+		table := db.Statement.Table
+		result := resultLabel(db.Statement.Error)
 
-		v, ok := db.InstanceGet("gorm:query_span")
-		if !ok {
-			return
-		}
-		span := v.(oteltrace.Span)
-		if db.Statement.Error != nil {
-			span.RecordError(db.Statement.Error)
+		metricClientReqDur.ObserveFloat(float64(elapsed)/float64(time.Millisecond), table, op)
+		if result != "false" {
+			metricClientReqErrTotal.Inc(table, op, result)
 		}
-		span.SetAttributes(
-			semconv.DBSQLTableKey.String(db.Statement.Table),
-			semconv.DBStatementKey.String(db.Statement.SQL.String()),
-		)
-		span.End()
-	}); err != nil {
-		return err
-	}
-
-	if err := db.Callback().Update().After("gorm:updateAfter").Register("gorm:updateAfter:metric:trace", func(db *gorm.DB) {
-		startTime, ok := db.InstanceGet("gorm:update_start_time")
-		if !ok {
-			return
+		if db.Statement.Error == nil {
+			metricClientRowsAffected.Observe(db.Statement.RowsAffected, table, op)
 		}
-		stSecond := startTime.(int64)
-		st := time.Unix(stSecond, 0)
-		metricClientReqDur.Observe(time.Since(st).Milliseconds(), db.Statement.Table, "update")
-		metricClientReqErrTotal.Inc(db.Statement.Table, "update", strconv.FormatBool(db.Statement.Error != nil))
 
-		v, ok := db.InstanceGet("gorm:update_span")
-		if !ok {
-			return
-		}
-		span := v.(oteltrace.Span)
-		if db.Statement.Error != nil {
-			span.RecordError(db.Statement.Error)
-		}
-		span.SetAttributes(
-			semconv.DBSQLTableKey.String(db.Statement.Table),
-			semconv.DBStatementKey.String(db.Statement.SQL.String()),
+		sql := db.Statement.SQL.String()
+		state.span.SetAttributes(
+			semconv.DBSQLTableKey.String(table),
+			semconv.DBStatementKey.String(sql),
+			attribute.Int64("db.rows_affected", db.Statement.RowsAffected),
 		)
-		span.End()
-	}); err != nil {
-		return err
-	}
-
-	if err := db.Callback().Delete().After("gorm:deleteAfter").Register("gorm:deleteAfter:metric:trace", func(db *gorm.DB) {
-		startTime, ok := db.InstanceGet("gorm:delete_start_time")
-		if !ok {
-			return
-		}
-		stSecond := startTime.(int64)
-		st := time.Unix(stSecond, 0)
-		metricClientReqDur.Observe(time.Since(st).Milliseconds(), db.Statement.Table, "delete")
-		metricClientReqErrTotal.Inc(db.Statement.Table, "delete", strconv.FormatBool(db.Statement.Error != nil))
-
-		v, ok := db.InstanceGet("gorm:delete_span")
-		if !ok {
-			return
+		if result == "true" {
+			state.span.RecordError(db.Statement.Error)
+			state.span.SetStatus(codes.Error, db.Statement.Error.Error())
 		}
-		span := v.(oteltrace.Span)
-		if db.Statement.Error != nil {
-			span.RecordError(db.Statement.Error)
+		state.span.End()
+		// 其他插件(如otelgorm)的span在这个span内部开始时，由它们自己结束，不能替换掉它们的context
+		if oteltrace.SpanContextFromContext(db.Statement.Context).Equal(state.span.SpanContext()) {
+			db.Statement.Context = state.ctx
 		}
-		span.SetAttributes(
-			semconv.DBSQLTableKey.String(db.Statement.Table),
-			semconv.DBStatementKey.String(db.Statement.SQL.String()),
-		)
-		span.End()
-	}); err != nil {
-		return err
-	}
-
-	if err := db.Callback().Row().After("gorm:rowAfter").Register("gorm:rowAfter:metric:trace", func(db *gorm.DB) {
-		startTime, ok := db.InstanceGet("gorm:row_start_time")
-		if !ok {
-			return
-		}
-		stSecond := startTime.(int64)
-		st := time.Unix(stSecond, 0)
-		metricClientReqDur.Observe(time.Since(st).Milliseconds(), db.Statement.Table, "row")
-		metricClientReqErrTotal.Inc(db.Statement.Table, "row", strconv.FormatBool(db.Statement.Error != nil))
 
-		v, ok := db.InstanceGet("gorm:row_span")
-		if !ok {
-			return
+		threshold := c.SlowThreshold
+		if threshold == 0 {
+			threshold = DefaultSlowThreshold
 		}
-		span := v.(oteltrace.Span)
-		if db.Statement.Error != nil {
-			span.RecordError(db.Statement.Error)
+		if threshold > 0 && elapsed > threshold {
+			logx.WithContext(db.Statement.Context).WithDuration(elapsed).Slowf("[SLOW SQL] [%s] [%.3fms] [rows:%d] %s",
+				op, float64(elapsed.Nanoseconds())/1e6, db.Statement.RowsAffected, sql)
 		}
-		span.SetAttributes(
-			semconv.DBSQLTableKey.String(db.Statement.Table),
-			semconv.DBStatementKey.String(db.Statement.SQL.String()),
-		)
-		span.End()
-	}); err != nil {
-		return err
 	}
+}
 
-	if err := db.Callback().Raw().After("gorm:rawAfter").Register("gorm:rawAfter:metric:trace", func(db *gorm.DB) {
-		startTime, ok := db.InstanceGet("gorm:raw_start_time")
-		if !ok {
-			return
-		}
-		stSecond := startTime.(int64)
-		st := time.Unix(stSecond, 0)
-		metricClientReqDur.Observe(time.Since(st).Milliseconds(), db.Statement.Table, "raw")
-		metricClientReqErrTotal.Inc(db.Statement.Table, "raw", strconv.FormatBool(db.Statement.Error != nil))
-
-		v, ok := db.InstanceGet("gorm:raw_span")
-		if !ok {
-			return
-		}
-		span := v.(oteltrace.Span)
-		if db.Statement.Error != nil {
-			span.RecordError(db.Statement.Error)
-		}
-		span.SetAttributes(
-			semconv.DBSQLTableKey.String(db.Statement.Table),
-			semconv.DBStatementKey.String(db.Statement.SQL.String()),
-		)
-		span.End()
-	}); err != nil {
-		return err
+// resultLabel 是 is_error 标签的值，记录不存在不算错误，单独标记为 not_found
+func resultLabel(err error) string {
+	switch {
+	case err == nil:
+		return "false"
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return "not_found"
 	}
-	return nil
+	return "true"
 }
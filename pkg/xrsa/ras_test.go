@@ -1,6 +1,7 @@
 package xrsa
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 )
@@ -95,3 +96,56 @@ AXTJf0KexlrRZygeGQg9UXBw4iTE+A8qlsnang7Ee2UWF0rjMfyYtSWqb65dbUaJ
 x5/RnCvg4qEODVvIsp2C5e/dueSGnh4jNpr2n8psytTHkkWVChPULqTRrmD77x+c
 QnIED4PVtPDHtVx/CMp7PUp0tUJkjxroel6z0dmtDeFLk8wIidKGdRdgpg==
 -----END rsa private key-----`
+
+func TestOAEPAndSignature(t *testing.T) {
+	privPEM, pubPEM, err := GenerateKeyPEM(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := make([]byte, 1000)
+	for i := range long {
+		long[i] = byte(i)
+	}
+	cipherText, err := OAEPEncrypt(long, pubPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainText, err := OAEPDecrypt(cipherText, privPEM)
+	if err != nil || string(plainText) != string(long) {
+		t.Fatalf("oaep round trip failed, err=%v", err)
+	}
+
+	priv, _ := ParseRSAPrivateKeyFromPEM(privPEM)
+	pub, _ := ParseRSAPublicKeyFromPEM(pubPEM)
+	sig, _ := SignPSS([]byte("payload"), priv)
+	if err := VerifyPSS([]byte("payload"), sig, pub); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyPSS([]byte("payload2"), sig, pub); err == nil {
+		t.Fatal("pss verified another payload")
+	}
+	sig, _ = SignPKCS1v15([]byte("payload"), priv)
+	if err := VerifyPKCS1v15([]byte("payload"), sig, pub); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := json.Marshal(PublicKeyToJWK(pub, "PS256"))
+	parsed, err := ParseJWK(data)
+	if err != nil || !parsed.Equal(pub) {
+		t.Fatalf("jwk round trip failed, err=%v", err)
+	}
+}
+
+func TestJWKThumbprint(t *testing.T) {
+	// RFC 7638 section 3.1
+	jwk := &JWK{
+		Kty: "RSA",
+		E:   "AQAB",
+		N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMs" +
+			"tn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91C" +
+			"bOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+	}
+	if got := jwk.Thumbprint(); got != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Fatalf("thumbprint=%s", got)
+	}
+}
@@ -21,11 +21,11 @@ func GenerateRsaKey(keySize int, pathPrefix string) error {
 	derText := x509.MarshalPKCS1PrivateKey(privateKey)
 	// 3.pem.Block
 	block := pem.Block{
-		Type:  "rsa private key", // string
+		Type:  "RSA PRIVATE KEY", // PKCS#1
 		Bytes: derText,
 	}
 	// 4. pem encode
-	file, err := os.Create(pathPrefix + "_private.pem")
+	file, err := os.OpenFile(pathPrefix+"_private.pem", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
 	}
@@ -42,7 +42,7 @@ func GenerateRsaKey(keySize int, pathPrefix string) error {
 	}
 	// 3. input pem.Block
 	block = pem.Block{
-		Type:  "rsa public key",
+		Type:  "PUBLIC KEY", // PKIX
 		Bytes: derStream,
 	}
 	// 4. pem encode
@@ -55,12 +55,12 @@ func GenerateRsaKey(keySize int, pathPrefix string) error {
 	return nil
 }
 
-// RSAEncrypt RSA use rsa public key encode
+// RSAEncrypt RSA use rsa public key encode, PKCS#1 v1.5, new code uses OAEPEncrypt
 func RSAEncrypt(plainText []byte, pk []byte) (encodeRes []byte, err error) {
-	block, _ := pem.Decode(pk)
-	pubInterface, err := x509.ParsePKIXPublicKey(block.Bytes)
-	//public key
-	pubKey := pubInterface.(*rsa.PublicKey)
+	pubKey, err := ParseRSAPublicKeyFromPEM(pk)
+	if err != nil {
+		return nil, err
+	}
 	// encode
 	cipherText, err := rsa.EncryptPKCS1v15(rand.Reader, pubKey, plainText)
 	if err != nil {
@@ -69,11 +69,10 @@ func RSAEncrypt(plainText []byte, pk []byte) (encodeRes []byte, err error) {
 	return cipherText, nil
 }
 
-// RSADecrypt RSA decode
+// RSADecrypt RSA decode, PKCS#1 v1.5
 func RSADecrypt(cipherText []byte, pk []byte) (decodeRes []byte, err error) {
 	//private key
-	block, _ := pem.Decode(pk)
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	privateKey, err := ParseRSAPrivateKeyFromPEM(pk)
 	if err != nil {
 		return nil, err
 	}
@@ -211,7 +210,7 @@ func ParseRSAPrivateKeyFromPEMWithPassword(key []byte, password string) (*rsa.Pr
 	return pkey, nil
 }
 
-// ParseRSAPublicKeyFromPEM parses a PEM encoded PKCS1 or PKCS8 public key
+// ParseRSAPublicKeyFromPEM parses a PEM encoded PKIX or PKCS1 public key or a certificate
 func ParseRSAPublicKeyFromPEM(key []byte) (*rsa.PublicKey, error) {
 	var err error
 
@@ -226,6 +225,8 @@ func ParseRSAPublicKeyFromPEM(key []byte) (*rsa.PublicKey, error) {
 	if parsedKey, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
 		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
 			parsedKey = cert.PublicKey
+		} else if pkcs1, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+			parsedKey = pkcs1
 		} else {
 			return nil, err
 		}
@@ -0,0 +1,76 @@
+package xrsa
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+)
+
+// JWK is an RSA public key in the JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWKSet is a JSON Web Key Set, as served on a jwks endpoint
+type JWKSet struct {
+	Keys []*JWK `json:"keys"`
+}
+
+// PublicKeyToJWK exports pub for signature verification with alg such as PS256 or RS256,
+// the kid is the RFC 7638 thumbprint of the key
+func PublicKeyToJWK(pub *rsa.PublicKey, alg string) *JWK {
+	jwk := &JWK{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: alg,
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+	jwk.Kid = jwk.Thumbprint()
+	return jwk
+}
+
+// Thumbprint returns the base64url SHA-256 thumbprint of RFC 7638
+func (j *JWK) Thumbprint() string {
+	// the members are required in lexicographic order without whitespace
+	data := []byte(`{"e":"` + j.E + `","kty":"RSA","n":"` + j.N + `"}`)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// PublicKey returns the RSA public key of the JWK
+func (j *JWK) PublicKey() (*rsa.PublicKey, error) {
+	if j.Kty != "RSA" {
+		return nil, ErrNotRSAPublicKey
+	}
+	n, err := base64.RawURLEncoding.DecodeString(j.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(j.E)
+	if err != nil {
+		return nil, err
+	}
+	exp := new(big.Int).SetBytes(e)
+	if len(n) == 0 || !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid rsa jwk")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+}
+
+// ParseJWK parses a JSON encoded RSA JWK
+func ParseJWK(data []byte) (*rsa.PublicKey, error) {
+	var jwk JWK
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return nil, err
+	}
+	return jwk.PublicKey()
+}
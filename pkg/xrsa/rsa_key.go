@@ -0,0 +1,41 @@
+package xrsa
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+)
+
+// GenerateKeyPEM generates a key pair and returns the PKCS#8 private key and PKIX public key PEM
+func GenerateKeyPEM(keySize int) (privPEM []byte, pubPEM []byte, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, keySize)
+	if err != nil {
+		return nil, nil, err
+	}
+	if privPEM, err = MarshalPKCS8PrivateKeyPEM(key); err != nil {
+		return nil, nil, err
+	}
+	if pubPEM, err = MarshalPKIXPublicKeyPEM(&key.PublicKey); err != nil {
+		return nil, nil, err
+	}
+	return privPEM, pubPEM, nil
+}
+
+// MarshalPKCS8PrivateKeyPEM encodes key as a "PRIVATE KEY" PEM block
+func MarshalPKCS8PrivateKeyPEM(key *rsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// MarshalPKIXPublicKeyPEM encodes key as a "PUBLIC KEY" PEM block
+func MarshalPKIXPublicKeyPEM(key *rsa.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
@@ -0,0 +1,64 @@
+package xrsa
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+)
+
+// OAEPEncryptWithKey encrypts with RSA-OAEP-SHA256, inputs longer than one block are split into
+// chunks of size-66 bytes and the result is the concatenation of the size byte blocks
+func OAEPEncryptWithKey(plainText []byte, pub *rsa.PublicKey) ([]byte, error) {
+	hash := sha256.New()
+	chunk := pub.Size() - 2*hash.Size() - 2
+	out := make([]byte, 0, (len(plainText)/chunk+1)*pub.Size())
+	for start := 0; start == 0 || start < len(plainText); start += chunk {
+		end := start + chunk
+		if end > len(plainText) {
+			end = len(plainText)
+		}
+		block, err := rsa.EncryptOAEP(hash, rand.Reader, pub, plainText[start:end], nil)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, block...)
+	}
+	return out, nil
+}
+
+// OAEPDecryptWithKey decrypts a payload of OAEPEncryptWithKey
+func OAEPDecryptWithKey(cipherText []byte, priv *rsa.PrivateKey) ([]byte, error) {
+	size := priv.Size()
+	if len(cipherText) == 0 || len(cipherText)%size != 0 {
+		return nil, errors.New("invalid oaep cipher text length")
+	}
+	hash := sha256.New()
+	out := make([]byte, 0, len(cipherText))
+	for start := 0; start < len(cipherText); start += size {
+		block, err := rsa.DecryptOAEP(hash, rand.Reader, priv, cipherText[start:start+size], nil)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, block...)
+	}
+	return out, nil
+}
+
+// OAEPEncrypt is OAEPEncryptWithKey with a PEM public key
+func OAEPEncrypt(plainText []byte, pk []byte) ([]byte, error) {
+	pub, err := ParseRSAPublicKeyFromPEM(pk)
+	if err != nil {
+		return nil, err
+	}
+	return OAEPEncryptWithKey(plainText, pub)
+}
+
+// OAEPDecrypt is OAEPDecryptWithKey with a PEM private key
+func OAEPDecrypt(cipherText []byte, pk []byte) ([]byte, error) {
+	priv, err := ParseRSAPrivateKeyFromPEM(pk)
+	if err != nil {
+		return nil, err
+	}
+	return OAEPDecryptWithKey(cipherText, priv)
+}
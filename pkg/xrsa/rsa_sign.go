@@ -0,0 +1,32 @@
+package xrsa
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+)
+
+// SignPSS signs the SHA-256 digest of data with RSA-PSS, the salt length equals the hash length
+func SignPSS(data []byte, priv *rsa.PrivateKey) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	return rsa.SignPSS(rand.Reader, priv, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+}
+
+// VerifyPSS verifies a signature of SignPSS, signatures with any salt length are accepted
+func VerifyPSS(data, sig []byte, pub *rsa.PublicKey) error {
+	digest := sha256.Sum256(data)
+	return rsa.VerifyPSS(pub, crypto.SHA256, digest[:], sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+}
+
+// SignPKCS1v15 signs the SHA-256 digest of data with RSASSA-PKCS1-v1_5 (RS256), for partners without PSS
+func SignPKCS1v15(data []byte, priv *rsa.PrivateKey) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	return rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest[:])
+}
+
+// VerifyPKCS1v15 verifies a signature of SignPKCS1v15
+func VerifyPKCS1v15(data, sig []byte, pub *rsa.PublicKey) error {
+	digest := sha256.Sum256(data)
+	return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig)
+}
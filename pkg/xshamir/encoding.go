@@ -0,0 +1,95 @@
+package xshamir
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/mr-tron/base58"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// Encoding is a text encoding of a share
+type Encoding string
+
+const (
+	EncodingHex    Encoding = "hex"
+	EncodingBase58 Encoding = "base58"
+	// EncodingWords writes 11 bits per word of the BIP-39 english word list, like SLIP-39 mnemonics
+	EncodingWords Encoding = "words"
+)
+
+// Encode returns the share as text
+func (s *Share) Encode(enc Encoding) (string, error) {
+	data := s.Bytes()
+	switch enc {
+	case EncodingHex:
+		return hex.EncodeToString(data), nil
+	case EncodingBase58:
+		return base58.Encode(data), nil
+	case EncodingWords:
+		return bytesToWords(data), nil
+	}
+	return "", fmt.Errorf("unsupported share encoding=%s", enc)
+}
+
+// Decode parses a share encoded by Encode
+func Decode(text string, enc Encoding) (*Share, error) {
+	text = strings.TrimSpace(text)
+	var data []byte
+	var err error
+	switch enc {
+	case EncodingHex:
+		data, err = hex.DecodeString(text)
+	case EncodingBase58:
+		data, err = base58.Decode(text)
+	case EncodingWords:
+		data, err = wordsToBytes(text)
+	default:
+		return nil, fmt.Errorf("unsupported share encoding=%s", enc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decode %s share failed, err=%s", enc, err)
+	}
+	return Parse(data)
+}
+
+func bytesToWords(data []byte) string {
+	list := bip39.GetWordList()
+	words := make([]string, 0, (len(data)*8+10)/11)
+	var acc uint32
+	var bits uint
+	for _, b := range data {
+		acc = acc<<8 | uint32(b)
+		bits += 8
+		for bits >= 11 {
+			bits -= 11
+			words = append(words, list[(acc>>bits)&0x7ff])
+		}
+	}
+	if bits > 0 {
+		words = append(words, list[(acc<<(11-bits))&0x7ff])
+	}
+	return strings.Join(words, " ")
+}
+
+// wordsToBytes reverses bytesToWords, the zero padding may add one trailing zero byte that Parse ignores
+func wordsToBytes(text string) ([]byte, error) {
+	fields := strings.Fields(strings.ToLower(text))
+	data := make([]byte, 0, len(fields)*11/8)
+	var acc uint32
+	var bits uint
+	for _, w := range fields {
+		index, ok := bip39.GetWordIndex(w)
+		if !ok {
+			return nil, fmt.Errorf("unknown word=%s", w)
+		}
+		acc = acc<<11 | uint32(index)
+		bits += 11
+		for bits >= 8 {
+			bits -= 8
+			data = append(data, byte(acc>>bits))
+		}
+	}
+	return data, nil
+}
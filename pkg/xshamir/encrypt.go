@@ -0,0 +1,195 @@
+package xshamir
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Recipient encrypts a share payload, the share header is authenticated as additional data
+type Recipient interface {
+	Encrypt(plain, aad []byte) ([]byte, error)
+}
+
+// Identity decrypts payloads encrypted to its Recipient
+type Identity interface {
+	Decrypt(cipherText, aad []byte) ([]byte, error)
+}
+
+// Encrypt returns a copy of the share with the payload encrypted to r
+// the metadata stays readable so encrypted shares can be sorted and validated before decryption
+func (s *Share) Encrypt(r Recipient) (*Share, error) {
+	if s.Encrypted {
+		return nil, fmt.Errorf("share %d is already encrypted", s.Index)
+	}
+	out := *s
+	out.Encrypted = true
+	payload, err := r.Encrypt(s.Payload, aadOf(&out))
+	if err != nil {
+		return nil, fmt.Errorf("encrypt share %d failed, err=%s", s.Index, err)
+	}
+	out.Payload = payload
+	return &out, nil
+}
+
+// Decrypt returns a copy of the share with the payload decrypted by id
+func (s *Share) Decrypt(id Identity) (*Share, error) {
+	if !s.Encrypted {
+		return nil, fmt.Errorf("share %d is not encrypted", s.Index)
+	}
+	payload, err := id.Decrypt(s.Payload, aadOf(s))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt share %d failed, err=%s", s.Index, err)
+	}
+	out := *s
+	out.Encrypted = false
+	out.Payload = payload
+	return &out, nil
+}
+
+// aadOf is the header without the payload length, which differs after encryption
+func aadOf(s *Share) []byte {
+	h := s.header()
+	return h[:len(h)-2]
+}
+
+// RSARecipient wraps a random AES-256-GCM key with RSA-OAEP-SHA256
+type RSARecipient struct {
+	Key *rsa.PublicKey
+}
+
+func (r *RSARecipient) Encrypt(plain, aad []byte) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, r.Key, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := seal(key, plain, aad)
+	if err != nil {
+		return nil, err
+	}
+	return append(wrapped, sealed...), nil
+}
+
+// RSAIdentity is the private key of an RSARecipient
+type RSAIdentity struct {
+	Key *rsa.PrivateKey
+}
+
+func (i *RSAIdentity) Decrypt(cipherText, aad []byte) ([]byte, error) {
+	size := i.Key.Size()
+	if len(cipherText) < size {
+		return nil, fmt.Errorf("cipher text is too short")
+	}
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, i.Key, cipherText[:size], nil)
+	if err != nil {
+		return nil, err
+	}
+	return open(key, cipherText[size:], aad)
+}
+
+// X25519Recipient encrypts like age: an ephemeral X25519 key agreement derives the AES-256-GCM key
+type X25519Recipient struct {
+	Key *ecdh.PublicKey
+}
+
+func (r *X25519Recipient) Encrypt(plain, aad []byte) ([]byte, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(r.Key)
+	if err != nil {
+		return nil, err
+	}
+	epk := ephemeral.PublicKey().Bytes()
+	key, err := x25519Key(shared, epk, r.Key.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := seal(key, plain, aad)
+	if err != nil {
+		return nil, err
+	}
+	return append(epk, sealed...), nil
+}
+
+// X25519Identity is the private key of an X25519Recipient
+type X25519Identity struct {
+	Key *ecdh.PrivateKey
+}
+
+// Recipient returns the recipient of the identity
+func (i *X25519Identity) Recipient() *X25519Recipient {
+	return &X25519Recipient{Key: i.Key.PublicKey()}
+}
+
+func (i *X25519Identity) Decrypt(cipherText, aad []byte) ([]byte, error) {
+	if len(cipherText) < 32 {
+		return nil, fmt.Errorf("cipher text is too short")
+	}
+	epk, err := ecdh.X25519().NewPublicKey(cipherText[:32])
+	if err != nil {
+		return nil, err
+	}
+	shared, err := i.Key.ECDH(epk)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x25519Key(shared, cipherText[:32], i.Key.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return open(key, cipherText[32:], aad)
+}
+
+func x25519Key(shared, epk, recipient []byte) ([]byte, error) {
+	salt := append(append([]byte{}, epk...), recipient...)
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte("xshamir/x25519")), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// seal returns nonce || AES-GCM(plain)
+func seal(key, plain, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, aad), nil
+}
+
+func open(key, sealed, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("cipher text is too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], aad)
+}
@@ -0,0 +1,216 @@
+package xshamir
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/hashicorp/vault/shamir"
+)
+
+// Version is the current share format version
+const Version = 1
+
+const (
+	idSize       = 8
+	digestSize   = 4
+	checksumSize = 4
+	// version, id, threshold, total, index, flags, payload length
+	headerSize = 1 + idSize + 1 + 1 + 1 + 1 + 2
+)
+
+const flagEncrypted = 1
+
+// Share is one share of a secret with the metadata needed to validate it before combining
+// the value that is split is digest || secret, the digest is a keyed digest of the secret which
+// detects a wrong combination after combining, like the secret it is not revealed by fewer than threshold shares
+type Share struct {
+	Version   uint8
+	SecretID  [idSize]byte
+	Threshold uint8
+	Total     uint8
+	Index     uint8
+	Encrypted bool
+	Payload   []byte
+}
+
+// Split splits secret into total shares, any threshold of them recover it
+func Split(secret []byte, threshold, total int) ([]*Share, error) {
+	var id [idSize]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	return SplitWithID(secret, id, threshold, total)
+}
+
+// SplitWithID is Split with a caller chosen secret id
+func SplitWithID(secret []byte, id [idSize]byte, threshold, total int) ([]*Share, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("secret cannot be empty")
+	}
+	if threshold < 1 || threshold > total || total > 255 {
+		return nil, fmt.Errorf("invalid share count: threshold %d, total %d", threshold, total)
+	}
+	digest := secretDigest(id, secret)
+	value := append(digest[:], secret...)
+	var parts [][]byte
+	if threshold == 1 {
+		// vault shamir needs a threshold of at least 2, a 1 of n share is the value itself
+		for i := 0; i < total; i++ {
+			parts = append(parts, append([]byte{}, value...))
+		}
+	} else {
+		var err error
+		if parts, err = shamir.Split(value, total, threshold); err != nil {
+			return nil, fmt.Errorf("split secret failed, err=%s", err)
+		}
+	}
+	shares := make([]*Share, 0, total)
+	for i, part := range parts {
+		shares = append(shares, &Share{
+			Version:   Version,
+			SecretID:  id,
+			Threshold: uint8(threshold),
+			Total:     uint8(total),
+			Index:     uint8(i + 1),
+			Payload:   part,
+		})
+	}
+	return shares, nil
+}
+
+// Validate checks that shares belong to the same secret, are distinct, decrypted and enough to combine
+func Validate(shares []*Share) error {
+	if len(shares) == 0 {
+		return fmt.Errorf("no shares")
+	}
+	first := shares[0]
+	seen := make(map[uint8]bool, len(shares))
+	for _, s := range shares {
+		if err := s.check(); err != nil {
+			return err
+		}
+		if s.Encrypted {
+			return fmt.Errorf("share %d is encrypted", s.Index)
+		}
+		if s.SecretID != first.SecretID {
+			return fmt.Errorf("share %d belongs to secret %x, want %x", s.Index, s.SecretID, first.SecretID)
+		}
+		if s.Threshold != first.Threshold || s.Total != first.Total || len(s.Payload) != len(first.Payload) {
+			return fmt.Errorf("share %d has different parameters", s.Index)
+		}
+		if seen[s.Index] {
+			return fmt.Errorf("share %d is duplicated", s.Index)
+		}
+		seen[s.Index] = true
+	}
+	if len(shares) < int(first.Threshold) {
+		return fmt.Errorf("need %d shares, got %d", first.Threshold, len(shares))
+	}
+	return nil
+}
+
+// Combine validates shares and recovers the secret, the result is checked against the digest
+func Combine(shares []*Share) ([]byte, error) {
+	if err := Validate(shares); err != nil {
+		return nil, err
+	}
+	var value []byte
+	if shares[0].Threshold == 1 {
+		value = append([]byte{}, shares[0].Payload...)
+	} else {
+		parts := make([][]byte, 0, len(shares))
+		for _, s := range shares {
+			parts = append(parts, s.Payload)
+		}
+		var err error
+		if value, err = shamir.Combine(parts); err != nil {
+			return nil, fmt.Errorf("combine shares failed, err=%s", err)
+		}
+	}
+	if len(value) <= digestSize {
+		return nil, fmt.Errorf("combined value is too short, shares are corrupted")
+	}
+	secret := value[digestSize:]
+	digest := secretDigest(shares[0].SecretID, secret)
+	if !hmac.Equal(digest[:], value[:digestSize]) {
+		return nil, fmt.Errorf("combined secret does not match the digest, shares are corrupted")
+	}
+	return secret, nil
+}
+
+// Bytes encodes the share: header, payload and a sha256 checksum
+func (s *Share) Bytes() []byte {
+	buf := s.header()
+	buf = append(buf, s.Payload...)
+	sum := sha256.Sum256(buf)
+	return append(buf, sum[:checksumSize]...)
+}
+
+// Parse decodes and checks a share encoded by Bytes, trailing zero bytes are ignored
+func Parse(data []byte) (*Share, error) {
+	if len(data) < headerSize+checksumSize {
+		return nil, fmt.Errorf("share is too short")
+	}
+	s := &Share{Version: data[0]}
+	if s.Version != Version {
+		return nil, fmt.Errorf("unsupported share version=%d", s.Version)
+	}
+	copy(s.SecretID[:], data[1:])
+	s.Threshold, s.Total, s.Index = data[1+idSize], data[2+idSize], data[3+idSize]
+	s.Encrypted = data[4+idSize]&flagEncrypted != 0
+	size := int(binary.BigEndian.Uint16(data[headerSize-2:]))
+	end := headerSize + size + checksumSize
+	if len(data) < end {
+		return nil, fmt.Errorf("share is truncated")
+	}
+	if len(bytes.Trim(data[end:], "\x00")) != 0 {
+		return nil, fmt.Errorf("share has trailing data")
+	}
+	sum := sha256.Sum256(data[:headerSize+size])
+	if !bytes.Equal(sum[:checksumSize], data[headerSize+size:end]) {
+		return nil, fmt.Errorf("share checksum mismatch")
+	}
+	s.Payload = append([]byte{}, data[headerSize:headerSize+size]...)
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Share) header() []byte {
+	buf := make([]byte, 0, headerSize+len(s.Payload)+checksumSize)
+	buf = append(buf, s.Version)
+	buf = append(buf, s.SecretID[:]...)
+	buf = append(buf, s.Threshold, s.Total, s.Index)
+	var flags byte
+	if s.Encrypted {
+		flags |= flagEncrypted
+	}
+	buf = append(buf, flags)
+	return binary.BigEndian.AppendUint16(buf, uint16(len(s.Payload)))
+}
+
+func (s *Share) check() error {
+	if s.Threshold < 1 || s.Threshold > s.Total {
+		return fmt.Errorf("invalid share threshold %d of %d", s.Threshold, s.Total)
+	}
+	if s.Index < 1 || s.Index > s.Total {
+		return fmt.Errorf("invalid share index %d of %d", s.Index, s.Total)
+	}
+	if len(s.Payload) == 0 || len(s.Payload) > 0xffff {
+		return fmt.Errorf("invalid share payload size=%d", len(s.Payload))
+	}
+	return nil
+}
+
+func secretDigest(id [idSize]byte, secret []byte) [digestSize]byte {
+	mac := hmac.New(sha256.New, id[:])
+	mac.Write(secret)
+	var digest [digestSize]byte
+	copy(digest[:], mac.Sum(nil))
+	return digest
+}
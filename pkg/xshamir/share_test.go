@@ -0,0 +1,102 @@
+package xshamir
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("0x4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+	shares, err := Split(secret, 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, enc := range []Encoding{EncodingHex, EncodingBase58, EncodingWords} {
+		var decoded []*Share
+		for _, s := range shares[1:4] {
+			text, err := s.Encode(enc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := Decode(text, enc)
+			if err != nil {
+				t.Fatalf("%s: %s", enc, err)
+			}
+			decoded = append(decoded, d)
+		}
+		got, err := Combine(decoded)
+		if err != nil || !bytes.Equal(got, secret) {
+			t.Fatalf("%s combine=%q, err=%v", enc, got, err)
+		}
+	}
+
+	if _, err := Combine(shares[:2]); err == nil {
+		t.Fatal("combined below threshold")
+	}
+	if _, err := Combine([]*Share{shares[0], shares[0], shares[1]}); err == nil {
+		t.Fatal("combined duplicated shares")
+	}
+	other, _ := Split(secret, 3, 5)
+	if _, err := Combine([]*Share{shares[0], shares[1], other[2]}); err == nil {
+		t.Fatal("combined shares of different secrets")
+	}
+	// same id and parameters, the mix is only caught by the digest inside the shared value
+	var id [idSize]byte
+	copy(id[:], "samename")
+	a, _ := SplitWithID(secret, id, 2, 3)
+	b, _ := SplitWithID(bytes.ToUpper(secret), id, 2, 3)
+	if _, err := Combine([]*Share{a[0], b[1]}); err == nil {
+		t.Fatal("combined shares of different secrets with the same id")
+	}
+	text, _ := shares[0].Encode(EncodingHex)
+	if _, err := Decode(text[:len(text)-2]+"00", EncodingHex); err == nil {
+		t.Fatal("checksum not verified")
+	}
+	corrupted := *shares[2]
+	corrupted.Payload = append([]byte{}, corrupted.Payload...)
+	corrupted.Payload[0] ^= 1
+	if _, err := Combine([]*Share{shares[0], shares[1], &corrupted}); err == nil {
+		t.Fatal("corrupted share not detected")
+	}
+}
+
+func TestEncryptedShares(t *testing.T) {
+	secret := []byte("secret")
+	shares, _ := Split(secret, 2, 2)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	x25519Key, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	xid := &X25519Identity{Key: x25519Key}
+
+	first, err := shares[0].Encrypt(&RSARecipient{Key: &rsaKey.PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := shares[1].Encrypt(xid.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Combine([]*Share{first, second}); err == nil {
+		t.Fatal("combined encrypted shares")
+	}
+	text, _ := first.Encode(EncodingBase58)
+	first, _ = Decode(text, EncodingBase58)
+	first, err = first.Decrypt(&RSAIdentity{Key: rsaKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := *second
+	tampered.Index = 1
+	if _, err := tampered.Decrypt(xid); err == nil {
+		t.Fatal("tampered header decrypted")
+	}
+	second, err = second.Decrypt(xid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Combine([]*Share{first, second}); err != nil || !bytes.Equal(got, secret) {
+		t.Fatalf("combine=%q, err=%v", got, err)
+	}
+}
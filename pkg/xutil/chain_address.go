@@ -8,13 +8,12 @@ import (
 	"fmt"
 	SolClient "github.com/blocto/solana-go-sdk/client"
 	SolCommon "github.com/blocto/solana-go-sdk/common"
-	"github.com/blocto/solana-go-sdk/pkg/hdwallet"
-	"github.com/blocto/solana-go-sdk/types"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/h8848/blockchain-infra/chain/chain_client/tron"
 	"github.com/h8848/blockchain-infra/chain/ethereum/eth_abi"
+	"github.com/h8848/blockchain-infra/chain/hdwallet"
 	"github.com/shopspring/decimal"
 	"github.com/tyler-smith/go-bip39"
 	"strconv"
@@ -73,20 +72,35 @@ func TronAddrToEthAddr(tronAddr string) (ethAddr string) {
 	return ethAddress.Hex()
 }
 
+// MnemonicGetSolAddress 助记词通过 SLIP-0010 派生 SOL 地址，path 默认 m/44'/501'/0'/0'
 func MnemonicGetSolAddress(mnemonic string, path string) (address string, err error) {
+	key, err := MnemonicGetSolPrivateKey(mnemonic, "", path)
+	if err != nil {
+		return "", err
+	}
+	return hdwallet.SolanaAddress(key), nil
+}
+
+// MnemonicGetSolPrivateKey 助记词通过 SLIP-0010 派生 SOL 私钥，path 默认 m/44'/501'/0'/0'
+func MnemonicGetSolPrivateKey(mnemonic, passphrase, path string) (ed25519.PrivateKey, error) {
 	if path == "" {
-		path = `m/44'/501'/0'/0'`
+		path = hdwallet.SolanaDefaultPath
 	}
-	seed := bip39.NewSeed(mnemonic, "")
-	derivedKey, err := hdwallet.Derived(path, seed)
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	account, err := types.AccountFromSeed(derivedKey.PrivateKey)
+	return hdwallet.SolanaKey(seed, path)
+}
+
+// MigrateLegacySolAddresses 将旧算法（secp256k1 私钥直接作为 ed25519 种子）生成的 SOL 地址映射到 SLIP-0010 地址
+// legacyPathFormat 为旧地址使用的 secp256k1 派生路径，账户序号用 %d 表示，如 m/44'/60'/0'/0/%d
+func MigrateLegacySolAddresses(mnemonic, passphrase, legacyPathFormat string, start, count uint32) ([]hdwallet.SolanaMigration, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return account.PublicKey.ToBase58(), nil
+	return hdwallet.MigrateSolana(seed, legacyPathFormat, start, count)
 }
 
 func PrivateKeyGetEthAddress(privateKeyECDSA *ecdsa.PrivateKey) (address string, err error) {
@@ -109,32 +123,38 @@ func PrivateKeyGetTronAddress(privateKeyECDSA *ecdsa.PrivateKey) (address string
 	return ETHToTronAddress(ethAddress), nil
 }
 
+// LegacyPrivateKeyGetSolAddress 旧算法：secp256k1 私钥直接作为 ed25519 种子，仅用于迁移已有地址
+func LegacyPrivateKeyGetSolAddress(privateKeyECDSA *ecdsa.PrivateKey) (address string, err error) {
+	return hdwallet.SolanaAddress(hdwallet.LegacySolanaKeyFromSecp256k1(privateKeyECDSA)), nil
+}
+
+// LegacyPrivateECDSAToSolEd25519 旧算法：secp256k1 私钥直接作为 ed25519 种子，仅用于迁移已有地址
+func LegacyPrivateECDSAToSolEd25519(privateKeyECDSA *ecdsa.PrivateKey) (edPrivate ed25519.PrivateKey, err error) {
+	return hdwallet.LegacySolanaKeyFromSecp256k1(privateKeyECDSA), nil
+}
+
+// LegacyEcdsaPrivateKeyGetSolPrivateKey 旧算法：secp256k1 私钥直接作为 ed25519 种子，仅用于迁移已有地址
+func LegacyEcdsaPrivateKeyGetSolPrivateKey(privateKeyECDSA *ecdsa.PrivateKey) (key ed25519.PrivateKey, address string, err error) {
+	key = hdwallet.LegacySolanaKeyFromSecp256k1(privateKeyECDSA)
+	return key, hdwallet.SolanaAddress(key), nil
+}
+
+// Deprecated: the address does not follow SLIP-0010, use MnemonicGetSolAddress for new addresses
+// or LegacyPrivateKeyGetSolAddress to find existing ones.
 func PrivateKeyGetSolAddress(privateKeyECDSA *ecdsa.PrivateKey) (address string, err error) {
-	privateKeyBytes := privateKeyECDSA.D.Bytes()
-	privateKeyEd25519 := ed25519.NewKeyFromSeed(privateKeyBytes)
-	//fmt.Println("Ed25519私钥", base58.Encode(privateKeyEd25519))
-	solPublicKey := make([]byte, ed25519.PublicKeySize)
-	copy(solPublicKey, privateKeyEd25519.Public().(ed25519.PublicKey))
-	//fmt.Println("Ed25519公钥", hex.EncodeToString(solPublicKey))
-	solAddress := SolCommon.PublicKeyFromBytes(solPublicKey).ToBase58()
-	return solAddress, nil
+	return LegacyPrivateKeyGetSolAddress(privateKeyECDSA)
 }
 
+// Deprecated: the key does not follow SLIP-0010, use MnemonicGetSolPrivateKey for new keys
+// or LegacyPrivateECDSAToSolEd25519 to recover existing ones.
 func PrivateECDSAToSolEd25519(privateKeyECDSA *ecdsa.PrivateKey) (edPrivate ed25519.PrivateKey, err error) {
-	privateKeyBytes := privateKeyECDSA.D.Bytes()
-	privateKeyEd25519 := ed25519.NewKeyFromSeed(privateKeyBytes)
-	//fmt.Println("Ed25519私钥", base58.Encode(privateKeyEd25519))
-	//solPublicKey := make([]byte, ed25519.PublicKeySize)
-	return privateKeyEd25519, nil
+	return LegacyPrivateECDSAToSolEd25519(privateKeyECDSA)
 }
 
+// Deprecated: the key does not follow SLIP-0010, use MnemonicGetSolPrivateKey for new keys
+// or LegacyEcdsaPrivateKeyGetSolPrivateKey to recover existing ones.
 func EcdsaPrivateKeyGetSolPrivateKey(privateKeyECDSA *ecdsa.PrivateKey) (key ed25519.PrivateKey, address string, err error) {
-	privateKeyBytes := privateKeyECDSA.D.Bytes()
-	privateKeyEd25519 := ed25519.NewKeyFromSeed(privateKeyBytes)
-	solPublicKey := make([]byte, ed25519.PublicKeySize)
-	copy(solPublicKey, privateKeyEd25519.Public().(ed25519.PublicKey))
-	solAddress := SolCommon.PublicKeyFromBytes(solPublicKey).ToBase58()
-	return privateKeyEd25519, solAddress, nil
+	return LegacyEcdsaPrivateKeyGetSolPrivateKey(privateKeyECDSA)
 }
 
 func EthBalanceAtAndOf(address, contract, tokenDecimals string, ethClient *ethclient.Client) (bAt, bOf decimal.Decimal, err error) {
@@ -8,13 +8,24 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/h8848/blockchain-infra/chain/chain_client"
+	"github.com/h8848/blockchain-infra/chain/chain_client/feeoracle"
+	"github.com/h8848/blockchain-infra/chain/chain_client/nonce"
+	"github.com/h8848/blockchain-infra/chain/signer"
 	"math/big"
 )
 
 type Erc20Transfer struct {
 	Client     *ethclient.Client
 	PrivateKey *ecdsa.PrivateKey
-	Contract   *common.Address
+	// Signer is used instead of PrivateKey when set
+	Signer   signer.Signer
+	Contract *common.Address
+	// Nonces is optional, when set nonces are reserved from the manager instead of PendingNonceAt
+	// so concurrent transfers from the same wallet don't collide
+	Nonces *nonce.Manager
+	// Fees is optional, by default the normal preset of an EIP-1559 oracle over Client is used
+	Fees *feeoracle.Oracle
 }
 
 func NewErc20Transfer(client *ethclient.Client, privateKey *ecdsa.PrivateKey, contract common.Address) *Erc20Transfer {
@@ -25,35 +36,43 @@ func NewErc20Transfer(client *ethclient.Client, privateKey *ecdsa.PrivateKey, co
 	}
 }
 
+// NewErc20TransferWithSigner creates the transfer for a signer, the private key is never seen by the caller
+func NewErc20TransferWithSigner(client *ethclient.Client, s signer.Signer, contract common.Address) *Erc20Transfer {
+	return &Erc20Transfer{
+		Client:   client,
+		Signer:   s,
+		Contract: &contract,
+	}
+}
+
 func (e *Erc20Transfer) Close() {
 	e.Client.Close()
 	e.Contract = nil
 	e.PrivateKey = nil
+	e.Signer = nil
 }
 
-func (e *Erc20Transfer) SenToErc20(toAddress common.Address, amount *big.Int) (string, error) {
-
-	publicKey := e.PrivateKey.Public()
-	publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
-	if !ok {
-		return "", errors.New("cannot assert type: publicKey is not of type *ecdsa.PublicKey")
+func (e *Erc20Transfer) signer() (signer.Signer, error) {
+	if e.Signer != nil {
+		return e.Signer, nil
 	}
+	if e.PrivateKey == nil {
+		return nil, errors.New("neither signer nor private key is set")
+	}
+	return signer.NewLocalSigner(e.PrivateKey, signer.FamilyEVM)
+}
 
-	fromAddress := crypto.PubkeyToAddress(*publicKeyECDSA)
-	nonce, err := e.Client.PendingNonceAt(context.Background(), fromAddress)
+func (e *Erc20Transfer) SenToErc20(toAddress common.Address, amount *big.Int) (string, error) {
+	s, err := e.signer()
 	if err != nil {
 		return "", err
 	}
+	fromAddress := common.HexToAddress(s.Address())
 	chainID, err := e.Client.ChainID(context.Background())
 	if err != nil {
 		return "", err
 	}
-
-	gasPrice, err := e.Client.SuggestGasPrice(context.Background())
-	if err != nil {
-		return "", err
-	}
-	gasTipPrice, err := e.Client.SuggestGasTipCap(context.Background())
+	txNonce, reservation, err := e.reserveNonce(chainID, fromAddress)
 	if err != nil {
 		return "", err
 	}
@@ -71,90 +90,109 @@ func (e *Erc20Transfer) SenToErc20(toAddress common.Address, amount *big.Int) (s
 	data = append(data, paddedAddress...)
 	data = append(data, paddedAmount...)
 
-	txTata := &types.DynamicFeeTx{
-		ChainID:   chainID,
-		Nonce:     nonce,
-		To:        e.Contract,
-		Gas:       uint64(21000 * 3),
-		GasFeeCap: gasPrice,
-		GasTipCap: gasTipPrice,
-		Data:      data,
+	oracle := e.Fees
+	if oracle == nil {
+		oracle = feeoracle.New(e.Client, &feeoracle.Config{})
+	}
+	tx, err := newTransferTx(oracle, chainID, txNonce, fromAddress, *e.Contract, data)
+	if err != nil {
+		releaseNonce(reservation)
+		return "", err
 	}
-	tx := types.NewTx(txTata)
 
-	signerTX := types.NewLondonSigner(chainID)
-	signedTx, err := types.SignTx(tx, signerTX, e.PrivateKey)
+	signedTx, err := SignEthTx(s, tx, chainID)
 	if err != nil {
+		releaseNonce(reservation)
 		return "", err
 	}
 	//send
 	err = e.Client.SendTransaction(context.Background(), signedTx)
 	if err != nil {
+		releaseNonce(reservation)
 		return "", err
 	}
+	if reservation != nil {
+		if err = reservation.Commit(signedTx.Hash().Hex()); err != nil {
+			return signedTx.Hash().Hex(), err
+		}
+	}
 	return signedTx.Hash().Hex(), nil
 }
 
-func Erc20SingAndSend(client *ethclient.Client, privateKey *ecdsa.PrivateKey, contract, toAddress common.Address, amount *big.Int) (string, error) {
-
-	publicKey := privateKey.Public()
-	publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
-	if !ok {
-		return "", errors.New("cannot assert type: publicKey is not of type *ecdsa.PublicKey")
+// reserveNonce returns the nonce for from, the reservation is nil when no nonce manager is set
+func (e *Erc20Transfer) reserveNonce(chainID *big.Int, from common.Address) (uint64, *nonce.Reservation, error) {
+	if e.Nonces == nil {
+		n, err := e.Client.PendingNonceAt(context.Background(), from)
+		return n, nil, err
 	}
-
-	fromAddress := crypto.PubkeyToAddress(*publicKeyECDSA)
-	nonce, err := client.PendingNonceAt(context.Background(), fromAddress)
+	e.Nonces.AddChain(chainID.String(), &nonce.EthReader{Client: e.Client})
+	reservation, err := e.Nonces.Reserve(chainID.String(), from.Hex())
 	if err != nil {
-		return "", err
-	}
-	chainID, err := client.ChainID(context.Background())
-	if err != nil {
-		return "", err
+		return 0, nil, err
 	}
+	return reservation.Nonce, reservation, nil
+}
 
-	gasPrice, err := client.SuggestGasPrice(context.Background())
-	if err != nil {
-		return "", err
-	}
-	gasTipPrice, err := client.SuggestGasTipCap(context.Background())
+// newTransferTx builds the unsigned contract call with the normal fee preset and an estimated gas limit
+func newTransferTx(oracle *feeoracle.Oracle, chainID *big.Int, nonce uint64, from, contract common.Address, data []byte) (*types.Transaction, error) {
+	fee, err := oracle.Suggest(&chain_client.Transaction{
+		From: from.Hex(),
+		To:   contract.Hex(),
+		Data: data,
+	}, feeoracle.SpeedNormal)
 	if err != nil {
-		return "", err
-	}
-
-	// 编码 ERC20 `transfer` 方法
-	transferFnSignature := []byte("transfer(address,uint256)")
-	hash := crypto.Keccak256Hash(transferFnSignature).Hex()
-	methodID := common.HexToHash(hash).Bytes()[:4]
-
-	// 添加方法 ID 和参数（地址和金额）
-	paddedAddress := common.LeftPadBytes(toAddress.Bytes(), 32)
-	paddedAmount := common.LeftPadBytes(amount.Bytes(), 32)
-	var data []byte
-	data = append(data, methodID...)
-	data = append(data, paddedAddress...)
-	data = append(data, paddedAmount...)
-
-	txTata := &types.DynamicFeeTx{
+		return nil, err
+	}
+	if !oracle.SupportEIP1559() {
+		return types.NewTx(&types.LegacyTx{
+			Nonce:    nonce,
+			To:       &contract,
+			Gas:      fee.Gas.Uint64(),
+			GasPrice: fee.GasFeeCap,
+			Data:     data,
+		}), nil
+	}
+	return types.NewTx(&types.DynamicFeeTx{
 		ChainID:   chainID,
 		Nonce:     nonce,
 		To:        &contract,
-		Gas:       uint64(21000 * 3),
-		GasFeeCap: gasPrice,
-		GasTipCap: gasTipPrice,
+		Gas:       fee.Gas.Uint64(),
+		GasFeeCap: fee.GasFeeCap,
+		GasTipCap: fee.GasTipCap,
 		Data:      data,
+	}), nil
+}
+
+func releaseNonce(reservation *nonce.Reservation) {
+	if reservation != nil {
+		_ = reservation.Release()
 	}
-	tx := types.NewTx(txTata)
+}
 
-	signerTX := types.NewLondonSigner(chainID)
-	signedTx, err := types.SignTx(tx, signerTX, privateKey)
+// Erc20SingAndSend sends a transfer signed by privateKey, prefer Erc20SignerSend so the key stays in a signer
+func Erc20SingAndSend(client *ethclient.Client, privateKey *ecdsa.PrivateKey, contract, toAddress common.Address, amount *big.Int) (string, error) {
+	s, err := signer.NewLocalSigner(privateKey, signer.FamilyEVM)
 	if err != nil {
 		return "", err
 	}
-	//send
-	err = client.SendTransaction(context.Background(), signedTx)
+	return Erc20SignerSend(client, s, contract, toAddress, amount, nil)
+}
+
+// Erc20SignerSend sends a transfer of amount tokens to toAddress signed by s
+// nonces is optional, when set the nonce is reserved from the manager and committed or released after the broadcast,
+// a nil manager uses PendingNonceAt which is only safe when nothing else sends from the wallet
+func Erc20SignerSend(client *ethclient.Client, s signer.Signer, contract, toAddress common.Address, amount *big.Int, nonces *nonce.Manager) (string, error) {
+	transfer := NewErc20TransferWithSigner(client, s, contract)
+	transfer.Nonces = nonces
+	return transfer.SenToErc20(toAddress, amount)
+}
+
+// SignEthTx signs tx with s for chainID
+func SignEthTx(s signer.Signer, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	txSigner := types.LatestSignerForChainID(chainID)
+	sig, err := s.SignHash(txSigner.Hash(tx).Bytes())
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return signedTx.Hash().Hex(), nil
+	return tx.WithSignature(txSigner, sig)
 }
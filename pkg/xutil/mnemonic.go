@@ -31,6 +31,7 @@ func SplitNumber(num int64) (string, string, error) {
 	return leftPart, rightPart, nil
 }
 
+// SplitToShares shamir拆分私钥，输出裸分片，需要阈值、校验和加密时使用 xshamir.Split
 func SplitToShares(privateKey string, minimumShares int, totalShares int) ([][]byte, error) {
 	if privateKey == "" {
 		return nil, fmt.Errorf("private key cannot be nil")
@@ -79,18 +80,21 @@ func IsValidMnemonic(mnemonic string) bool {
 	return err == nil
 }
 
-// CombineShares shamir合并私钥
+// CombineShares shamir合并私钥，分片错误时不会报错而是得到错误的结果，xshamir.Combine 会先校验分片
 func CombineShares(shares [][]byte) ([]byte, error) {
 	return shamir.Combine(shares)
 }
 
-// MnemonicToPrivateKey 助记词转私钥
+// MnemonicToPrivateKey 助记词转私钥，派生多个地址时使用 hdwallet.HDWallet 以复用主密钥
 func MnemonicToPrivateKey(mnemonic, salt, pathStr string) (*ecdsa.PrivateKey, error) {
 	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, salt)
 	if err != nil {
 		return nil, err
 	}
 	masterKey, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, err
+	}
 	path, err := accounts.ParseDerivationPath(pathStr)
 	if err != nil {
 		return nil, err
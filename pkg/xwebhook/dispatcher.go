@@ -0,0 +1,145 @@
+package xwebhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DispatcherConfig is the config of a Dispatcher
+// the delay before attempt n+1 is InitialBackoff*2^(n-1) capped by MaxBackoff
+type DispatcherConfig struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration
+	DeadLetters    DeadLetterStore
+}
+
+// Dispatcher signs and delivers webhooks, deliveries that fail after all attempts go to the dead letter store
+type Dispatcher struct {
+	conf   DispatcherConfig
+	signer Signer
+	client *http.Client
+	sleep  func(ctx context.Context, d time.Duration) error
+}
+
+func NewDispatcher(signer Signer, conf *DispatcherConfig) *Dispatcher {
+	c := DispatcherConfig{}
+	if conf != nil {
+		c = *conf
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 5
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = time.Second
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = 5 * time.Minute
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.DeadLetters == nil {
+		c.DeadLetters = NewMemoryDeadLetterStore()
+	}
+	return &Dispatcher{conf: c, signer: signer, client: &http.Client{Timeout: c.Timeout}, sleep: sleepContext}
+}
+
+// Send delivers payload to url, each attempt is signed again with a fresh timestamp and nonce
+// a 2xx response is a success, 4xx responses other than 408 and 429 are not retried
+func (d *Dispatcher) Send(ctx context.Context, url, eventID string, payload []byte) error {
+	var lastErr error
+	var lastStatus int
+	attempts := 0
+	for attempts < d.conf.MaxAttempts {
+		if attempts > 0 {
+			if err := d.sleep(ctx, d.backoff(attempts)); err != nil {
+				lastErr = err
+				break
+			}
+		}
+		attempts++
+		status, err := d.deliver(ctx, url, eventID, payload)
+		if err == nil {
+			return nil
+		}
+		lastErr, lastStatus = err, status
+		if !retryable(status) {
+			break
+		}
+	}
+	dl := &DeadLetter{
+		EventID:    eventID,
+		URL:        url,
+		Payload:    payload,
+		Attempts:   attempts,
+		LastStatus: lastStatus,
+		LastError:  lastErr.Error(),
+	}
+	if err := d.conf.DeadLetters.Save(dl); err != nil {
+		return fmt.Errorf("deliver webhook failed, err=%s, save dead letter failed, err=%s", lastErr, err)
+	}
+	return fmt.Errorf("deliver webhook %s failed after %d attempts, err=%s", eventID, attempts, lastErr)
+}
+
+// Redeliver sends a dead letter again and removes it on success
+func (d *Dispatcher) Redeliver(ctx context.Context, dl *DeadLetter) error {
+	if _, err := d.deliver(ctx, dl.URL, dl.EventID, dl.Payload); err != nil {
+		return err
+	}
+	return d.conf.DeadLetters.Delete(dl.ID)
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, url, eventID string, payload []byte) (int, error) {
+	signed, err := Sign(d.signer, eventID, payload, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(signed.Body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header = signed.Header
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("post webhook failed, err=%s", err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	if res.StatusCode/100 != 2 {
+		return res.StatusCode, fmt.Errorf("webhook status=%d, body=%s", res.StatusCode, bytes.TrimSpace(body))
+	}
+	return res.StatusCode, nil
+}
+
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := d.conf.InitialBackoff
+	for i := 1; i < attempt && delay < d.conf.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.conf.MaxBackoff {
+		delay = d.conf.MaxBackoff
+	}
+	return delay
+}
+
+// retryable reports whether a failed attempt may succeed later, status is 0 for transport errors
+func retryable(status int) bool {
+	return status == 0 || status >= 500 || status == http.StatusTooManyRequests || status == http.StatusRequestTimeout
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,107 @@
+package xwebhook
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// NonceStore remembers nonces until they leave the replay window
+// Add returns false when the nonce is already known
+type NonceStore interface {
+	Add(nonce string, expireAt time.Time) (bool, error)
+}
+
+// MemoryNonceStore is a NonceStore in process, use a shared store such as redis with several receivers
+type MemoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{nonces: make(map[string]time.Time)}
+}
+
+func (s *MemoryNonceStore) Add(nonce string, expireAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for n, exp := range s.nonces {
+		if exp.Before(now) {
+			delete(s.nonces, n)
+		}
+	}
+	if _, ok := s.nonces[nonce]; ok {
+		return false, nil
+	}
+	s.nonces[nonce] = expireAt
+	return true, nil
+}
+
+// ReceiverConfig is the config of a Receiver, Window defaults to 5 minutes
+type ReceiverConfig struct {
+	Window  time.Duration
+	MaxBody int64
+	Nonces  NonceStore
+}
+
+// Receiver verifies incoming webhooks and rejects replays
+type Receiver struct {
+	conf     ReceiverConfig
+	verifier Verifier
+	now      func() time.Time
+}
+
+func NewReceiver(verifier Verifier, conf *ReceiverConfig) *Receiver {
+	c := ReceiverConfig{}
+	if conf != nil {
+		c = *conf
+	}
+	if c.Window <= 0 {
+		c.Window = 5 * time.Minute
+	}
+	if c.MaxBody <= 0 {
+		c.MaxBody = 1 << 20
+	}
+	if c.Nonces == nil {
+		c.Nonces = NewMemoryNonceStore()
+	}
+	return &Receiver{conf: c, verifier: verifier, now: time.Now}
+}
+
+// Verify checks the signature, the timestamp window and the nonce of a received body
+func (r *Receiver) Verify(header http.Header, body []byte) error {
+	ts, nonce, err := VerifyHeader(r.verifier, header, body)
+	if err != nil {
+		return err
+	}
+	now := r.now()
+	if ts.Before(now.Add(-r.conf.Window)) || ts.After(now.Add(r.conf.Window)) {
+		return ErrExpired
+	}
+	fresh, err := r.conf.Nonces.Add(nonce, ts.Add(r.conf.Window))
+	if err != nil {
+		return fmt.Errorf("check webhook nonce failed, err=%s", err)
+	}
+	if !fresh {
+		return ErrReplayed
+	}
+	return nil
+}
+
+// VerifyRequest reads and verifies the body of req
+func (r *Receiver) VerifyRequest(req *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(req.Body, r.conf.MaxBody+1))
+	if err != nil {
+		return nil, fmt.Errorf("read webhook body failed, err=%s", err)
+	}
+	if int64(len(body)) > r.conf.MaxBody {
+		return nil, fmt.Errorf("webhook body is larger than %d bytes", r.conf.MaxBody)
+	}
+	if err := r.Verify(req.Header, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
@@ -0,0 +1,216 @@
+package xwebhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/h8848/blockchain-infra/pkg/xrsa"
+)
+
+// headers of a signed webhook
+const (
+	HeaderEventID   = "X-Webhook-Id"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderNonce     = "X-Webhook-Nonce"
+	HeaderAlgorithm = "X-Webhook-Algorithm"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// signature algorithms
+const (
+	AlgHMACSHA256   = "hmac-sha256"
+	AlgRSAPSSSHA256 = "rsa-pss-sha256"
+)
+
+// signatureVersion prefixes the signature header so the signed message can change later
+// v2 signs "id.timestamp.nonce.body" over the body bytes as sent
+const signatureVersion = "v2="
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrExpired          = errors.New("webhook timestamp is outside of the replay window")
+	ErrReplayed         = errors.New("webhook nonce was already used")
+)
+
+// Canonicalize re-encodes a JSON payload with sorted object keys, no insignificant whitespace
+// and numbers kept as written, Sign sends this form so bodies of the same event are stable.
+// It is not RFC 8785, the signature covers the body bytes as sent and receivers must not re-encode them
+func Canonicalize(payload []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("decode payload failed, err=%s", err)
+	}
+	if dec.More() {
+		return nil, errors.New("payload has trailing data")
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// Signer signs webhook messages
+type Signer interface {
+	Algorithm() string
+	Sign(message []byte) ([]byte, error)
+}
+
+// Verifier verifies signatures of a Signer
+type Verifier interface {
+	Algorithm() string
+	Verify(message, sig []byte) error
+}
+
+// HMACKey is a shared secret, it is both the Signer and the Verifier
+type HMACKey []byte
+
+func (k HMACKey) Algorithm() string {
+	return AlgHMACSHA256
+}
+
+func (k HMACKey) Sign(message []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, k)
+	mac.Write(message)
+	return mac.Sum(nil), nil
+}
+
+func (k HMACKey) Verify(message, sig []byte) error {
+	expected, _ := k.Sign(message)
+	if !hmac.Equal(expected, sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// RSASigner signs with RSA-PSS, merchants verify with the public key or its JWK from xrsa.PublicKeyToJWK
+type RSASigner struct {
+	Key *rsa.PrivateKey
+}
+
+func (s *RSASigner) Algorithm() string {
+	return AlgRSAPSSSHA256
+}
+
+func (s *RSASigner) Sign(message []byte) ([]byte, error) {
+	return xrsa.SignPSS(message, s.Key)
+}
+
+// RSAVerifier verifies signatures of an RSASigner
+type RSAVerifier struct {
+	Key *rsa.PublicKey
+}
+
+func (v *RSAVerifier) Algorithm() string {
+	return AlgRSAPSSSHA256
+}
+
+func (v *RSAVerifier) Verify(message, sig []byte) error {
+	if err := xrsa.VerifyPSS(message, sig, v.Key); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// SignedPayload is a canonical body with the headers to send
+type SignedPayload struct {
+	Body   []byte
+	Header http.Header
+}
+
+// Sign canonicalizes payload and signs "id.timestamp.nonce.body", eventID must not contain a dot
+func Sign(s Signer, eventID string, payload []byte, now time.Time) (*SignedPayload, error) {
+	if err := checkEventID(eventID); err != nil {
+		return nil, err
+	}
+	body, err := Canonicalize(payload)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	nonceHex := hex.EncodeToString(nonce)
+	sig, err := s.Sign(signedMessage(eventID, timestamp, nonceHex, body))
+	if err != nil {
+		return nil, fmt.Errorf("sign webhook failed, err=%s", err)
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set(HeaderEventID, eventID)
+	header.Set(HeaderTimestamp, timestamp)
+	header.Set(HeaderNonce, nonceHex)
+	header.Set(HeaderAlgorithm, s.Algorithm())
+	header.Set(HeaderSignature, signatureVersion+base64.StdEncoding.EncodeToString(sig))
+	return &SignedPayload{Body: body, Header: header}, nil
+}
+
+func checkEventID(eventID string) error {
+	if eventID == "" || strings.Contains(eventID, ".") {
+		return fmt.Errorf("invalid webhook event id=%q", eventID)
+	}
+	return nil
+}
+
+// signedMessage binds the event id so a signed body cannot be replayed under another id
+func signedMessage(eventID, timestamp, nonce string, body []byte) []byte {
+	msg := make([]byte, 0, len(eventID)+len(timestamp)+len(nonce)+len(body)+3)
+	msg = append(msg, eventID...)
+	msg = append(msg, '.')
+	msg = append(msg, timestamp...)
+	msg = append(msg, '.')
+	msg = append(msg, nonce...)
+	msg = append(msg, '.')
+	return append(msg, body...)
+}
+
+// VerifyHeader verifies the signature of a received body exactly as it was read from the request,
+// the nonce is checked against the replay window by the Receiver
+func VerifyHeader(v Verifier, header http.Header, body []byte) (timestamp time.Time, nonce string, err error) {
+	if alg := header.Get(HeaderAlgorithm); alg != v.Algorithm() {
+		return time.Time{}, "", fmt.Errorf("unexpected webhook algorithm=%s", alg)
+	}
+	ts := header.Get(HeaderTimestamp)
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid webhook timestamp=%s", ts)
+	}
+	eventID := header.Get(HeaderEventID)
+	if err := checkEventID(eventID); err != nil {
+		return time.Time{}, "", err
+	}
+	nonce = header.Get(HeaderNonce)
+	if nonce == "" {
+		return time.Time{}, "", errors.New("missing webhook nonce")
+	}
+	value := header.Get(HeaderSignature)
+	if !strings.HasPrefix(value, signatureVersion) {
+		return time.Time{}, "", ErrInvalidSignature
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, signatureVersion))
+	if err != nil {
+		return time.Time{}, "", ErrInvalidSignature
+	}
+	if err := v.Verify(signedMessage(eventID, ts, nonce, body), sig); err != nil {
+		return time.Time{}, "", err
+	}
+	return time.Unix(unix, 0), nonce, nil
+}
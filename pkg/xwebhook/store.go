@@ -0,0 +1,147 @@
+package xwebhook
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/h8848/blockchain-infra/pkg/xgorm"
+	"gorm.io/gorm"
+)
+
+// DeadLetter is a webhook that could not be delivered, ID is assigned by the store
+type DeadLetter struct {
+	ID         uint64
+	EventID    string
+	URL        string
+	Payload    []byte
+	Attempts   int
+	LastStatus int
+	LastError  string
+}
+
+// DeadLetterStore keeps undelivered webhooks for inspection and redelivery, List returns the oldest first
+type DeadLetterStore interface {
+	Save(dl *DeadLetter) error
+	List(limit int) ([]*DeadLetter, error)
+	Delete(id uint64) error
+}
+
+// MemoryDeadLetterStore keeps dead letters in process
+type MemoryDeadLetterStore struct {
+	mu      sync.Mutex
+	nextID  uint64
+	letters map[uint64]*DeadLetter
+}
+
+func NewMemoryDeadLetterStore() *MemoryDeadLetterStore {
+	return &MemoryDeadLetterStore{letters: make(map[uint64]*DeadLetter)}
+}
+
+func (s *MemoryDeadLetterStore) Save(dl *DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	dl.ID = s.nextID
+	cp := *dl
+	s.letters[dl.ID] = &cp
+	return nil
+}
+
+func (s *MemoryDeadLetterStore) List(limit int) ([]*DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*DeadLetter, 0, len(s.letters))
+	for _, dl := range s.letters {
+		cp := *dl
+		list = append(list, &cp)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func (s *MemoryDeadLetterStore) Delete(id uint64) error {
+	s.mu.Lock()
+	delete(s.letters, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// WebhookDeadLetterModel is the table used by GormDeadLetterStore
+type WebhookDeadLetterModel struct {
+	xgorm.BaseModel
+	EventID    string `gorm:"column:event_id;type:varchar(128);not null;index:idx_event_id;comment:事件ID"`
+	URL        string `gorm:"column:url;type:varchar(1024);not null;comment:回调地址"`
+	Payload    string `gorm:"column:payload;type:text;comment:回调内容"`
+	Attempts   int    `gorm:"column:attempts;not null;comment:发送次数"`
+	LastStatus int    `gorm:"column:last_status;comment:最后一次HTTP状态码"`
+	LastError  string `gorm:"column:last_error;type:varchar(1024);comment:最后一次错误"`
+}
+
+func (WebhookDeadLetterModel) TableName() string {
+	return "webhook_dead_letter"
+}
+
+// GormDeadLetterStore is a DeadLetterStore backed by xgorm
+type GormDeadLetterStore struct {
+	db *gorm.DB
+}
+
+func NewGormDeadLetterStore(db *gorm.DB) *GormDeadLetterStore {
+	return &GormDeadLetterStore{db: db}
+}
+
+// AutoMigrate creates or updates the webhook_dead_letter table
+func (g *GormDeadLetterStore) AutoMigrate() error {
+	return xgorm.Primary(g.db).AutoMigrate(&WebhookDeadLetterModel{})
+}
+
+func (g *GormDeadLetterStore) Save(dl *DeadLetter) error {
+	lastError := dl.LastError
+	if len(lastError) > 1024 {
+		lastError = lastError[:1024]
+	}
+	m := WebhookDeadLetterModel{
+		EventID:    dl.EventID,
+		URL:        dl.URL,
+		Payload:    string(dl.Payload),
+		Attempts:   dl.Attempts,
+		LastStatus: dl.LastStatus,
+		LastError:  lastError,
+	}
+	if err := g.db.Create(&m).Error; err != nil {
+		return err
+	}
+	dl.ID = m.ID
+	return nil
+}
+
+func (g *GormDeadLetterStore) List(limit int) ([]*DeadLetter, error) {
+	var models []WebhookDeadLetterModel
+	q := g.db.Order("id")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	if err := q.Find(&models).Error; err != nil {
+		return nil, err
+	}
+	list := make([]*DeadLetter, 0, len(models))
+	for _, m := range models {
+		list = append(list, &DeadLetter{
+			ID:         m.ID,
+			EventID:    m.EventID,
+			URL:        m.URL,
+			Payload:    []byte(m.Payload),
+			Attempts:   m.Attempts,
+			LastStatus: m.LastStatus,
+			LastError:  m.LastError,
+		})
+	}
+	return list, nil
+}
+
+func (g *GormDeadLetterStore) Delete(id uint64) error {
+	return g.db.Delete(&WebhookDeadLetterModel{}, id).Error
+}
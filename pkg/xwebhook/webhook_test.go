@@ -0,0 +1,110 @@
+package xwebhook
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCanonicalize(t *testing.T) {
+	got, err := Canonicalize([]byte(`{ "b": 1.50, "a": {"y": "<x>", "x": [1, 2]} }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"a":{"x":[1,2],"y":"<x>"},"b":1.50}` {
+		t.Fatalf("canonical=%s", got)
+	}
+}
+
+func TestSignAndReceive(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	for _, pair := range []struct {
+		s Signer
+		v Verifier
+	}{
+		{HMACKey("secret"), HMACKey("secret")},
+		{&RSASigner{Key: key}, &RSAVerifier{Key: &key.PublicKey}},
+	} {
+		r := NewReceiver(pair.v, nil)
+		signed, err := Sign(pair.s, "evt-1", []byte(`{"amount": "1.5", "tx": "0xabc"}`), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the signature covers the body as sent, a re-encoded body is rejected
+		if err := r.Verify(signed.Header, []byte(`{"tx":"0xabc","amount":"1.5"}`)); err != ErrInvalidSignature {
+			t.Fatalf("%s: re-encoded err=%v", pair.s.Algorithm(), err)
+		}
+		// the event id is signed, the body cannot be replayed under another id
+		moved := signed.Header.Clone()
+		moved.Set(HeaderEventID, "evt-9")
+		if err := r.Verify(moved, signed.Body); err != ErrInvalidSignature {
+			t.Fatalf("%s: moved event err=%v", pair.s.Algorithm(), err)
+		}
+		if err := r.Verify(signed.Header, signed.Body); err != nil {
+			t.Fatalf("%s: %s", pair.s.Algorithm(), err)
+		}
+		if err := r.Verify(signed.Header, signed.Body); err != ErrReplayed {
+			t.Fatalf("replay err=%v", err)
+		}
+		tampered, _ := Sign(pair.s, "evt-2", []byte(`{"amount":"1.5"}`), time.Now())
+		if err := r.Verify(tampered.Header, []byte(`{"amount":"15"}`)); err != ErrInvalidSignature {
+			t.Fatalf("tampered err=%v", err)
+		}
+		old, _ := Sign(pair.s, "evt-3", []byte(`{}`), time.Now().Add(-time.Hour))
+		if err := r.Verify(old.Header, old.Body); err != ErrExpired {
+			t.Fatalf("expired err=%v", err)
+		}
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	var calls int32
+	receiver := NewReceiver(HMACKey("secret"), nil)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, err := receiver.VerifyRequest(req); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	dead := NewMemoryDeadLetterStore()
+	d := NewDispatcher(HMACKey("secret"), &DispatcherConfig{MaxAttempts: 3, DeadLetters: dead})
+	var delays []time.Duration
+	d.sleep = func(ctx context.Context, delay time.Duration) error {
+		delays = append(delays, delay)
+		return nil
+	}
+	if err := d.Send(context.Background(), srv.URL, "evt-1", []byte(`{"a":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(delays) != 2 || delays[0] != time.Second || delays[1] != 2*time.Second {
+		t.Fatalf("delays=%v", delays)
+	}
+
+	// a wrong key is rejected with 401 and is not retried
+	bad := NewDispatcher(HMACKey("wrong"), &DispatcherConfig{MaxAttempts: 3, DeadLetters: dead})
+	if err := bad.Send(context.Background(), srv.URL, "evt-2", []byte(`{"a":1}`)); err == nil {
+		t.Fatal("delivered with a wrong key")
+	}
+	list, _ := dead.List(10)
+	if len(list) != 1 || list[0].Attempts != 1 || list[0].LastStatus != http.StatusUnauthorized {
+		t.Fatalf("dead letters=%+v", list)
+	}
+	if err := d.Redeliver(context.Background(), list[0]); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := dead.List(10); len(list) != 0 {
+		t.Fatal("dead letter not removed")
+	}
+}